@@ -24,6 +24,12 @@ func main() {
 		dryRun     = flag.Bool("dry-run", false, "Dry run mode (don't actually sync)")
 		showVer    = flag.Bool("version", false, "Show version and exit")
 		validate   = flag.Bool("validate", false, "Validate configuration and exit")
+		exportPath = flag.String("export", "", "Export images to an OCI layout directory or .tar/.tar.zst bundle instead of the configured targets")
+		importPath = flag.String("import", "", "Import images from an OCI layout directory, OCI tarball or docker save archive instead of the configured sources")
+		mapping    = flag.String("mapping", "", "YAML file mapping bundle references to target repositories (used with -import)")
+		knownBlobs = flag.String("known-blobs", "", "Known blobs file; listed blobs are left out of the bundle (used with -export)")
+		knownOut   = flag.String("known-blobs-out", "", "After -import, write the blobs present in the targets to this known blobs file")
+		scanKnown  = flag.String("scan-known-blobs", "", "Scan the target repositories, write their blobs to this known blobs file and exit")
 	)
 
 	flag.Parse()
@@ -48,6 +54,29 @@ func main() {
 		os.Exit(0)
 	}
 
+	if *exportPath != "" && *importPath != "" {
+		fmt.Fprintln(os.Stderr, "Error: -export and -import cannot be used together")
+		os.Exit(1)
+	}
+
+	// Read all rules from an OCI layout bundle
+	if *importPath != "" {
+		for i := range cfg.SyncRules {
+			cfg.SyncRules[i].Source.Type = config.TypeOCILayout
+			cfg.SyncRules[i].Source.Path = *importPath
+			cfg.SyncRules[i].Source.Mapping = *mapping
+		}
+	}
+
+	// Redirect all rules to an OCI layout bundle
+	if *exportPath != "" {
+		for i := range cfg.SyncRules {
+			cfg.SyncRules[i].Target.Type = config.TypeOCILayout
+			cfg.SyncRules[i].Target.Path = *exportPath
+			cfg.SyncRules[i].Target.KnownBlobs = *knownBlobs
+		}
+	}
+
 	// Print configuration summary
 	printConfigSummary(cfg)
 
@@ -86,6 +115,21 @@ func main() {
 	// Create sync engine
 	engine := sync.NewEngine(cfg, *dryRun)
 
+	// Only produce a known blobs file for the exporting side
+	if *scanKnown != "" {
+		known, err := engine.ScanKnownBlobs(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Failed to scan targets: %v\n", err)
+			os.Exit(1)
+		}
+		if err := known.Save(*scanKnown); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Failed to write known blobs: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ Wrote %d known blobs to %s\n", len(known), *scanKnown)
+		os.Exit(0)
+	}
+
 	// Set progress callback
 	engine.SetProgressFunc(func(info sync.ProgressInfo) {
 		switch info.Phase {
@@ -107,11 +151,22 @@ func main() {
 	fmt.Println(strings.Repeat("=", 60) + "\n")
 
 	if *dryRun {
-		fmt.Println("⚠️  DRY RUN MODE - No actual changes will be made\n")
+		fmt.Print("⚠️  DRY RUN MODE - No actual changes will be made\n\n")
 	}
 
 	// Run sync
-	if err := engine.SyncAll(ctx); err != nil {
+	syncErr := engine.SyncAll(ctx)
+
+	// Blobs confirmed in the targets stay valid even if the sync failed part way
+	if *knownOut != "" && !*dryRun {
+		if err := engine.KnownBlobs().Save(*knownOut); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Failed to write known blobs: %v\n", err)
+		} else {
+			fmt.Printf("📝 Wrote %d known blobs to %s\n", len(engine.KnownBlobs()), *knownOut)
+		}
+	}
+
+	if err := syncErr; err != nil {
 		fmt.Fprintf(os.Stderr, "\n❌ Sync failed: %v\n", err)
 		os.Exit(1)
 	}
@@ -134,7 +189,15 @@ func printConfigSummary(cfg *config.Config) {
 		cfg.Global.Retry.MaxAttempts,
 		cfg.Global.Retry.InitialInterval,
 		cfg.Global.Retry.MaxInterval)
-	fmt.Printf("Timeout: %v\n", cfg.Global.Timeout)
+	if cfg.Global.Retry.Budget > 0 {
+		fmt.Printf("Retry budget: %d retries per rule\n", cfg.Global.Retry.Budget)
+	}
+	if cfg.Global.Timeout > 0 {
+		fmt.Printf("Timeout: %v per rule\n", cfg.Global.Timeout)
+	}
+	if cfg.Global.StallTimeout > 0 {
+		fmt.Printf("Stall timeout: %v per blob transfer\n", cfg.Global.StallTimeout)
+	}
 
 	fmt.Printf("\nRegistries: %d\n", len(cfg.Registries))
 	for name, reg := range cfg.Registries {
@@ -148,12 +211,18 @@ func printConfigSummary(cfg *config.Config) {
 	enabledRules := cfg.GetEnabledRules()
 	fmt.Printf("\nSync Rules: %d total, %d enabled\n", len(cfg.SyncRules), len(enabledRules))
 	for _, rule := range enabledRules {
-		fmt.Printf("  - %s: %s/%s → %s/%s\n",
+		source := rule.Source.Registry + "/" + rule.Source.Repository
+		if rule.Source.IsOCILayout() {
+			source = "oci-layout:" + rule.Source.Path
+		}
+		target := rule.Target.Registry + "/" + rule.Target.Repository
+		if rule.Target.IsOCILayout() {
+			target = "oci-layout:" + rule.Target.Path
+		}
+		fmt.Printf("  - %s: %s → %s\n",
 			rule.Name,
-			rule.Source.Registry,
-			rule.Source.Repository,
-			rule.Target.Registry,
-			rule.Target.Repository)
+			source,
+			target)
 
 		if len(rule.Tags.Include) > 0 {
 			fmt.Printf("    Include: %v\n", rule.Tags.Include)
@@ -167,6 +236,9 @@ func printConfigSummary(cfg *config.Config) {
 		if len(rule.Architectures) > 0 {
 			fmt.Printf("    Architectures: %v\n", rule.Architectures)
 		}
+		if rule.Timeout > 0 {
+			fmt.Printf("    Timeout: %v\n", rule.Timeout)
+		}
 	}
 
 	fmt.Println(strings.Repeat("-", 60))
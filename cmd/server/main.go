@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
@@ -17,9 +18,14 @@ import (
 
 	"registry-sync/internal/api/handlers"
 	"registry-sync/internal/api/middleware"
+	"registry-sync/internal/clientpool"
 	"registry-sync/internal/db/store"
+	"registry-sync/internal/election"
 	"registry-sync/internal/scheduler"
 	ws "registry-sync/internal/websocket"
+	"registry-sync/pkg/blobcache"
+	"registry-sync/pkg/ratelimit"
+	"registry-sync/pkg/registry"
 )
 
 const version = "1.0.0"
@@ -33,9 +39,26 @@ var upgrader = websocket.Upgrader{
 func main() {
 	// CLI flags
 	var (
-		port   = flag.String("port", "8080", "Server port")
-		dbPath = flag.String("db", "registry-sync.db", "Database path")
-		showVer = flag.Bool("version", false, "Show version")
+		port             = flag.String("port", "8080", "Server port")
+		dbPath           = flag.String("db", "registry-sync.db", "Database path")
+		showVer          = flag.Bool("version", false, "Show version")
+		cacheDir         = flag.String("blob-cache-dir", "", "Directory of the local blob cache shared by all tasks (disabled if empty)")
+		cacheSize        = flag.Int64("blob-cache-size", 10240, "Maximum size of the local blob cache in MB")
+		bandwidth        = flag.String("bandwidth", "", "Bandwidth limit for all blob transfers, e.g. 20MB or 08:00-20:00=20MB,100MB (unlimited if empty)")
+		breakerThreshold = flag.Int("breaker-threshold", registry.DefaultBreakerThreshold, "Consecutive failures after which requests to a registry fail fast (0 disables the circuit breaker)")
+		breakerCooldown  = flag.Duration("breaker-cooldown", registry.DefaultBreakerCooldown, "How long requests to a failing registry fail fast before it is probed again")
+		maxConcurrent    = flag.Int("max-concurrent", 0, "Maximum number of executions running at the same time, further executions are queued (0 = unlimited)")
+		execTimeout      = flag.Duration("execution-timeout", 0, "Maximum duration of an execution of tasks without their own timeout, longer executions are stopped as timed out (0 = unlimited)")
+		stallTimeout     = flag.Duration("stall-timeout", 0, "Abort and retry blob transfers during which no data flowed for this long (0 disables)")
+		leaderElect      = flag.String("leader-elect", "", "Elect a leader among replicas, which alone triggers and runs executions: db or kubernetes (disabled if empty)")
+		leaderID         = flag.String("leader-id", "", "Identity of this replica in the leader election (hostname-pid if empty)")
+		leaderLease      = flag.Duration("leader-lease", 15*time.Second, "Duration of the leader lease, a failed leader is replaced after at most this long")
+		leaseName        = flag.String("leader-lease-name", "registry-sync-scheduler", "Name of the leader lease row or Kubernetes Lease object")
+		leaseNamespace   = flag.String("leader-namespace", "", "Namespace of the Kubernetes Lease object (namespace of the pod if empty)")
+		mode             = flag.String("mode", "standalone", "standalone: serve the API and run executions; api: serve the API and queue executions for workers; worker: run queued executions")
+		workerID         = flag.String("worker-id", "", "Name of this worker (hostname-pid if empty)")
+		workerLease      = flag.Duration("worker-lease", 30*time.Second, "Duration of a worker's claim on an execution, executions of workers that stop renewing it are re-queued")
+		workerPoll       = flag.Duration("worker-poll", 2*time.Second, "How often a worker checks the queue for executions")
 	)
 	flag.Parse()
 
@@ -56,13 +79,81 @@ func main() {
 	hub := ws.NewHub()
 	go hub.Run()
 
+	// Initialize blob cache
+	var cache *blobcache.Cache
+	if *cacheDir != "" {
+		cache, err = blobcache.New(*cacheDir, *cacheSize*1024*1024)
+		if err != nil {
+			log.Fatalf("Failed to initialize blob cache: %v", err)
+		}
+		log.Printf("Blob cache enabled: %s (%d MB)", *cacheDir, *cacheSize)
+	}
+
+	// Initialize registry client pool
+	pool := clientpool.New()
+	schedule, err := ratelimit.ParseBandwidthSchedule(*bandwidth)
+	if err != nil {
+		log.Fatalf("Invalid bandwidth limit: %v", err)
+	}
+	if schedule != nil {
+		pool.SetBandwidth(ratelimit.NewBandwidthLimiter(schedule))
+		log.Printf("Bandwidth limit enabled: %s", *bandwidth)
+	}
+	pool.SetBreaker(*breakerThreshold, *breakerCooldown)
+	pool.SetStallTimeout(*stallTimeout)
+
 	// Initialize scheduler
-	sched := scheduler.NewScheduler(st, hub)
+	sched := scheduler.NewScheduler(st, hub, pool)
+	if cache != nil {
+		sched.SetBlobCache(cache)
+	}
+	sched.SetMaxConcurrent(*maxConcurrent)
+	sched.SetExecutionTimeout(*execTimeout)
+
+	switch *mode {
+	case "standalone":
+	case "api":
+		sched.EnableWorkers()
+	case "worker":
+		if *leaderElect != "" {
+			log.Fatalf("Leader election is not used in worker mode")
+		}
+		if err := runWorker(sched, *port, *workerID, *workerLease, *workerPoll); err != nil {
+			log.Fatalf("Worker failed: %v", err)
+		}
+		return
+	default:
+		log.Fatalf("Unknown mode %q, expected standalone, api or worker", *mode)
+	}
+
+	// Initialize leader election
+	var elector *election.Elector
+	if *leaderElect != "" {
+		elector, err = newElector(st, *leaderElect, *leaderID, *leaderLease, *leaseName, *leaseNamespace, sched)
+		if err != nil {
+			log.Fatalf("Failed to initialize leader election: %v", err)
+		}
+		sched.EnableElection()
+	}
+
 	if err := sched.Start(); err != nil {
 		log.Fatalf("Failed to start scheduler: %v", err)
 	}
 	defer sched.Stop()
 
+	electionCtx, stopElection := context.WithCancel(context.Background())
+	electionDone := make(chan struct{})
+	if elector != nil {
+		status := elector.Status()
+		log.Printf("Leader election enabled: %s as %s", status.Lock, status.Identity)
+		go func() {
+			elector.Run(electionCtx)
+			close(electionDone)
+		}()
+	} else {
+		close(electionDone)
+	}
+
 	// Initialize Gin router
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.Default()
@@ -72,30 +163,42 @@ func main() {
 
 	// API v1 routes
 	v1 := router.Group("/api/v1")
+	if elector != nil {
+		v1.Use(middleware.LeaderOnly(elector))
+	}
 	{
 		// Health check
 		v1.GET("/health", func(c *gin.Context) {
-			c.JSON(200, gin.H{"status": "ok", "version": version})
+			health := gin.H{"status": "ok", "version": version, "mode": *mode}
+			if cache != nil {
+				health["blob_cache"] = cache.Stats()
+			}
+			if elector != nil {
+				health["leader_election"] = elector.Status()
+			}
+			c.JSON(200, health)
 		})
 
 		// Registries
-		registryHandler := handlers.NewRegistryHandler(st)
+		registryHandler := handlers.NewRegistryHandler(st, pool)
 		v1.POST("/registries", registryHandler.CreateRegistry)
 		v1.GET("/registries", registryHandler.ListRegistries)
 		v1.GET("/registries/:id", registryHandler.GetRegistry)
 		v1.PUT("/registries/:id", registryHandler.UpdateRegistry)
 		v1.DELETE("/registries/:id", registryHandler.DeleteRegistry)
 		v1.POST("/registries/:id/test", registryHandler.TestRegistry)
+		v1.GET("/registries/:id/quota", registryHandler.GetQuota)
 		v1.GET("/registries/:id/projects", registryHandler.ListProjects)
 		v1.GET("/registries/:id/projects/:project/repositories", registryHandler.ListRepositories)
 
 		// Tasks
-		taskHandler := handlers.NewTaskHandler(st)
+		taskHandler := handlers.NewTaskHandler(st, sched)
 		v1.POST("/tasks", taskHandler.CreateTask)
 		v1.GET("/tasks", taskHandler.ListTasks)
 		v1.GET("/tasks/:id", taskHandler.GetTask)
 		v1.PUT("/tasks/:id", taskHandler.UpdateTask)
 		v1.DELETE("/tasks/:id", taskHandler.DeleteTask)
+		v1.GET("/tasks/:id/schedule", taskHandler.GetSchedule)
 		v1.POST("/tasks/:id/run", func(c *gin.Context) {
 			// Parse task ID
 			var taskID uint
@@ -115,7 +218,7 @@ func main() {
 			fmt.Sscanf(c.Param("id"), "%d", &taskID)
 
 			// Cancel task
-			if err := sched.CancelTask(taskID); err != nil {
+			if err := sched.CancelTask(taskID, canceledBy(c)); err != nil {
 				c.JSON(500, gin.H{"error": err.Error()})
 				return
 			}
@@ -128,6 +231,53 @@ func main() {
 		v1.GET("/executions", executionHandler.ListExecutions)
 		v1.GET("/executions/:id", executionHandler.GetExecution)
 		v1.GET("/executions/:id/logs", executionHandler.GetExecutionLogs)
+		v1.GET("/executions/:id/images", executionHandler.GetExecutionImages)
+		v1.GET("/executions/:id/pipeline", executionHandler.GetPipeline)
+		v1.POST("/executions/:id/resume", func(c *gin.Context) {
+			// Parse execution ID
+			var executionID uint
+			fmt.Sscanf(c.Param("id"), "%d", &executionID)
+
+			// Resume execution
+			if err := sched.ResumeExecution(context.Background(), executionID); err != nil {
+				c.JSON(500, gin.H{"error": err.Error()})
+				return
+			}
+
+			c.JSON(200, gin.H{"message": "execution resumed"})
+		})
+		v1.POST("/executions/:id/retry-failed", func(c *gin.Context) {
+			// Parse execution ID
+			var executionID uint
+			fmt.Sscanf(c.Param("id"), "%d", &executionID)
+
+			// Start a new execution with the failed tags
+			execution, err := sched.RetryFailed(context.Background(), executionID)
+			if errors.Is(err, scheduler.ErrInvalidRef) {
+				c.JSON(400, gin.H{"error": err.Error()})
+				return
+			}
+			if err != nil {
+				c.JSON(500, gin.H{"error": err.Error()})
+				return
+			}
+
+			c.JSON(200, gin.H{"message": "retrying failed tags", "execution_id": execution.ID, "tags": execution.OnlyTags})
+		})
+
+		v1.POST("/executions/:id/cancel", func(c *gin.Context) {
+			// Parse execution ID
+			var executionID uint
+			fmt.Sscanf(c.Param("id"), "%d", &executionID)
+
+			// Cancel execution
+			if err := sched.CancelExecution(executionID, canceledBy(c)); err != nil {
+				c.JSON(500, gin.H{"error": err.Error()})
+				return
+			}
+
+			c.JSON(200, gin.H{"message": "execution canceled"})
+		})
 
 		// Statistics
 		v1.GET("/stats", executionHandler.GetStats)
@@ -141,6 +291,15 @@ func main() {
 		v1.DELETE("/notifications/:id", notificationHandler.DeleteNotificationChannel)
 		v1.POST("/notifications/:id/test", notificationHandler.TestNotificationChannel)
 
+		// Webhooks
+		webhookHandler := handlers.NewWebhookHandler(st, sched)
+		v1.POST("/webhooks", webhookHandler.CreateWebhook)
+		v1.GET("/webhooks", webhookHandler.ListWebhooks)
+		v1.PUT("/webhooks/:id", webhookHandler.UpdateWebhook)
+		v1.DELETE("/webhooks/:id", webhookHandler.DeleteWebhook)
+		v1.POST("/webhooks/:id/rotate", webhookHandler.RotateWebhookToken)
+		v1.POST("/hooks/:token", webhookHandler.Receive)
+
 		// WebSocket for real-time updates
 		v1.GET("/ws", func(c *gin.Context) {
 			conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
@@ -212,5 +371,117 @@ func main() {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
 
+	// Hand over leadership before the scheduler stops
+	stopElection()
+	<-electionDone
+
 	log.Println("Server exited")
 }
+
+// newElector creates the leader election of the scheduler on a lease of the
+// given backend
+func newElector(st *store.Store, backend, identity string, ttl time.Duration, name, namespace string, sched *scheduler.Scheduler) (*election.Elector, error) {
+	if ttl < time.Second {
+		return nil, fmt.Errorf("leader lease must be at least 1s, got %v", ttl)
+	}
+	if identity == "" {
+		var err error
+		if identity, err = defaultIdentity(); err != nil {
+			return nil, err
+		}
+	}
+
+	var lock election.Lock
+	switch backend {
+	case "db":
+		lock = election.NewDBLock(st, name)
+	case "kubernetes":
+		kubeLock, err := election.NewKubeLock(namespace, name)
+		if err != nil {
+			return nil, err
+		}
+		lock = kubeLock
+	default:
+		return nil, fmt.Errorf("unknown leader election backend %q, expected db or kubernetes", backend)
+	}
+
+	return election.New(lock, identity, ttl, sched.StartLeading, sched.StopLeading), nil
+}
+
+// runWorker runs executions queued by API servers until the process is
+// stopped. Only the health check is served.
+func runWorker(sched *scheduler.Scheduler, port, id string, lease, poll time.Duration) error {
+	if lease < 3*time.Second {
+		return fmt.Errorf("worker lease must be at least 3s, got %v", lease)
+	}
+	if poll <= 0 {
+		return fmt.Errorf("worker poll interval must be positive, got %v", poll)
+	}
+	if id == "" {
+		var err error
+		if id, err = defaultIdentity(); err != nil {
+			return err
+		}
+	}
+	sched.EnableWorker(id, lease)
+
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		sched.RunWorker(ctx, poll)
+		close(done)
+	}()
+
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.GET("/api/v1/health", func(c *gin.Context) {
+		c.JSON(200, gin.H{"status": "ok", "version": version, "mode": "worker", "worker": sched.WorkerStatus()})
+	})
+	srv := &http.Server{
+		Addr:    ":" + port,
+		Handler: router,
+	}
+	go func() {
+		log.Printf("🚀 Worker %s health check on http://localhost:%s/api/v1/health", id, port)
+
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Server failed: %v", err)
+		}
+	}()
+
+	// Wait for interrupt signal
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	log.Println("Shutting down worker...")
+
+	// Running executions are re-queued for other workers
+	stop()
+	<-done
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
+}
+
+// defaultIdentity names this process in leader elections and as a worker
+func defaultIdentity() (string, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", fmt.Errorf("failed to get hostname: %w", err)
+	}
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid()), nil
+}
+
+// canceledBy returns who cancels an execution: the optional canceled_by of
+// the request body, or the client address
+func canceledBy(c *gin.Context) string {
+	var req struct {
+		CanceledBy string `json:"canceled_by"`
+	}
+	if c.ShouldBindJSON(&req) == nil && req.CanceledBy != "" {
+		return req.CanceledBy
+	}
+	return "api " + c.ClientIP()
+}
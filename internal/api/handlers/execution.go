@@ -3,9 +3,11 @@ package handlers
 import (
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
+	"registry-sync/internal/db/models"
 	"registry-sync/internal/db/store"
 )
 
@@ -49,7 +51,10 @@ func (h *ExecutionHandler) ListExecutions(c *gin.Context) {
 	var execs interface{}
 	var err error
 
-	if taskIDStr != "" {
+	if runIDStr := c.Query("run_id"); runIDStr != "" {
+		runID, _ := strconv.ParseUint(runIDStr, 10, 32)
+		execs, err = h.store.ListExecutionsByRun(uint(runID))
+	} else if taskIDStr != "" {
 		taskID, _ := strconv.ParseUint(taskIDStr, 10, 32)
 		execs, err = h.store.ListExecutionsByTask(uint(taskID), limit)
 	} else {
@@ -64,6 +69,81 @@ func (h *ExecutionHandler) ListExecutions(c *gin.Context) {
 	c.JSON(http.StatusOK, execs)
 }
 
+// GetPipeline gets the pipeline run of an execution: all executions chained
+// by task dependencies, in the order they were created
+// GET /api/v1/executions/:id/pipeline
+func (h *ExecutionHandler) GetPipeline(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid execution ID"})
+		return
+	}
+
+	exec, err := h.store.GetExecution(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "execution not found"})
+		return
+	}
+
+	runID := exec.RunID
+	if runID == 0 {
+		runID = exec.ID // created before pipeline runs were recorded
+	}
+	execs, err := h.store.ListExecutionsByRun(runID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var endTime *time.Time
+	for _, e := range execs {
+		if e.EndTime != nil && (endTime == nil || e.EndTime.After(*endTime)) {
+			endTime = e.EndTime
+		}
+	}
+	status := pipelineStatus(execs)
+	if !isFinal(status) {
+		endTime = nil
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"run_id":     runID,
+		"status":     status,
+		"start_time": execs[0].StartTime,
+		"end_time":   endTime,
+		"executions": execs,
+	})
+}
+
+// pipelineStatus summarizes the executions of a pipeline run: it is running
+// while any execution is, otherwise the worst outcome wins
+func pipelineStatus(execs []models.Execution) models.ExecutionStatus {
+	order := []models.ExecutionStatus{
+		models.StatusRunning,
+		models.StatusPending,
+		models.StatusFailed,
+		models.StatusTimedOut,
+		models.StatusInterrupted,
+		models.StatusCanceled,
+	}
+	for _, status := range order {
+		for _, e := range execs {
+			if e.Status == status {
+				if status == models.StatusPending {
+					return models.StatusRunning
+				}
+				return status
+			}
+		}
+	}
+	return models.StatusSuccess
+}
+
+// isFinal reports whether a pipeline status is an outcome
+func isFinal(status models.ExecutionStatus) bool {
+	return status != models.StatusRunning && status != models.StatusPending
+}
+
 // GetExecutionLogs gets execution logs
 // GET /api/v1/executions/:id/logs
 func (h *ExecutionHandler) GetExecutionLogs(c *gin.Context) {
@@ -86,6 +166,56 @@ func (h *ExecutionHandler) GetExecutionLogs(c *gin.Context) {
 	c.JSON(http.StatusOK, logs)
 }
 
+// GetExecutionImages gets the per-image results of an execution
+// GET /api/v1/executions/:id/images?status=&repository=&tag=&error_code=&digest=&page=1&page_size=50
+func (h *ExecutionHandler) GetExecutionImages(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid execution ID"})
+		return
+	}
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid page"})
+		return
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", "50"))
+	if err != nil || pageSize < 1 || pageSize > 500 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "page_size must be between 1 and 500"})
+		return
+	}
+
+	status := models.ImageStatus(c.Query("status"))
+	switch status {
+	case "", models.ImagePending, models.ImageSuccess, models.ImageFailed, models.ImageSkipped:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid status: " + string(status)})
+		return
+	}
+
+	images, total, err := h.store.QueryExecutionImages(uint(id), store.ImageFilter{
+		Status:     status,
+		Repository: c.Query("repository"),
+		Tag:        c.Query("tag"),
+		ErrorCode:  c.Query("error_code"),
+		Digest:     c.Query("digest"),
+		Page:       page,
+		PageSize:   pageSize,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items":     images,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
 // GetStats gets system statistics
 // GET /api/v1/stats
 func (h *ExecutionHandler) GetStats(c *gin.Context) {
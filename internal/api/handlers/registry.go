@@ -8,20 +8,22 @@ import (
 
 	"github.com/gin-gonic/gin"
 
+	"registry-sync/internal/clientpool"
 	"registry-sync/internal/db/models"
 	"registry-sync/internal/db/store"
-	"registry-sync/pkg/config"
+	"registry-sync/pkg/ratelimit"
 	"registry-sync/pkg/registry"
 )
 
 // RegistryHandler handles registry-related requests
 type RegistryHandler struct {
 	store *store.Store
+	pool  *clientpool.Pool
 }
 
 // NewRegistryHandler creates a new registry handler
-func NewRegistryHandler(store *store.Store) *RegistryHandler {
-	return &RegistryHandler{store: store}
+func NewRegistryHandler(store *store.Store, pool *clientpool.Pool) *RegistryHandler {
+	return &RegistryHandler{store: store, pool: pool}
 }
 
 // CreateRegistry creates a new registry
@@ -33,6 +35,11 @@ func (h *RegistryHandler) CreateRegistry(c *gin.Context) {
 		return
 	}
 
+	if _, err := ratelimit.ParseBandwidthSchedule(req.Bandwidth); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Debug log
 	log.Printf("DEBUG: Creating registry '%s', password length: %d, password: '%s'", req.Name, len(req.Password), req.Password)
 
@@ -77,12 +84,24 @@ func (h *RegistryHandler) ListRegistries(c *gin.Context) {
 		return
 	}
 
-	// Clear passwords before sending response
+	// Clear passwords before sending response and attach the circuit breaker
+	// state of registries that have been used since startup
+	resp := make([]registryWithBreaker, len(regs))
 	for i := range regs {
 		regs[i].Password = ""
+		resp[i].Registry = regs[i]
+		if state, ok := h.pool.Breaker(regs[i].ID); ok {
+			resp[i].Breaker = &state
+		}
 	}
 
-	c.JSON(http.StatusOK, regs)
+	c.JSON(http.StatusOK, resp)
+}
+
+// registryWithBreaker is a registry as returned by the list API
+type registryWithBreaker struct {
+	models.Registry
+	Breaker *registry.BreakerState `json:"breaker,omitempty"`
 }
 
 // UpdateRegistry updates a registry
@@ -100,6 +119,11 @@ func (h *RegistryHandler) UpdateRegistry(c *gin.Context) {
 		return
 	}
 
+	if _, err := ratelimit.ParseBandwidthSchedule(req.Bandwidth); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	req.ID = uint(id)
 
 	// If password is empty, preserve the existing password
@@ -116,6 +140,7 @@ func (h *RegistryHandler) UpdateRegistry(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	h.pool.Invalidate(req.ID)
 
 	// Clear password before sending response
 	req.Password = ""
@@ -136,6 +161,7 @@ func (h *RegistryHandler) DeleteRegistry(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	h.pool.Invalidate(uint(id))
 
 	c.JSON(http.StatusOK, gin.H{"message": "registry deleted"})
 }
@@ -155,31 +181,62 @@ func (h *RegistryHandler) TestRegistry(c *gin.Context) {
 		return
 	}
 
-	// Create registry client
-	client := registry.NewClient(
-		config.NormalizeRegistryURL(reg.URL),
-		reg.Username,
-		reg.Password,
-		reg.Insecure,
-		reg.RateLimit,
-	)
+	// Get the shared registry client
+	client := h.pool.Get(reg)
 
 	// Test connection
 	ctx := context.Background()
 	if err := client.PingCheck(ctx); err != nil {
 		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"error": "registry connection failed",
+			"error":   "registry connection failed",
 			"details": err.Error(),
 		})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "registry connection test successful",
+		"message":  "registry connection test successful",
 		"registry": reg.Name,
 	})
 }
 
+// GetQuota returns the pull quota of a registry
+// GET /api/v1/registries/:id/quota
+func (h *RegistryHandler) GetQuota(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid registry ID"})
+		return
+	}
+
+	reg, err := h.store.GetRegistry(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "registry not found"})
+		return
+	}
+
+	// Use the quota seen by running tasks, ask the registry if there is none yet
+	client := h.pool.Get(reg)
+	quota, ok := client.PullQuota()
+	if !ok || c.Query("refresh") == "true" {
+		quota, ok, err = client.CheckPullQuota(context.Background())
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error":   "failed to check pull quota",
+				"details": err.Error(),
+			})
+			return
+		}
+	}
+
+	if !ok {
+		c.JSON(http.StatusOK, gin.H{"registry_id": reg.ID, "available": false})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"registry_id": reg.ID, "available": true, "quota": quota})
+}
+
 // ListProjects lists all projects in a registry
 // GET /api/v1/registries/:id/projects
 func (h *RegistryHandler) ListProjects(c *gin.Context) {
@@ -195,21 +252,15 @@ func (h *RegistryHandler) ListProjects(c *gin.Context) {
 		return
 	}
 
-	// Create registry client
-	client := registry.NewClient(
-		config.NormalizeRegistryURL(reg.URL),
-		reg.Username,
-		reg.Password,
-		reg.Insecure,
-		reg.RateLimit,
-	)
+	// Get the shared registry client
+	client := h.pool.Get(reg)
 
 	// List projects
 	ctx := context.Background()
 	projects, err := client.ListProjects(ctx)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "failed to list projects",
+			"error":   "failed to list projects",
 			"details": err.Error(),
 		})
 		return
@@ -239,21 +290,15 @@ func (h *RegistryHandler) ListRepositories(c *gin.Context) {
 		return
 	}
 
-	// Create registry client
-	client := registry.NewClient(
-		config.NormalizeRegistryURL(reg.URL),
-		reg.Username,
-		reg.Password,
-		reg.Insecure,
-		reg.RateLimit,
-	)
+	// Get the shared registry client
+	client := h.pool.Get(reg)
 
 	// List repositories
 	ctx := context.Background()
 	repos, err := client.ListRepositories(ctx, project)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "failed to list repositories",
+			"error":   "failed to list repositories",
 			"details": err.Error(),
 		})
 		return
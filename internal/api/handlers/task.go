@@ -1,23 +1,30 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"registry-sync/internal/db/models"
 	"registry-sync/internal/db/store"
+	"registry-sync/internal/scheduler"
+	"registry-sync/pkg/ratelimit"
 )
 
 // TaskHandler handles task-related requests
 type TaskHandler struct {
 	store *store.Store
+	sched *scheduler.Scheduler
 }
 
-// NewTaskHandler creates a new task handler
-func NewTaskHandler(store *store.Store) *TaskHandler {
-	return &TaskHandler{store: store}
+// NewTaskHandler creates a new task handler. Task changes are applied to
+// the cron schedule of sched.
+func NewTaskHandler(store *store.Store, sched *scheduler.Scheduler) *TaskHandler {
+	return &TaskHandler{store: store, sched: sched}
 }
 
 // CreateTask creates a new sync task
@@ -30,24 +37,229 @@ func (h *TaskHandler) CreateTask(c *gin.Context) {
 	}
 
 	// Validate source and target registries exist
-	if _, err := h.store.GetRegistry(req.SourceRegistry); err != nil {
+	if req.IsLayoutSource() {
+		if req.SourcePath == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "source path is required for oci-layout sources"})
+			return
+		}
+	} else if _, err := h.store.GetRegistry(req.SourceRegistry); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "source registry not found"})
 		return
 	}
 
-	if _, err := h.store.GetRegistry(req.TargetRegistry); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "target registry not found"})
+	if _, err := ratelimit.ParseBandwidthSchedule(req.Bandwidth); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateQuota(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateRetry(&req.Retry); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Timeout < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "timeout must not be negative"})
+		return
+	}
+	if err := validateOverlap(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := validateSchedule(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.validateDependencies(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	applyTargets(&req)
+	for _, target := range req.GetTargets() {
+		if _, err := h.store.GetRegistry(target.Registry); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "target registry not found"})
+			return
+		}
+	}
 
 	if err := h.store.CreateTask(&req); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if err := h.sched.Reschedule(req.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("task created but not scheduled: %v", err)})
+		return
+	}
 
 	c.JSON(http.StatusCreated, req)
 }
 
+// applyTargets mirrors the first of multiple targets into the single target
+// fields, which older clients and oci-layout imports still read
+func applyTargets(task *models.SyncTask) {
+	if len(task.Targets) == 0 {
+		return
+	}
+	task.TargetRegistry = task.Targets[0].Registry
+	task.TargetProject = task.Targets[0].Project
+	task.TargetRepo = task.Targets[0].Repo
+}
+
+// validateQuota checks the quota settings of a task
+func validateQuota(task *models.SyncTask) error {
+	if task.QuotaThreshold < 0 {
+		return fmt.Errorf("quota threshold must not be negative")
+	}
+	switch task.QuotaAction {
+	case "":
+		task.QuotaAction = models.QuotaActionStop
+	case models.QuotaActionStop, models.QuotaActionPostpone:
+	default:
+		return fmt.Errorf("unknown quota action %s", task.QuotaAction)
+	}
+	return nil
+}
+
+// validateOverlap checks the overlap policy of a task
+func validateOverlap(task *models.SyncTask) error {
+	switch task.OverlapPolicy {
+	case "":
+		task.OverlapPolicy = models.OverlapSkip
+	case models.OverlapSkip, models.OverlapQueue, models.OverlapCancelPrevious:
+	default:
+		return fmt.Errorf("unknown overlap policy %s", task.OverlapPolicy)
+	}
+	return nil
+}
+
+// validateSchedule checks the cron expression, timezone and catch-up policy
+// of a task
+func validateSchedule(task *models.SyncTask) error {
+	switch task.CatchUp {
+	case "":
+		task.CatchUp = models.CatchUpSkip
+	case models.CatchUpSkip, models.CatchUpRunOnce:
+	default:
+		return fmt.Errorf("unknown catch-up policy %s", task.CatchUp)
+	}
+	if task.Timezone != "" {
+		if _, err := time.LoadLocation(task.Timezone); err != nil {
+			return fmt.Errorf("invalid timezone %q: %w", task.Timezone, err)
+		}
+	}
+	if task.CronExpression != "" {
+		if _, err := scheduler.ParseSchedule(task.CronExpression, task.Timezone); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateDependencies checks the dependencies of a task and rejects them if
+// a task would end up depending on itself
+func (h *TaskHandler) validateDependencies(task *models.SyncTask) error {
+	tasks, err := h.store.ListTasks()
+	if err != nil {
+		return fmt.Errorf("failed to load tasks: %w", err)
+	}
+
+	names := make(map[uint]string, len(tasks))
+	graph := make(map[uint][]uint, len(tasks)) // task_id -> task_ids it depends on
+	for _, t := range tasks {
+		names[t.ID] = t.Name
+		for _, dep := range t.DependsOn {
+			graph[t.ID] = append(graph[t.ID], dep.TaskID)
+		}
+	}
+
+	graph[task.ID] = nil
+	seen := make(map[uint]bool, len(task.DependsOn))
+	for i := range task.DependsOn {
+		dep := &task.DependsOn[i]
+		switch dep.Condition {
+		case "":
+			dep.Condition = models.DependOnSuccess
+		case models.DependOnSuccess, models.DependAlways:
+		default:
+			return fmt.Errorf("unknown dependency condition %s", dep.Condition)
+		}
+		if _, exists := names[dep.TaskID]; !exists {
+			return fmt.Errorf("dependency task %d not found", dep.TaskID)
+		}
+		if seen[dep.TaskID] {
+			return fmt.Errorf("duplicate dependency on task %s", names[dep.TaskID])
+		}
+		seen[dep.TaskID] = true
+		graph[task.ID] = append(graph[task.ID], dep.TaskID)
+	}
+
+	// New tasks have no dependents yet, so they can not close a cycle
+	if task.ID == 0 {
+		return nil
+	}
+	names[task.ID] = task.Name
+	if cycle := findCycle(graph, task.ID); cycle != nil {
+		path := make([]string, len(cycle))
+		for i, id := range cycle {
+			path[i] = names[id]
+		}
+		return fmt.Errorf("dependency cycle: %s", strings.Join(path, " -> "))
+	}
+	return nil
+}
+
+// findCycle returns a path of dependencies leading from start back to
+// start, or nil if there is none
+func findCycle(graph map[uint][]uint, start uint) []uint {
+	visited := make(map[uint]bool)
+	var path []uint
+
+	var visit func(id uint) bool
+	visit = func(id uint) bool {
+		path = append(path, id)
+		for _, next := range graph[id] {
+			if next == start {
+				path = append(path, start)
+				return true
+			}
+			if !visited[next] {
+				visited[next] = true
+				if visit(next) {
+					return true
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		return false
+	}
+
+	if visit(start) {
+		return path
+	}
+	return nil
+}
+
+// validateRetry checks the retry settings of a task
+func validateRetry(retry *models.RetrySettings) error {
+	if retry.Budget < 0 {
+		return fmt.Errorf("retry budget must not be negative")
+	}
+	for name, policy := range map[string]models.RetryPolicy{
+		"retry":               retry.RetryPolicy,
+		"retry.manifest":      retry.Manifest,
+		"retry.blob_download": retry.BlobDownload,
+		"retry.blob_upload":   retry.BlobUpload,
+		"retry.catalog":       retry.Catalog,
+	} {
+		if policy.MaxAttempts < 0 || policy.InitialInterval < 0 || policy.MaxInterval < 0 {
+			return fmt.Errorf("%s: retry settings must not be negative", name)
+		}
+	}
+	return nil
+}
+
 // GetTask gets a task by ID
 // GET /api/v1/tasks/:id
 func (h *TaskHandler) GetTask(c *gin.Context) {
@@ -92,16 +304,95 @@ func (h *TaskHandler) UpdateTask(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-
 	req.ID = uint(id)
+
+	if _, err := ratelimit.ParseBandwidthSchedule(req.Bandwidth); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateQuota(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateRetry(&req.Retry); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Timeout < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "timeout must not be negative"})
+		return
+	}
+	if err := validateOverlap(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateSchedule(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.validateDependencies(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	existing, err := h.store.GetTask(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
+		return
+	}
+
+	req.LastScheduledAt = existing.LastScheduledAt
+	applyTargets(&req)
 	if err := h.store.UpdateTask(&req); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if err := h.sched.Reschedule(req.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("task updated but not rescheduled: %v", err)})
+		return
+	}
 
 	c.JSON(http.StatusOK, req)
 }
 
+// GetSchedule previews the next fire times of a task's cron schedule
+// GET /api/v1/tasks/:id/schedule?count=5
+func (h *TaskHandler) GetSchedule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid task ID"})
+		return
+	}
+
+	count, err := strconv.Atoi(c.DefaultQuery("count", "5"))
+	if err != nil || count < 1 || count > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "count must be between 1 and 100"})
+		return
+	}
+
+	task, err := h.store.GetTask(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
+		return
+	}
+
+	runs, err := scheduler.NextRuns(task, time.Now(), count)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"task_id":           task.ID,
+		"cron_expression":   task.CronExpression,
+		"timezone":          task.Timezone,
+		"enabled":           task.Enabled,
+		"catch_up":          task.CatchUp,
+		"last_scheduled_at": task.LastScheduledAt,
+		"next_runs":         runs,
+	})
+}
+
 // DeleteTask deletes a task
 // DELETE /api/v1/tasks/:id
 func (h *TaskHandler) DeleteTask(c *gin.Context) {
@@ -111,10 +402,24 @@ func (h *TaskHandler) DeleteTask(c *gin.Context) {
 		return
 	}
 
+	// Dependents would wait for the task forever
+	tasks, err := h.store.ListTasks()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for _, t := range tasks {
+		if _, ok := t.DependsOnTask(uint(id)); ok {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("task %s depends on this task", t.Name)})
+			return
+		}
+	}
+
 	if err := h.store.DeleteTask(uint(id)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	h.sched.Unschedule(uint(id))
 
 	c.JSON(http.StatusOK, gin.H{"message": "task deleted"})
 }
@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"registry-sync/internal/db/models"
+	"registry-sync/internal/db/store"
+	"registry-sync/internal/scheduler"
+	"registry-sync/pkg/filter"
+	"registry-sync/pkg/webhook"
+)
+
+// maxHookPayload limits the size of inbound webhook payloads
+const maxHookPayload = 1 << 20
+
+// WebhookHandler handles inbound webhooks and their configuration
+type WebhookHandler struct {
+	store *store.Store
+	sched *scheduler.Scheduler
+}
+
+// NewWebhookHandler creates a new webhook handler. Pushed tags are synced
+// by executions started on sched.
+func NewWebhookHandler(store *store.Store, sched *scheduler.Scheduler) *WebhookHandler {
+	return &WebhookHandler{store: store, sched: sched}
+}
+
+// newToken generates a random webhook token
+func newToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// CreateWebhook creates a new webhook with a generated token
+// POST /api/v1/webhooks
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	// Enabled unless the request says otherwise, set here rather than as a
+	// column default so that a disabled webhook is stored as false
+	req := models.Webhook{Enabled: true}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := h.store.GetRegistry(req.Registry); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "registry not found"})
+		return
+	}
+
+	token, err := newToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	req.ID = 0
+	req.Token = token
+	req.LastTriggeredAt = nil
+
+	if err := h.store.CreateWebhook(&req); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, req)
+}
+
+// ListWebhooks lists all webhooks
+// GET /api/v1/webhooks
+func (h *WebhookHandler) ListWebhooks(c *gin.Context) {
+	hooks, err := h.store.ListWebhooks()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, hooks)
+}
+
+// UpdateWebhook updates the name, registry and state of a webhook, its token
+// is kept
+// PUT /api/v1/webhooks/:id
+func (h *WebhookHandler) UpdateWebhook(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid webhook ID"})
+		return
+	}
+
+	hook, err := h.store.GetWebhook(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "webhook not found"})
+		return
+	}
+
+	req := models.Webhook{Enabled: hook.Enabled}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := h.store.GetRegistry(req.Registry); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "registry not found"})
+		return
+	}
+
+	hook.Name = req.Name
+	hook.Registry = req.Registry
+	hook.Enabled = req.Enabled
+	hook.RegistryObj = models.Registry{}
+	if err := h.store.UpdateWebhook(hook); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, hook)
+}
+
+// RotateWebhookToken replaces the token of a webhook, the old one stops working
+// POST /api/v1/webhooks/:id/rotate
+func (h *WebhookHandler) RotateWebhookToken(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid webhook ID"})
+		return
+	}
+
+	hook, err := h.store.GetWebhook(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "webhook not found"})
+		return
+	}
+
+	token, err := newToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	hook.Token = token
+	hook.RegistryObj = models.Registry{}
+	if err := h.store.UpdateWebhook(hook); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, hook)
+}
+
+// DeleteWebhook deletes a webhook, revoking its token
+// DELETE /api/v1/webhooks/:id
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid webhook ID"})
+		return
+	}
+
+	if err := h.store.DeleteWebhook(uint(id)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "webhook deleted"})
+}
+
+// Receive accepts push events of Harbor, CNCF distribution and Docker Hub
+// webhooks and starts executions of the matching tasks for the pushed tags
+// POST /api/v1/hooks/:token
+func (h *WebhookHandler) Receive(c *gin.Context) {
+	hook, err := h.store.GetWebhookByToken(c.Param("token"))
+	if err != nil || !hook.Enabled {
+		c.JSON(http.StatusNotFound, gin.H{"error": "webhook not found"})
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxHookPayload))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	events, err := webhook.Parse(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for _, event := range events {
+		if _, _, ok := models.SplitRef(event.Ref()); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid pushed tag %q", event.Ref())})
+			return
+		}
+	}
+	h.store.SetWebhookTriggered(hook.ID, time.Now())
+
+	tasks, err := h.store.ListEnabledTasks()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	executions := []gin.H{}
+	for i := range tasks {
+		task := &tasks[i]
+		refs := matchPushes(task, hook.Registry, events)
+		if len(refs) == 0 {
+			continue
+		}
+
+		result := gin.H{"task_id": task.ID, "task_name": task.Name, "tags": refs}
+		execution, err := h.sched.ExecuteTags(context.Background(), task.ID, refs, fmt.Sprintf("Webhook %s 收到推送事件", hook.Name))
+		if err != nil {
+			result["error"] = err.Error()
+		} else {
+			result["execution_id"] = execution.ID
+			result["status"] = execution.Status
+		}
+		executions = append(executions, result)
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"events":     len(events),
+		"executions": executions,
+	})
+}
+
+// matchPushes returns the task's repo:tag references of the pushed tags that
+// are in the scope of a task: same source registry and repository, and tags
+// that pass its tag filter
+func matchPushes(task *models.SyncTask, registryID uint, events []webhook.PushEvent) []string {
+	if task.IsLayoutSource() || task.SourceRegistry != registryID {
+		return nil
+	}
+	tagFilter, err := filter.NewFilter(task.TagInclude, task.TagExclude, 0)
+	if err != nil {
+		return nil
+	}
+
+	var refs []string
+	for _, event := range events {
+		repoName, ok := strings.CutPrefix(event.Repository, task.SourceProject+"/")
+		if !ok || task.SourceRepo != "" && repoName != task.SourceRepo {
+			continue
+		}
+		if !tagFilter.Match(event.Tag) {
+			continue
+		}
+
+		ref := repoName + ":" + event.Tag
+		if !slices.Contains(refs, ref) {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
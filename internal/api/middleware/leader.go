@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"registry-sync/internal/election"
+)
+
+// LeaderOnly rejects requests that change state on replicas that do not lead
+// the scheduler, so tasks and executions are only changed where they run.
+// Reads are served by every replica. The response names the current leader.
+func LeaderOnly(elector *election.Elector) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+
+		status := elector.Status()
+		if !status.IsLeader {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"error":  "this replica is not the scheduler leader, send changes to the leader",
+				"leader": status.Leader,
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
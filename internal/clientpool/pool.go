@@ -0,0 +1,124 @@
+package clientpool
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"registry-sync/internal/db/models"
+	"registry-sync/pkg/config"
+	"registry-sync/pkg/ratelimit"
+	"registry-sync/pkg/registry"
+)
+
+// Pool keeps one registry client per registry, shared by all running
+// executions and API requests. Sharing the client shares its QPS limiter,
+// bandwidth limit, connection pool and bearer tokens, so limits configured
+// on a registry apply process-wide instead of per task.
+type Pool struct {
+	mu        sync.Mutex
+	clients   map[uint]*pooledClient      // registry_id -> client
+	bandwidth *ratelimit.BandwidthLimiter // applied to every client, nil if unlimited
+
+	breakerThreshold int
+	breakerCooldown  time.Duration
+	stallTimeout     time.Duration // applied to every client, 0 disables
+}
+
+// pooledClient is a client with the version of the registry it was built from
+type pooledClient struct {
+	client    *registry.Client
+	updatedAt time.Time // UpdatedAt of the registry row
+}
+
+// New creates an empty client pool
+func New() *Pool {
+	return &Pool{
+		clients:          make(map[uint]*pooledClient),
+		breakerThreshold: registry.DefaultBreakerThreshold,
+		breakerCooldown:  registry.DefaultBreakerCooldown,
+	}
+}
+
+// SetBandwidth sets a bandwidth limit shared by the blob transfers of all clients.
+// It must be called before the first client is created.
+func (p *Pool) SetBandwidth(limiter *ratelimit.BandwidthLimiter) {
+	p.bandwidth = limiter
+}
+
+// SetBreaker configures the circuit breaker of every client, see
+// registry.Client.SetBreaker. It must be called before the first client is created.
+func (p *Pool) SetBreaker(threshold int, cooldown time.Duration) {
+	p.breakerThreshold = threshold
+	p.breakerCooldown = cooldown
+}
+
+// SetStallTimeout aborts blob transfers of every client during which no data
+// flowed for the timeout, 0 disables. It must be called before the first
+// client is created.
+func (p *Pool) SetStallTimeout(timeout time.Duration) {
+	p.stallTimeout = timeout
+}
+
+// Get returns the shared client of a registry, creating it on first use.
+// The client is rebuilt when reg was updated after it was created, so
+// changes made through other processes, which Invalidate does not reach, are
+// picked up with the next row loaded from the database. Callers must not
+// modify the returned client; use WithBandwidth to get a copy with
+// additional limits.
+func (p *Pool) Get(reg *models.Registry) *registry.Client {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if pooled, ok := p.clients[reg.ID]; ok {
+		if !reg.UpdatedAt.After(pooled.updatedAt) {
+			return pooled.client
+		}
+		pooled.client.HTTPClient.CloseIdleConnections()
+	}
+
+	client := registry.NewClient(
+		config.NormalizeRegistryURL(reg.URL),
+		reg.Username,
+		reg.Password,
+		reg.Insecure,
+		reg.RateLimit,
+	)
+
+	schedule, err := ratelimit.ParseBandwidthSchedule(reg.Bandwidth)
+	if err != nil {
+		// Validated by the API; an invalid value stored earlier disables the limit
+		log.Printf("Ignoring invalid bandwidth limit of registry %s: %v", reg.Name, err)
+	}
+	client.Bandwidth = []*ratelimit.BandwidthLimiter{p.bandwidth, ratelimit.NewBandwidthLimiter(schedule)}
+	client.SetBreaker(p.breakerThreshold, p.breakerCooldown)
+	client.StallTimeout = p.stallTimeout
+
+	p.clients[reg.ID] = &pooledClient{client: client, updatedAt: reg.UpdatedAt}
+	return client
+}
+
+// Breaker returns the circuit breaker state of a registry's client.
+// Registries without a client yet report false.
+func (p *Pool) Breaker(id uint) (registry.BreakerState, bool) {
+	p.mu.Lock()
+	pooled, ok := p.clients[id]
+	p.mu.Unlock()
+
+	if !ok {
+		return registry.BreakerState{}, false
+	}
+	return pooled.client.Breaker(), true
+}
+
+// Invalidate drops the client of a registry after it was updated or deleted.
+// Executions already holding the old client keep using it until they finish.
+func (p *Pool) Invalidate(id uint) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if pooled, ok := p.clients[id]; ok {
+		pooled.client.HTTPClient.CloseIdleConnections()
+		delete(p.clients, id)
+	}
+}
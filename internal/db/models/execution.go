@@ -1,6 +1,8 @@
 package models
 
 import (
+	"database/sql/driver"
+	"encoding/json"
 	"time"
 )
 
@@ -13,27 +15,47 @@ const (
 	StatusSuccess  ExecutionStatus = "success"
 	StatusFailed   ExecutionStatus = "failed"
 	StatusCanceled ExecutionStatus = "canceled"
+
+	// StatusInterrupted marks executions that were still running when the
+	// server stopped; they can be resumed
+	StatusInterrupted ExecutionStatus = "interrupted"
+
+	// StatusTimedOut marks executions that ran longer than the timeout of
+	// their task and were stopped; they can be resumed
+	StatusTimedOut ExecutionStatus = "timed_out"
 )
 
 // Execution represents a task execution record
 type Execution struct {
-	ID           uint            `gorm:"primaryKey" json:"id"`
-	TaskID       uint            `gorm:"not null;index" json:"task_id"`
-	Status       ExecutionStatus `gorm:"type:varchar(20);default:'pending'" json:"status"`
-	StartTime    time.Time       `json:"start_time"`
-	EndTime      *time.Time      `json:"end_time"`
-	TotalBlobs   int             `json:"total_blobs"`
-	SyncedBlobs  int             `json:"synced_blobs"`
-	SkippedBlobs int             `json:"skipped_blobs"`
-	FailedBlobs  int             `json:"failed_blobs"`
-	TotalSize    int64           `json:"total_size"`
-	SyncedSize   int64           `json:"synced_size"`
-	ErrorMessage string          `gorm:"type:text" json:"error_message"`
-	CreatedAt    time.Time       `json:"created_at"`
-	UpdatedAt    time.Time       `json:"updated_at"`
+	ID             uint            `gorm:"primaryKey" json:"id"`
+	TaskID         uint            `gorm:"not null;index" json:"task_id"`
+	Status         ExecutionStatus `gorm:"type:varchar(20);default:'pending'" json:"status"`
+	StartTime      time.Time       `json:"start_time"`
+	EndTime        *time.Time      `json:"end_time"`
+	TotalBlobs     int             `json:"total_blobs"`
+	SyncedBlobs    int             `json:"synced_blobs"`
+	SkippedBlobs   int             `json:"skipped_blobs"`
+	FailedBlobs    int             `json:"failed_blobs"`
+	TotalSize      int64           `json:"total_size"`
+	SyncedSize     int64           `json:"synced_size"`
+	CacheHits      int             `json:"cache_hits"`   // Blobs served from the local blob cache
+	CacheMisses    int             `json:"cache_misses"` // Blobs downloaded into the local blob cache
+	ErrorMessage   string          `gorm:"type:text" json:"error_message"`
+	TargetResults  TargetResults   `gorm:"type:json" json:"target_results"` // Per-target outcome of fan-out tasks
+	OnlyTags       StringArray     `gorm:"type:json" json:"only_tags"`      // Restricts the run to these repo:tag references, e.g. tags postponed by a quota
+	NotBefore      *time.Time      `json:"not_before,omitempty"`            // A queued execution is not started before this time
+	CanceledBy     string          `json:"canceled_by,omitempty"`           // Who canceled the execution
+	CanceledAt     *time.Time      `json:"canceled_at,omitempty"`
+	RunID          uint            `gorm:"index" json:"run_id"`                               // Pipeline run, the ID of the execution that started it
+	TriggeredBy    uint            `json:"triggered_by,omitempty"`                            // Upstream execution whose completion started this one
+	Worker         string          `gorm:"not null;default:'';index" json:"worker,omitempty"` // Worker process that claimed the execution last, empty if run by the server
+	LeaseExpiresAt *time.Time      `json:"lease_expires_at,omitempty"`                        // End of the worker's claim, extended by its heartbeat
+	CancelRequest  string          `gorm:"not null;default:''" json:"-"`                      // Who asked the worker running the execution to cancel it
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
 
 	// Relations
-	Task SyncTask        `gorm:"foreignKey:TaskID" json:"task,omitempty"`
+	Task SyncTask       `gorm:"foreignKey:TaskID" json:"task,omitempty"`
 	Logs []ExecutionLog `gorm:"foreignKey:ExecutionID" json:"logs,omitempty"`
 }
 
@@ -42,6 +64,50 @@ func (Execution) TableName() string {
 	return "executions"
 }
 
+// TargetResult tracks the outcome of an execution for one target
+type TargetResult struct {
+	Registry     uint            `json:"registry"`
+	RegistryName string          `json:"registry_name"`
+	Project      string          `json:"project"`
+	Status       ExecutionStatus `json:"status"`
+	SyncedTags   int             `json:"synced_tags"`
+	FailedTags   int             `json:"failed_tags"`
+	SyncedBlobs  int             `json:"synced_blobs"`
+	SkippedBlobs int             `json:"skipped_blobs"`
+	FailedBlobs  int             `json:"failed_blobs"`
+	Error        string          `json:"error,omitempty"`
+}
+
+// TargetResults is a custom type for storing per-target results in database
+type TargetResults []TargetResult
+
+// Scan implements sql.Scanner
+func (a *TargetResults) Scan(value interface{}) error {
+	if value == nil {
+		*a = TargetResults{}
+		return nil
+	}
+
+	bytes, ok := value.([]byte)
+	if !ok {
+		if str, isStr := value.(string); isStr {
+			bytes = []byte(str)
+		} else {
+			return nil
+		}
+	}
+
+	return json.Unmarshal(bytes, a)
+}
+
+// Value implements driver.Valuer
+func (a TargetResults) Value() (driver.Value, error) {
+	if len(a) == 0 {
+		return "[]", nil
+	}
+	return json.Marshal(a)
+}
+
 // LogLevel represents log level
 type LogLevel string
 
@@ -81,7 +147,7 @@ func (e *Execution) IsRunning() bool {
 
 // IsComplete checks if execution is complete
 func (e *Execution) IsComplete() bool {
-	return e.Status == StatusSuccess || e.Status == StatusFailed || e.Status == StatusCanceled
+	return e.Status == StatusSuccess || e.Status == StatusFailed || e.Status == StatusCanceled || e.Status == StatusInterrupted || e.Status == StatusTimedOut
 }
 
 // Progress returns the progress percentage
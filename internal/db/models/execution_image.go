@@ -0,0 +1,116 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ImageStatus represents the status of one image (repo:tag) of an execution
+type ImageStatus string
+
+const (
+	ImagePending ImageStatus = "pending" // 尚未完成，恢复执行时重新同步
+	ImageSuccess ImageStatus = "success" // 已同步到所有目标
+	ImageFailed  ImageStatus = "failed"  // 至少一个目标同步失败
+	ImageSkipped ImageStatus = "skipped" // 未同步，如拉取配额不足
+)
+
+// ExecutionImage is a unit of work of an execution: one tag of a source
+// repository. The images of an execution are recorded once its tags are
+// known and checkpointed with their outcome, so an interrupted execution can
+// be resumed with exactly the remaining tags and failed tags can be retried.
+// Once synced, an image also records where it landed and with what digest.
+type ExecutionImage struct {
+	ID               uint         `gorm:"primaryKey" json:"id"`
+	ExecutionID      uint         `gorm:"not null;index" json:"execution_id"`
+	Repository       string       `gorm:"not null;index" json:"repository"` // 源仓库名（不含项目）
+	Tag              string       `gorm:"not null" json:"tag"`
+	Status           ImageStatus  `gorm:"type:varchar(20);default:'pending';index" json:"status"`
+	Error            string       `gorm:"type:text" json:"error,omitempty"`
+	ErrorCode        string       `gorm:"type:varchar(40)" json:"error_code,omitempty"` // OCI 错误码或 HTTP_<状态码> 等
+	SourceRef        string       `json:"source_ref"`                                   // 如 harbor.example.com/library/nginx:1.25
+	SourceDigest     string       `gorm:"index" json:"source_digest"`
+	BytesTransferred int64        `json:"bytes_transferred"` // 所有目标上传的字节数之和
+	BlobsCopied      int          `json:"blobs_copied"`
+	BlobsSkipped     int          `json:"blobs_skipped"` // 目标中已存在
+	BlobsMounted     int          `json:"blobs_mounted"` // 从目标的其他仓库挂载
+	DurationMs       int64        `json:"duration_ms"`
+	Targets          ImageTargets `gorm:"type:json" json:"targets"` // 每个目标的结果
+	CreatedAt        time.Time    `json:"created_at"`
+	UpdatedAt        time.Time    `json:"updated_at"`
+}
+
+// TableName specifies the table name
+func (ExecutionImage) TableName() string {
+	return "execution_images"
+}
+
+// Ref returns the repo:tag reference of the image
+func (i *ExecutionImage) Ref() string {
+	return i.Repository + ":" + i.Tag
+}
+
+// tagPattern matches valid tags, see the OCI distribution spec
+var tagPattern = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9._-]{0,127}$`)
+
+// SplitRef splits a repo:tag reference. ok is false if the reference has no
+// repository or no valid tag, repositories contain no ':'.
+func SplitRef(ref string) (repo, tag string, ok bool) {
+	i := strings.LastIndex(ref, ":")
+	if i <= 0 {
+		return "", "", false
+	}
+	repo, tag = ref[:i], ref[i+1:]
+	if strings.Trim(repo, "/") != repo || strings.ContainsAny(repo, ":@") || !tagPattern.MatchString(tag) {
+		return "", "", false
+	}
+	return repo, tag, true
+}
+
+// ImageTarget is the outcome of an image for one target
+type ImageTarget struct {
+	Registry         uint        `json:"registry"`
+	RegistryName     string      `json:"registry_name"`
+	Ref              string      `json:"ref"` // 目标中的完整引用
+	Digest           string      `json:"digest,omitempty"`
+	Status           ImageStatus `json:"status"`
+	BytesTransferred int64       `json:"bytes_transferred"`
+	BlobsCopied      int         `json:"blobs_copied"`
+	BlobsSkipped     int         `json:"blobs_skipped"`
+	BlobsMounted     int         `json:"blobs_mounted"`
+	ErrorCode        string      `json:"error_code,omitempty"`
+	Error            string      `json:"error,omitempty"`
+}
+
+// ImageTargets is a custom type for storing per-target image results in database
+type ImageTargets []ImageTarget
+
+// Scan implements sql.Scanner
+func (a *ImageTargets) Scan(value interface{}) error {
+	if value == nil {
+		*a = ImageTargets{}
+		return nil
+	}
+
+	bytes, ok := value.([]byte)
+	if !ok {
+		if str, isStr := value.(string); isStr {
+			bytes = []byte(str)
+		} else {
+			return nil
+		}
+	}
+
+	return json.Unmarshal(bytes, a)
+}
+
+// Value implements driver.Valuer
+func (a ImageTargets) Value() (driver.Value, error) {
+	if len(a) == 0 {
+		return "[]", nil
+	}
+	return json.Marshal(a)
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Lease is a named lock held by one server replica at a time, e.g. the
+// leadership of the scheduler. A holder keeps it by renewing it before it
+// expires; an expired lease can be taken by any replica.
+type Lease struct {
+	Name        string    `gorm:"primaryKey" json:"name"`
+	Holder      string    `json:"holder"`      // 持有者标识，空=未被持有
+	AcquiredAt  time.Time `json:"acquired_at"` // 当前持有者获得租约的时间
+	RenewedAt   time.Time `json:"renewed_at"`
+	ExpiresAt   time.Time `gorm:"index" json:"expires_at"`
+	Transitions int       `json:"transitions"` // 持有者变更次数
+}
+
+// TableName specifies the table name
+func (Lease) TableName() string {
+	return "leases"
+}
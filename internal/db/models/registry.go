@@ -15,6 +15,7 @@ type Registry struct {
 	Password  string         `json:"password,omitempty"` // Accept password input but should be cleared before response
 	Insecure  bool           `json:"insecure"`
 	RateLimit int            `json:"rate_limit"` // QPS limit
+	Bandwidth string         `json:"bandwidth"`  // Byte rate limit for blob transfers, e.g. "20MB" or "08:00-20:00=20MB"
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
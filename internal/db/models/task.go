@@ -34,38 +34,235 @@ func (a StringArray) Value() (driver.Value, error) {
 	return json.Marshal(a)
 }
 
+// SyncTarget is one destination of a task
+type SyncTarget struct {
+	Registry uint   `json:"registry"`
+	Project  string `json:"project"`
+	Repo     string `json:"repo"` // 可选：空=使用源仓库名
+}
+
+// RepoPath 返回该目标的完整仓库路径
+func (t SyncTarget) RepoPath(sourceRepo string) string {
+	targetRepo := sourceRepo
+	if t.Repo != "" {
+		targetRepo = t.Repo
+	}
+	return t.Project + "/" + targetRepo
+}
+
+// SyncTargets is a custom type for storing task targets in database
+type SyncTargets []SyncTarget
+
+// Scan implements sql.Scanner
+func (a *SyncTargets) Scan(value interface{}) error {
+	if value == nil {
+		*a = SyncTargets{}
+		return nil
+	}
+
+	bytes, ok := value.([]byte)
+	if !ok {
+		if str, isStr := value.(string); isStr {
+			bytes = []byte(str)
+		} else {
+			return nil
+		}
+	}
+
+	return json.Unmarshal(bytes, a)
+}
+
+// Value implements driver.Valuer
+func (a SyncTargets) Value() (driver.Value, error) {
+	if len(a) == 0 {
+		return "[]", nil
+	}
+	return json.Marshal(a)
+}
+
+// RetryPolicy overrides the retry settings of an operation, zero values use the defaults
+type RetryPolicy struct {
+	MaxAttempts     int `json:"max_attempts,omitempty"`
+	InitialInterval int `json:"initial_interval,omitempty"` // 秒
+	MaxInterval     int `json:"max_interval,omitempty"`     // 秒
+}
+
+// RetrySettings is the retry configuration of a task. The embedded policy
+// applies to all operations, the per-operation policies override it.
+type RetrySettings struct {
+	RetryPolicy
+	Budget       int         `json:"budget,omitempty"` // 每次执行最多重试次数，0=不限
+	Manifest     RetryPolicy `json:"manifest"`
+	BlobDownload RetryPolicy `json:"blob_download"`
+	BlobUpload   RetryPolicy `json:"blob_upload"`
+	Catalog      RetryPolicy `json:"catalog"`
+}
+
+// Scan implements sql.Scanner
+func (r *RetrySettings) Scan(value interface{}) error {
+	if value == nil {
+		*r = RetrySettings{}
+		return nil
+	}
+
+	bytes, ok := value.([]byte)
+	if !ok {
+		if str, isStr := value.(string); isStr {
+			bytes = []byte(str)
+		} else {
+			return nil
+		}
+	}
+
+	return json.Unmarshal(bytes, r)
+}
+
+// Value implements driver.Valuer
+func (r RetrySettings) Value() (driver.Value, error) {
+	return json.Marshal(r)
+}
+
+// TaskDependency makes a task run after an execution of another task has
+// finished in the same pipeline run
+type TaskDependency struct {
+	TaskID    uint   `json:"task_id"`
+	Condition string `json:"condition"` // "success" 或 "always"（成功、失败或超时，取消时不触发）
+}
+
+// Satisfied reports whether an execution of the dependency with the given
+// status allows the dependent task to run
+func (d TaskDependency) Satisfied(status ExecutionStatus) bool {
+	switch status {
+	case StatusSuccess:
+		return true
+	case StatusFailed, StatusTimedOut:
+		return d.Condition == DependAlways
+	}
+	return false
+}
+
+// TaskDependencies is a custom type for storing task dependencies in database
+type TaskDependencies []TaskDependency
+
+// Scan implements sql.Scanner
+func (a *TaskDependencies) Scan(value interface{}) error {
+	if value == nil {
+		*a = TaskDependencies{}
+		return nil
+	}
+
+	bytes, ok := value.([]byte)
+	if !ok {
+		if str, isStr := value.(string); isStr {
+			bytes = []byte(str)
+		} else {
+			return nil
+		}
+	}
+
+	return json.Unmarshal(bytes, a)
+}
+
+// Value implements driver.Valuer
+func (a TaskDependencies) Value() (driver.Value, error) {
+	if len(a) == 0 {
+		return "[]", nil
+	}
+	return json.Marshal(a)
+}
+
 // SyncTask represents a synchronization task
 type SyncTask struct {
-	ID              uint           `gorm:"primaryKey" json:"id"`
-	Name            string         `gorm:"uniqueIndex;not null" json:"name"`
-	Description     string         `json:"description"`
-	SourceRegistry  uint           `gorm:"not null" json:"source_registry"`
-	SourceProject   string         `gorm:"not null" json:"source_project"`          // 新增：源项目名
-	SourceRepo      string         `json:"source_repo"`                             // 改为可选：空=同步整个项目
-	TargetRegistry  uint           `gorm:"not null" json:"target_registry"`
-	TargetProject   string         `gorm:"not null" json:"target_project"`          // 新增：目标项目名
-	TargetRepo      string         `json:"target_repo"`                             // 改为可选：空=使用源仓库名
-	TagInclude      StringArray    `gorm:"type:json" json:"tag_include"`
-	TagExclude      StringArray    `gorm:"type:json" json:"tag_exclude"`
-	TagLatest       int            `json:"tag_latest"`
-	Architectures   StringArray    `gorm:"type:json" json:"architectures"`
-	Enabled         bool           `gorm:"default:true" json:"enabled"`
-	CronExpression  string         `json:"cron_expression"`
+	ID              uint             `gorm:"primaryKey" json:"id"`
+	Name            string           `gorm:"uniqueIndex;not null" json:"name"`
+	Description     string           `json:"description"`
+	SourceType      string           `gorm:"default:'registry'" json:"source_type"` // "registry" or "oci-layout"
+	SourcePath      string           `json:"source_path"`                           // oci-layout: bundle path on the server
+	SourceMapping   string           `json:"source_mapping"`                        // oci-layout: optional mapping file on the server
+	SourceRegistry  uint             `gorm:"not null" json:"source_registry"`
+	SourceProject   string           `gorm:"not null" json:"source_project"` // 新增：源项目名
+	SourceRepo      string           `json:"source_repo"`                    // 改为可选：空=同步整个项目
+	TargetRegistry  uint             `gorm:"not null" json:"target_registry"`
+	TargetProject   string           `gorm:"not null" json:"target_project"` // 新增：目标项目名
+	TargetRepo      string           `json:"target_repo"`                    // 改为可选：空=使用源仓库名
+	Targets         SyncTargets      `gorm:"type:json" json:"targets"`       // 多目标（fan-out）：非空时取代上面的单个目标
+	TagInclude      StringArray      `gorm:"type:json" json:"tag_include"`
+	TagExclude      StringArray      `gorm:"type:json" json:"tag_exclude"`
+	TagLatest       int              `json:"tag_latest"`
+	Architectures   StringArray      `gorm:"type:json" json:"architectures"`
+	Bandwidth       string           `json:"bandwidth"`                          // 任务带宽限制（源下载；导入任务为上传），格式同 Registry
+	QuotaThreshold  int              `json:"quota_threshold"`                    // 源 Registry 剩余拉取配额低于该值时停止或推迟，0=不检查
+	QuotaAction     string           `gorm:"default:'stop'" json:"quota_action"` // "stop" 或 "postpone"
+	Retry           RetrySettings    `gorm:"type:json" json:"retry"`             // 重试策略，未设置的项使用服务端默认值
+	Timeout         int              `json:"timeout"`                            // 最长执行时间（秒），超时后终止执行，0=使用服务端默认值
+	Enabled         bool             `gorm:"default:true" json:"enabled"`
+	CronExpression  string           `json:"cron_expression"`
+	Timezone        string           `json:"timezone"`                             // cron 表达式的时区（IANA 名称，如 Asia/Shanghai），空=服务器时区
+	CatchUp         string           `gorm:"default:'skip'" json:"catch_up"`       // 服务停止期间错过定时运行："skip" 或 "run-once"（启动时补跑一次）
+	LastScheduledAt *time.Time       `json:"last_scheduled_at,omitempty"`          // 最近一次定时触发（或启用定时）的时间，用于判断是否错过运行
+	OverlapPolicy   string           `gorm:"default:'skip'" json:"overlap_policy"` // 定时触发时上次执行仍在运行："skip"、"queue" 或 "cancel-previous"
+	DependsOn       TaskDependencies `gorm:"type:json" json:"depends_on"`          // 上游任务：任一上游执行结束且全部上游满足条件时自动运行
 
 	// Notification settings
 	SendNotification       bool   `gorm:"default:false" json:"send_notification"`
 	NotificationCondition  string `gorm:"default:'all'" json:"notification_condition"` // "all" or "failed"
 	NotificationChannelIDs string `gorm:"type:json" json:"notification_channel_ids"`   // JSON array of channel IDs
 
-	CreatedAt       time.Time      `json:"created_at"`
-	UpdatedAt       time.Time      `json:"updated_at"`
-	DeletedAt       gorm.DeletedAt `gorm:"index" json:"-"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 
 	// Relations
 	SourceRegistryObj Registry `gorm:"foreignKey:SourceRegistry" json:"source_registry_obj,omitempty"`
 	TargetRegistryObj Registry `gorm:"foreignKey:TargetRegistry" json:"target_registry_obj,omitempty"`
 }
 
+// Task source types
+const (
+	SourceTypeRegistry  = "registry"
+	SourceTypeOCILayout = "oci-layout"
+)
+
+// Quota actions
+const (
+	QuotaActionStop     = "stop"     // 停止同步，剩余 tag 留给下次运行
+	QuotaActionPostpone = "postpone" // 配额窗口过后自动同步剩余 tag
+)
+
+// Overlap policies, applied when a cron trigger fires while the task is running
+const (
+	OverlapSkip           = "skip"            // 跳过本次触发
+	OverlapQueue          = "queue"           // 排队，上次执行结束后运行
+	OverlapCancelPrevious = "cancel-previous" // 取消上次执行，然后运行
+)
+
+// Catch-up policies, applied on startup when a scheduled run was missed
+const (
+	CatchUpSkip    = "skip"     // 忽略错过的运行
+	CatchUpRunOnce = "run-once" // 启动时补跑一次，无论错过多少次
+)
+
+// Dependency conditions
+const (
+	DependOnSuccess = "success" // 上游执行成功后运行
+	DependAlways    = "always"  // 上游执行成功或失败后都运行
+)
+
+// DependsOnTask reports whether the task depends on another task
+func (t *SyncTask) DependsOnTask(taskID uint) (TaskDependency, bool) {
+	for _, dep := range t.DependsOn {
+		if dep.TaskID == taskID {
+			return dep, true
+		}
+	}
+	return TaskDependency{}, false
+}
+
+// IsLayoutSource reports whether the task imports from an OCI layout bundle
+func (t *SyncTask) IsLayoutSource() bool {
+	return t.SourceType == SourceTypeOCILayout
+}
+
 // GetSourceRepoPath 返回完整的源仓库路径
 func (t *SyncTask) GetSourceRepoPath() string {
 	if t.SourceRepo == "" {
@@ -83,6 +280,14 @@ func (t *SyncTask) GetTargetRepoPath(sourceRepo string) string {
 	return t.TargetProject + "/" + targetRepo
 }
 
+// GetTargets 返回任务的所有目标；未配置多目标时返回单个目标
+func (t *SyncTask) GetTargets() []SyncTarget {
+	if len(t.Targets) > 0 {
+		return t.Targets
+	}
+	return []SyncTarget{{Registry: t.TargetRegistry, Project: t.TargetProject, Repo: t.TargetRepo}}
+}
+
 // TableName specifies the table name
 func (SyncTask) TableName() string {
 	return "sync_tasks"
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Webhook is an inbound endpoint that a registry calls when images are
+// pushed. Pushed tags are synced by the tasks whose source matches them.
+type Webhook struct {
+	ID              uint           `gorm:"primaryKey" json:"id"`
+	Name            string         `gorm:"uniqueIndex;not null" json:"name"`
+	Token           string         `gorm:"uniqueIndex;not null" json:"token"` // 回调地址 /api/v1/hooks/:token 中的令牌，可重新生成
+	Registry        uint           `gorm:"not null" json:"registry"`          // 发送事件的源 Registry，只匹配以它为源的任务
+	Enabled         bool           `json:"enabled"`                           // 创建时省略则为启用
+	LastTriggeredAt *time.Time     `json:"last_triggered_at,omitempty"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"-"`
+
+	// Relations
+	RegistryObj Registry `gorm:"foreignKey:Registry" json:"registry_obj,omitempty"`
+}
+
+// TableName specifies the table name
+func (Webhook) TableName() string {
+	return "webhooks"
+}
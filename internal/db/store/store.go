@@ -2,9 +2,11 @@ package store
 
 import (
 	"fmt"
+	"time"
 
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 
 	"registry-sync/internal/db/models"
@@ -30,7 +32,10 @@ func NewStore(dbPath string) (*Store, error) {
 		&models.SyncTask{},
 		&models.Execution{},
 		&models.ExecutionLog{},
+		&models.ExecutionImage{},
 		&models.NotificationChannel{},
+		&models.Webhook{},
+		&models.Lease{},
 	); err != nil {
 		return nil, fmt.Errorf("failed to migrate database: %w", err)
 	}
@@ -130,13 +135,27 @@ func (s *Store) UpdateTask(task *models.SyncTask) error {
 	return s.db.Save(task).Error
 }
 
+// SetTaskLastScheduled records when a task was last triggered by its schedule
+func (s *Store) SetTaskLastScheduled(id uint, at time.Time) error {
+	return s.db.Model(&models.SyncTask{}).Where("id = ?", id).UpdateColumn("last_scheduled_at", at).Error
+}
+
 func (s *Store) DeleteTask(id uint) error {
 	return s.db.Delete(&models.SyncTask{}, id).Error
 }
 
 // Execution operations
+// CreateExecution creates an execution. Executions not triggered by another
+// one start a new pipeline run.
 func (s *Store) CreateExecution(exec *models.Execution) error {
-	return s.db.Create(exec).Error
+	if err := s.db.Create(exec).Error; err != nil {
+		return err
+	}
+	if exec.RunID == 0 {
+		exec.RunID = exec.ID
+		return s.db.Model(exec).UpdateColumn("run_id", exec.ID).Error
+	}
+	return nil
 }
 
 func (s *Store) GetExecution(id uint) (*models.Execution, error) {
@@ -171,13 +190,29 @@ func (s *Store) ListExecutionsByTask(taskID uint, limit int) ([]models.Execution
 	return execs, nil
 }
 
+// ListExecutionsByRun returns the executions of a pipeline run in the order
+// they were created
+func (s *Store) ListExecutionsByRun(runID uint) ([]models.Execution, error) {
+	var execs []models.Execution
+	if err := s.db.Preload("Task").Where("run_id = ? OR (run_id = 0 AND id = ?)", runID, runID).Order("id ASC").Find(&execs).Error; err != nil {
+		return nil, err
+	}
+	return execs, nil
+}
+
+// UpdateExecution saves an execution. The worker lease and cancel requests
+// are left alone, they are only changed by the worker operations below.
+// Executions claimed by a worker are only saved while that worker still
+// holds them, so a worker whose lease expired can not overwrite the
+// execution after it was re-queued.
 func (s *Store) UpdateExecution(exec *models.Execution) error {
-	return s.db.Save(exec).Error
+	return s.db.Select("*").Omit("lease_expires_at", "cancel_request").Where("worker = ?", exec.Worker).Save(exec).Error
 }
 
 func (s *Store) DeleteExecution(id uint) error {
-	// Delete logs first
+	// Delete logs and images first
 	s.db.Where("execution_id = ?", id).Delete(&models.ExecutionLog{})
+	s.db.Where("execution_id = ?", id).Delete(&models.ExecutionImage{})
 	return s.db.Delete(&models.Execution{}, id).Error
 }
 
@@ -198,6 +233,144 @@ func (s *Store) ListExecutionLogs(executionID uint, limit int) ([]models.Executi
 	return logs, nil
 }
 
+// InterruptRunningExecutions marks executions left running by a previous
+// server process as interrupted and returns them. Executions run by workers
+// are not affected, they are re-queued when their lease expires.
+func (s *Store) InterruptRunningExecutions() ([]models.Execution, error) {
+	var execs []models.Execution
+	if err := s.db.Where("status = ? AND worker = ''", models.StatusRunning).Find(&execs).Error; err != nil {
+		return nil, err
+	}
+	if len(execs) == 0 {
+		return nil, nil
+	}
+
+	now := time.Now()
+	for i := range execs {
+		execs[i].Status = models.StatusInterrupted
+		execs[i].EndTime = &now
+		if err := s.db.Save(&execs[i]).Error; err != nil {
+			return nil, err
+		}
+	}
+	return execs, nil
+}
+
+// ExecutionImage operations
+func (s *Store) CreateExecutionImages(images []models.ExecutionImage) error {
+	if len(images) == 0 {
+		return nil
+	}
+	return s.db.CreateInBatches(images, 500).Error
+}
+
+func (s *Store) ListExecutionImages(executionID uint) ([]models.ExecutionImage, error) {
+	var images []models.ExecutionImage
+	if err := s.db.Where("execution_id = ?", executionID).Order("id ASC").Find(&images).Error; err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+// SetExecutionImageStatus checkpoints the outcome of one image of an execution
+func (s *Store) SetExecutionImageStatus(executionID uint, repository, tag string, status models.ImageStatus, errMsg string) error {
+	return s.db.Model(&models.ExecutionImage{}).
+		Where("execution_id = ? AND repository = ? AND tag = ?", executionID, repository, tag).
+		Updates(map[string]interface{}{"status": status, "error": errMsg}).Error
+}
+
+// SaveExecutionImageResult records the result of one image of an execution,
+// identified by its execution, repository and tag
+func (s *Store) SaveExecutionImageResult(image *models.ExecutionImage) error {
+	return s.db.Model(&models.ExecutionImage{}).
+		Where("execution_id = ? AND repository = ? AND tag = ?", image.ExecutionID, image.Repository, image.Tag).
+		Select("status", "error", "error_code", "source_ref", "source_digest", "bytes_transferred",
+			"blobs_copied", "blobs_skipped", "blobs_mounted", "duration_ms", "targets").
+		Updates(image).Error
+}
+
+// ImageFilter selects images of an execution; zero fields match everything
+type ImageFilter struct {
+	Status     models.ImageStatus
+	Repository string
+	Tag        string
+	ErrorCode  string
+	Digest     string // Source digest
+	Page       int    // 1-based
+	PageSize   int
+}
+
+// QueryExecutionImages returns one page of the images of an execution
+// matching the filter and the total number of matching images
+func (s *Store) QueryExecutionImages(executionID uint, filter ImageFilter) ([]models.ExecutionImage, int64, error) {
+	query := s.db.Model(&models.ExecutionImage{}).Where("execution_id = ?", executionID)
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Repository != "" {
+		query = query.Where("repository = ?", filter.Repository)
+	}
+	if filter.Tag != "" {
+		query = query.Where("tag = ?", filter.Tag)
+	}
+	if filter.ErrorCode != "" {
+		query = query.Where("error_code = ?", filter.ErrorCode)
+	}
+	if filter.Digest != "" {
+		query = query.Where("source_digest = ?", filter.Digest)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var images []models.ExecutionImage
+	if filter.PageSize > 0 {
+		query = query.Limit(filter.PageSize).Offset((filter.Page - 1) * filter.PageSize)
+	}
+	if err := query.Order("id ASC").Find(&images).Error; err != nil {
+		return nil, 0, err
+	}
+	return images, total, nil
+}
+
+// ListExecutionImagesByStatus returns the images of an execution with the given status
+func (s *Store) ListExecutionImagesByStatus(executionID uint, status models.ImageStatus) ([]models.ExecutionImage, error) {
+	var images []models.ExecutionImage
+	if err := s.db.Where("execution_id = ? AND status = ?", executionID, status).Order("id ASC").Find(&images).Error; err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+// ListPendingExecutions returns the queued executions, oldest first
+func (s *Store) ListPendingExecutions() ([]models.Execution, error) {
+	var execs []models.Execution
+	if err := s.db.Where("status = ?", models.StatusPending).Order("id ASC").Find(&execs).Error; err != nil {
+		return nil, err
+	}
+	return execs, nil
+}
+
+// GetPendingExecution returns the queued execution of a task
+func (s *Store) GetPendingExecution(taskID uint) (*models.Execution, error) {
+	var exec models.Execution
+	if err := s.db.Where("task_id = ? AND status = ?", taskID, models.StatusPending).First(&exec).Error; err != nil {
+		return nil, err
+	}
+	return &exec, nil
+}
+
+// SetPendingTags replaces the repo:tag references of a queued execution that
+// no worker has claimed and reports whether it did
+func (s *Store) SetPendingTags(id uint, tags models.StringArray) (bool, error) {
+	result := s.db.Model(&models.Execution{}).
+		Where("id = ? AND status = ? AND worker = ''", id, models.StatusPending).
+		Update("only_tags", tags)
+	return result.RowsAffected == 1, result.Error
+}
+
 // GetRunningExecution returns the current running execution for a task
 func (s *Store) GetRunningExecution(taskID uint) (*models.Execution, error) {
 	var exec models.Execution
@@ -207,6 +380,173 @@ func (s *Store) GetRunningExecution(taskID uint) (*models.Execution, error) {
 	return &exec, nil
 }
 
+// Worker operations
+
+// ClaimExecution starts the oldest due queued execution whose task is not
+// running anywhere on behalf of worker, leased for ttl, and returns it. It
+// returns nil if there is none. The claim is a single conditional update, so
+// an execution is claimed by one worker only.
+func (s *Store) ClaimExecution(worker string, ttl time.Duration) (*models.Execution, error) {
+	var candidates []models.Execution
+	err := s.db.Select("id").
+		Where("status = ?", models.StatusPending).
+		Where("not_before IS NULL OR not_before <= ?", time.Now()).
+		Where("NOT EXISTS (SELECT 1 FROM executions running WHERE running.task_id = executions.task_id AND running.status = ?)", models.StatusRunning).
+		Order("id ASC").Limit(10).Find(&candidates).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, candidate := range candidates {
+		now := time.Now()
+		result := s.db.Model(&models.Execution{}).
+			Where("id = ? AND status = ?", candidate.ID, models.StatusPending).
+			Where("NOT EXISTS (SELECT 1 FROM executions running WHERE running.task_id = executions.task_id AND running.status = ?)", models.StatusRunning).
+			Updates(map[string]interface{}{
+				"status":           models.StatusRunning,
+				"worker":           worker,
+				"lease_expires_at": now.Add(ttl),
+				"cancel_request":   "",
+				"start_time":       now,
+			})
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 1 {
+			var exec models.Execution
+			if err := s.db.First(&exec, candidate.ID).Error; err != nil {
+				return nil, err
+			}
+			return &exec, nil
+		}
+	}
+	return nil, nil
+}
+
+// RenewExecutionLease extends the lease of worker on a running execution.
+// It returns false if the worker no longer holds the execution.
+func (s *Store) RenewExecutionLease(id uint, worker string, ttl time.Duration) (bool, error) {
+	result := s.db.Model(&models.Execution{}).
+		Where("id = ? AND worker = ? AND status = ?", id, worker, models.StatusRunning).
+		UpdateColumn("lease_expires_at", time.Now().Add(ttl))
+	return result.RowsAffected == 1, result.Error
+}
+
+// RequeueExecution puts a running execution of worker back into the queue,
+// so any worker can continue it
+func (s *Store) RequeueExecution(id uint, worker string) error {
+	return s.db.Model(&models.Execution{}).
+		Where("id = ? AND worker = ? AND status = ?", id, worker, models.StatusRunning).
+		Updates(requeueColumns()).Error
+}
+
+// RequeueExpiredExecutions puts running executions whose worker lease
+// expired back into the queue and returns them
+func (s *Store) RequeueExpiredExecutions() ([]models.Execution, error) {
+	var execs []models.Execution
+	if err := s.db.Where("status = ? AND worker <> '' AND lease_expires_at < ?", models.StatusRunning, time.Now()).Find(&execs).Error; err != nil {
+		return nil, err
+	}
+
+	var requeued []models.Execution
+	for _, exec := range execs {
+		// The worker may have renewed the lease in the meantime
+		result := s.db.Model(&models.Execution{}).
+			Where("id = ? AND worker = ? AND status = ? AND lease_expires_at < ?", exec.ID, exec.Worker, models.StatusRunning, time.Now()).
+			Updates(requeueColumns())
+		if result.Error != nil {
+			return requeued, result.Error
+		}
+		if result.RowsAffected == 1 {
+			requeued = append(requeued, exec)
+		}
+	}
+	return requeued, nil
+}
+
+// RequeueEndedExecution puts an execution that ended with status back into
+// the queue, releasing the worker that ran it, and reports whether it did.
+// It fails if the execution was resumed concurrently.
+func (s *Store) RequeueEndedExecution(id uint, status models.ExecutionStatus) (bool, error) {
+	columns := requeueColumns()
+	columns["end_time"] = nil
+	columns["cancel_request"] = ""
+	result := s.db.Model(&models.Execution{}).
+		Where("id = ? AND status = ?", id, status).
+		Updates(columns)
+	return result.RowsAffected == 1, result.Error
+}
+
+// requeueColumns returns the changes that put a running execution back into
+// the queue. Failed blobs are retried, so they are counted again.
+func requeueColumns() map[string]interface{} {
+	return map[string]interface{}{
+		"status":           models.StatusPending,
+		"worker":           "",
+		"lease_expires_at": nil,
+		"failed_blobs":     0,
+		"error_message":    "",
+	}
+}
+
+// CancelPendingExecution cancels a queued execution that no worker has
+// claimed and reports whether it did. by is recorded as who canceled it.
+func (s *Store) CancelPendingExecution(id uint, by string) (bool, error) {
+	now := time.Now()
+	result := s.db.Model(&models.Execution{}).
+		Where("id = ? AND status = ? AND worker = ''", id, models.StatusPending).
+		Updates(map[string]interface{}{
+			"status":      models.StatusCanceled,
+			"end_time":    now,
+			"canceled_by": by,
+			"canceled_at": now,
+		})
+	return result.RowsAffected == 1, result.Error
+}
+
+// RequestCancel asks the workers running the executions of a task, or a
+// single execution if executionID is set, to cancel them and returns how
+// many were asked
+func (s *Store) RequestCancel(taskID, executionID uint, by string) (int64, error) {
+	query := s.db.Model(&models.Execution{}).Where("status = ? AND worker <> '' AND cancel_request = ''", models.StatusRunning)
+	if executionID != 0 {
+		query = query.Where("id = ?", executionID)
+	} else {
+		query = query.Where("task_id = ?", taskID)
+	}
+	result := query.UpdateColumn("cancel_request", by)
+	return result.RowsAffected, result.Error
+}
+
+// ListCancelRequests returns the running executions of worker that were
+// asked to cancel
+func (s *Store) ListCancelRequests(worker string) ([]models.Execution, error) {
+	var execs []models.Execution
+	if err := s.db.Where("worker = ? AND status = ? AND cancel_request <> ''", worker, models.StatusRunning).Find(&execs).Error; err != nil {
+		return nil, err
+	}
+	return execs, nil
+}
+
+// ListWorkerExecutions returns the executions that workers are running
+func (s *Store) ListWorkerExecutions() ([]models.Execution, error) {
+	var execs []models.Execution
+	if err := s.db.Where("status = ? AND worker <> ''", models.StatusRunning).Find(&execs).Error; err != nil {
+		return nil, err
+	}
+	return execs, nil
+}
+
+// ListExecutionLogsSince returns the logs of an execution after the log with
+// the given ID, oldest first
+func (s *Store) ListExecutionLogsSince(executionID, afterID uint) ([]models.ExecutionLog, error) {
+	var logs []models.ExecutionLog
+	if err := s.db.Where("execution_id = ? AND id > ?", executionID, afterID).Order("id ASC").Find(&logs).Error; err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
+
 // Statistics
 func (s *Store) GetStats() (map[string]interface{}, error) {
 	stats := make(map[string]interface{})
@@ -227,6 +567,10 @@ func (s *Store) GetStats() (map[string]interface{}, error) {
 	s.db.Model(&models.Execution{}).Where("status = ?", models.StatusRunning).Count(&runningExecutions)
 	stats["running_executions"] = runningExecutions
 
+	var pendingExecutions int64
+	s.db.Model(&models.Execution{}).Where("status = ?", models.StatusPending).Count(&pendingExecutions)
+	stats["pending_executions"] = pendingExecutions
+
 	var successExecutions int64
 	s.db.Model(&models.Execution{}).Where("status = ?", models.StatusSuccess).Count(&successExecutions)
 	stats["success_executions"] = successExecutions
@@ -270,3 +614,102 @@ func (s *Store) UpdateNotificationChannel(channel *models.NotificationChannel) e
 func (s *Store) DeleteNotificationChannel(id uint) error {
 	return s.db.Delete(&models.NotificationChannel{}, id).Error
 }
+
+// Webhook operations
+func (s *Store) CreateWebhook(hook *models.Webhook) error {
+	return s.db.Create(hook).Error
+}
+
+func (s *Store) GetWebhook(id uint) (*models.Webhook, error) {
+	var hook models.Webhook
+	if err := s.db.Preload("RegistryObj").First(&hook, id).Error; err != nil {
+		return nil, err
+	}
+	return &hook, nil
+}
+
+// GetWebhookByToken returns the webhook of a token, deleted webhooks are
+// not found
+func (s *Store) GetWebhookByToken(token string) (*models.Webhook, error) {
+	var hook models.Webhook
+	if err := s.db.Where("token = ?", token).First(&hook).Error; err != nil {
+		return nil, err
+	}
+	return &hook, nil
+}
+
+func (s *Store) ListWebhooks() ([]models.Webhook, error) {
+	var hooks []models.Webhook
+	if err := s.db.Preload("RegistryObj").Find(&hooks).Error; err != nil {
+		return nil, err
+	}
+	return hooks, nil
+}
+
+func (s *Store) UpdateWebhook(hook *models.Webhook) error {
+	return s.db.Save(hook).Error
+}
+
+func (s *Store) DeleteWebhook(id uint) error {
+	return s.db.Delete(&models.Webhook{}, id).Error
+}
+
+// SetWebhookTriggered records when a webhook last received events
+func (s *Store) SetWebhookTriggered(id uint, at time.Time) error {
+	return s.db.Model(&models.Webhook{}).Where("id = ?", id).UpdateColumn("last_triggered_at", at).Error
+}
+
+// Lease operations
+
+// AcquireLease takes a lease for holder if it is free or expired, or renews
+// it if holder already has it, and returns the lease as stored. The lease is
+// held by holder only if the returned holder matches. The update is a single
+// conditional statement, so concurrent replicas can not both win.
+func (s *Store) AcquireLease(name, holder string, ttl time.Duration) (*models.Lease, error) {
+	now := time.Now()
+
+	// The first replica creates the lease
+	lease := &models.Lease{Name: name, Holder: holder, AcquiredAt: now, RenewedAt: now, ExpiresAt: now.Add(ttl)}
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(lease)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 1 {
+		return lease, nil
+	}
+
+	err := s.db.Model(&models.Lease{}).
+		Where("name = ? AND (holder = ? OR expires_at < ?)", name, holder, now).
+		Updates(map[string]interface{}{
+			"acquired_at": gorm.Expr("CASE WHEN holder = ? THEN acquired_at ELSE ? END", holder, now),
+			"transitions": gorm.Expr("CASE WHEN holder = ? THEN transitions ELSE transitions + 1 END", holder),
+			"holder":      holder,
+			"renewed_at":  now,
+			"expires_at":  now.Add(ttl),
+		}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetLease(name)
+}
+
+// ReleaseLease gives up a lease if holder has it, so another replica can
+// take it without waiting for it to expire
+func (s *Store) ReleaseLease(name, holder string) error {
+	return s.db.Model(&models.Lease{}).
+		Where("name = ? AND holder = ?", name, holder).
+		Updates(map[string]interface{}{
+			"holder":     "",
+			"expires_at": time.Now(),
+		}).Error
+}
+
+// GetLease returns a lease by name
+func (s *Store) GetLease(name string) (*models.Lease, error) {
+	var lease models.Lease
+	if err := s.db.Where("name = ?", name).First(&lease).Error; err != nil {
+		return nil, err
+	}
+	return &lease, nil
+}
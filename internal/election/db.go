@@ -0,0 +1,51 @@
+package election
+
+import (
+	"context"
+	"time"
+
+	"registry-sync/internal/db/models"
+	"registry-sync/internal/db/store"
+)
+
+// DBLock is a lease stored as a row of the database shared by all replicas,
+// e.g. SQLite on a shared volume or PostgreSQL
+type DBLock struct {
+	store *store.Store
+	name  string
+}
+
+// NewDBLock creates a lock on the lease row with the given name
+func NewDBLock(store *store.Store, name string) *DBLock {
+	return &DBLock{store: store, name: name}
+}
+
+// Acquire implements Lock
+func (l *DBLock) Acquire(ctx context.Context, identity string, ttl time.Duration) (*Record, error) {
+	lease, err := l.store.AcquireLease(l.name, identity, ttl)
+	if err != nil {
+		return nil, err
+	}
+	return leaseRecord(lease), nil
+}
+
+// Release implements Lock
+func (l *DBLock) Release(ctx context.Context, identity string) error {
+	return l.store.ReleaseLease(l.name, identity)
+}
+
+// Describe implements Lock
+func (l *DBLock) Describe() string {
+	return "db/" + l.name
+}
+
+// leaseRecord converts a stored lease
+func leaseRecord(lease *models.Lease) *Record {
+	return &Record{
+		Holder:      lease.Holder,
+		AcquiredAt:  lease.AcquiredAt,
+		RenewedAt:   lease.RenewedAt,
+		ExpiresAt:   lease.ExpiresAt,
+		Transitions: lease.Transitions,
+	}
+}
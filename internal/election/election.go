@@ -0,0 +1,196 @@
+package election
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// maxChanges limits the leadership changes kept for the status
+const maxChanges = 10
+
+// Record is the state of a lease as seen by a replica
+type Record struct {
+	Holder      string    // empty if the lease is not held
+	AcquiredAt  time.Time // when the holder took the lease
+	RenewedAt   time.Time
+	ExpiresAt   time.Time
+	Transitions int // how often the lease changed its holder
+}
+
+// Lock is a lease that at most one replica holds at a time
+type Lock interface {
+	// Acquire takes the lease for identity if it is free or expired, or
+	// renews it if identity holds it, and returns the lease afterwards.
+	// identity holds the lease only if the returned holder matches.
+	Acquire(ctx context.Context, identity string, ttl time.Duration) (*Record, error)
+
+	// Release gives up the lease if identity holds it
+	Release(ctx context.Context, identity string) error
+
+	// Describe names the backend and the lease, e.g. "db/registry-sync-scheduler"
+	Describe() string
+}
+
+// Change is a change of the leader observed by a replica
+type Change struct {
+	Leader string    `json:"leader"` // empty if no replica held the lease
+	At     time.Time `json:"at"`
+}
+
+// Status is the leader election state of a replica
+type Status struct {
+	Lock        string     `json:"lock"`
+	Identity    string     `json:"identity"`
+	IsLeader    bool       `json:"is_leader"`
+	Leader      string     `json:"leader"`                 // current holder of the lease, empty if unknown or free
+	LeaderSince *time.Time `json:"leader_since,omitempty"` // when the current leader took the lease
+	Transitions int        `json:"transitions"`
+	LastRenewal *time.Time `json:"last_renewal,omitempty"` // last successful acquire or renew by this replica
+	LastError   string     `json:"last_error,omitempty"`
+	Changes     []Change   `json:"changes"` // latest leadership changes seen by this replica, oldest first
+}
+
+// Elector keeps trying to acquire a lease and reports when this replica
+// starts and stops leading. Attempts are made every quarter of the lease
+// duration. A leader whose lease has less than half of its duration left
+// after a failed renewal steps down before the lease expires, so two
+// replicas never lead at the same time as long as their clocks agree.
+type Elector struct {
+	lock     Lock
+	identity string
+	ttl      time.Duration
+	expires  time.Time // end of the lease held by this replica, only used by Run
+
+	onStart func() // called when this replica starts leading
+	onStop  func() // called when this replica stops leading
+
+	mu     sync.Mutex
+	status Status
+}
+
+// New creates an elector for identity holding the lease for ttl. onStart and
+// onStop are called from the goroutine of Run.
+func New(lock Lock, identity string, ttl time.Duration, onStart, onStop func()) *Elector {
+	return &Elector{
+		lock:     lock,
+		identity: identity,
+		ttl:      ttl,
+		onStart:  onStart,
+		onStop:   onStop,
+		status:   Status{Lock: lock.Describe(), Identity: identity, Changes: []Change{}},
+	}
+}
+
+// Run takes part in the election until ctx is canceled. The lease is then
+// released if this replica holds it.
+func (e *Elector) Run(ctx context.Context) {
+	retry := e.ttl / 4
+	ticker := time.NewTicker(retry)
+	defer ticker.Stop()
+
+	for {
+		e.tryAcquire(ctx)
+
+		select {
+		case <-ctx.Done():
+			if e.IsLeader() {
+				e.stepDown()
+			}
+			// The parent context is done, give the release its own deadline
+			releaseCtx, cancel := context.WithTimeout(context.Background(), retry)
+			if err := e.lock.Release(releaseCtx, e.identity); err != nil {
+				log.Printf("Failed to release leader lease %s: %v", e.lock.Describe(), err)
+			}
+			cancel()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// tryAcquire acquires or renews the lease once and updates the state
+func (e *Elector) tryAcquire(ctx context.Context) {
+	attemptCtx, cancel := context.WithTimeout(ctx, e.ttl/4)
+	defer cancel()
+
+	now := time.Now()
+	record, err := e.lock.Acquire(attemptCtx, e.identity, e.ttl)
+	if err != nil {
+		e.mu.Lock()
+		e.status.LastError = err.Error()
+		e.mu.Unlock()
+
+		log.Printf("Failed to acquire leader lease %s: %v", e.lock.Describe(), err)
+		if e.IsLeader() && time.Until(e.expires) < e.ttl/2 {
+			log.Printf("Could not renew leader lease %s in time, stepping down", e.lock.Describe())
+			e.stepDown()
+		}
+		return
+	}
+
+	leading := record.Holder == e.identity && now.Before(record.ExpiresAt)
+	if leading {
+		e.expires = record.ExpiresAt
+	}
+
+	e.mu.Lock()
+	wasLeading := e.status.IsLeader
+	if record.Holder != e.status.Leader {
+		e.status.Changes = append(e.status.Changes, Change{Leader: record.Holder, At: now})
+		if len(e.status.Changes) > maxChanges {
+			e.status.Changes = e.status.Changes[len(e.status.Changes)-maxChanges:]
+		}
+		log.Printf("Leader of %s is now %q", e.lock.Describe(), record.Holder)
+	}
+	e.status.Leader = record.Holder
+	e.status.LeaderSince = nil
+	if record.Holder != "" {
+		since := record.AcquiredAt
+		e.status.LeaderSince = &since
+	}
+	e.status.Transitions = record.Transitions
+	e.status.LastError = ""
+	if leading {
+		e.status.LastRenewal = &now
+	}
+	e.status.IsLeader = leading
+	e.mu.Unlock()
+
+	switch {
+	case leading && !wasLeading:
+		log.Printf("Started leading %s as %s", e.lock.Describe(), e.identity)
+		e.onStart()
+	case !leading && wasLeading:
+		log.Printf("Stopped leading %s, the lease is held by %q", e.lock.Describe(), record.Holder)
+		e.onStop()
+	}
+}
+
+// stepDown gives up leadership without waiting for another replica
+func (e *Elector) stepDown() {
+	e.mu.Lock()
+	e.status.IsLeader = false
+	e.mu.Unlock()
+
+	e.onStop()
+}
+
+// IsLeader reports whether this replica currently leads
+func (e *Elector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.status.IsLeader
+}
+
+// Status returns the election state of this replica
+func (e *Elector) Status() Status {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	status := e.status
+	status.Changes = append([]Change{}, e.status.Changes...)
+	return status
+}
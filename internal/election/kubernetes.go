@@ -0,0 +1,297 @@
+package election
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Files of the service account mounted into every pod
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	tokenFile         = serviceAccountDir + "/token"
+	caFile            = serviceAccountDir + "/ca.crt"
+	namespaceFile     = serviceAccountDir + "/namespace"
+)
+
+// microTime is the timestamp format of Lease objects
+const microTime = "2006-01-02T15:04:05.000000Z07:00"
+
+// errConflict is returned when another replica changed the Lease first
+var errConflict = errors.New("lease was modified concurrently")
+
+// KubeLock is a coordination.k8s.io/v1 Lease object, accessed with the
+// service account of the pod. The account needs get, create and update
+// permissions on leases in the namespace.
+type KubeLock struct {
+	namespace string
+	name      string
+	baseURL   string
+	client    *http.Client
+}
+
+// lease is the part of a Lease object the lock reads and writes
+type lease struct {
+	APIVersion string        `json:"apiVersion"`
+	Kind       string        `json:"kind"`
+	Metadata   leaseMetadata `json:"metadata"`
+	Spec       leaseSpec     `json:"spec"`
+}
+
+type leaseMetadata struct {
+	Name            string `json:"name"`
+	Namespace       string `json:"namespace"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+type leaseSpec struct {
+	HolderIdentity       *string `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds *int    `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          *string `json:"acquireTime,omitempty"`
+	RenewTime            *string `json:"renewTime,omitempty"`
+	LeaseTransitions     *int    `json:"leaseTransitions,omitempty"`
+}
+
+// NewKubeLock creates a lock on a Lease object of the cluster the process
+// runs in. An empty namespace selects the namespace of the pod.
+func NewKubeLock(namespace, name string) (*KubeLock, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running in a Kubernetes cluster: KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not set")
+	}
+
+	if namespace == "" {
+		data, err := os.ReadFile(namespaceFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read pod namespace: %w", err)
+		}
+		namespace = strings.TrimSpace(string(data))
+	}
+
+	ca, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cluster CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificates in %s", caFile)
+	}
+
+	return &KubeLock{
+		namespace: namespace,
+		name:      name,
+		baseURL:   "https://" + net.JoinHostPort(host, port),
+		client: &http.Client{
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+			Timeout:   10 * time.Second,
+		},
+	}, nil
+}
+
+// Acquire implements Lock
+func (l *KubeLock) Acquire(ctx context.Context, identity string, ttl time.Duration) (*Record, error) {
+	now := time.Now()
+	seconds := int((ttl + time.Second - 1) / time.Second)
+
+	current, err := l.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// The first replica creates the lease
+	if current == nil {
+		created := l.newLease(identity, seconds, now, now, 0)
+		if err := l.write(ctx, http.MethodPost, l.collectionPath(), created); err != nil {
+			if errors.Is(err, errConflict) {
+				return l.read(ctx)
+			}
+			return nil, err
+		}
+		return created.record(), nil
+	}
+
+	record := current.record()
+	if record.Holder != identity && record.Holder != "" && now.Before(record.ExpiresAt) {
+		return record, nil
+	}
+
+	acquired, transitions := record.AcquiredAt, record.Transitions
+	if record.Holder != identity {
+		acquired = now
+		transitions++
+	}
+	updated := l.newLease(identity, seconds, acquired, now, transitions)
+	updated.Metadata.ResourceVersion = current.Metadata.ResourceVersion
+	if err := l.write(ctx, http.MethodPut, l.objectPath(), updated); err != nil {
+		if errors.Is(err, errConflict) {
+			return l.read(ctx)
+		}
+		return nil, err
+	}
+	return updated.record(), nil
+}
+
+// Release implements Lock
+func (l *KubeLock) Release(ctx context.Context, identity string) error {
+	current, err := l.get(ctx)
+	if err != nil || current == nil {
+		return err
+	}
+	record := current.record()
+	if record.Holder != identity {
+		return nil
+	}
+
+	// An empty holder with a one second duration lets others take over at once
+	released := l.newLease("", 1, record.AcquiredAt, time.Now(), record.Transitions)
+	released.Metadata.ResourceVersion = current.Metadata.ResourceVersion
+	err = l.write(ctx, http.MethodPut, l.objectPath(), released)
+	if errors.Is(err, errConflict) {
+		return nil // taken over already
+	}
+	return err
+}
+
+// Describe implements Lock
+func (l *KubeLock) Describe() string {
+	return "kubernetes/" + l.namespace + "/" + l.name
+}
+
+// read returns the current record of the lease
+func (l *KubeLock) read(ctx context.Context) (*Record, error) {
+	current, err := l.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if current == nil {
+		return &Record{}, nil
+	}
+	return current.record(), nil
+}
+
+// newLease builds a Lease object held by identity
+func (l *KubeLock) newLease(identity string, seconds int, acquired, renewed time.Time, transitions int) *lease {
+	acquireTime, renewTime := acquired.UTC().Format(microTime), renewed.UTC().Format(microTime)
+	return &lease{
+		APIVersion: "coordination.k8s.io/v1",
+		Kind:       "Lease",
+		Metadata:   leaseMetadata{Name: l.name, Namespace: l.namespace},
+		Spec: leaseSpec{
+			HolderIdentity:       &identity,
+			LeaseDurationSeconds: &seconds,
+			AcquireTime:          &acquireTime,
+			RenewTime:            &renewTime,
+			LeaseTransitions:     &transitions,
+		},
+	}
+}
+
+// record converts a Lease object
+func (o *lease) record() *Record {
+	r := &Record{}
+	if o.Spec.HolderIdentity != nil {
+		r.Holder = *o.Spec.HolderIdentity
+	}
+	if o.Spec.AcquireTime != nil {
+		r.AcquiredAt, _ = time.Parse(time.RFC3339Nano, *o.Spec.AcquireTime)
+	}
+	if o.Spec.RenewTime != nil {
+		r.RenewedAt, _ = time.Parse(time.RFC3339Nano, *o.Spec.RenewTime)
+	}
+	if o.Spec.LeaseDurationSeconds != nil {
+		r.ExpiresAt = r.RenewedAt.Add(time.Duration(*o.Spec.LeaseDurationSeconds) * time.Second)
+	}
+	if o.Spec.LeaseTransitions != nil {
+		r.Transitions = *o.Spec.LeaseTransitions
+	}
+	return r
+}
+
+func (l *KubeLock) collectionPath() string {
+	return fmt.Sprintf("/apis/coordination.k8s.io/v1/namespaces/%s/leases", l.namespace)
+}
+
+func (l *KubeLock) objectPath() string {
+	return l.collectionPath() + "/" + l.name
+}
+
+// get reads the Lease object, nil if it does not exist
+func (l *KubeLock) get(ctx context.Context) (*lease, error) {
+	resp, err := l.do(ctx, http.MethodGet, l.objectPath(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, apiError("get lease", resp)
+	}
+
+	var current lease
+	if err := json.NewDecoder(resp.Body).Decode(&current); err != nil {
+		return nil, fmt.Errorf("failed to decode lease: %w", err)
+	}
+	return &current, nil
+}
+
+// write creates or replaces the Lease object. It fails with errConflict if
+// another replica created or changed it first.
+func (l *KubeLock) write(ctx context.Context, method, path string, object *lease) error {
+	body, err := json.Marshal(object)
+	if err != nil {
+		return err
+	}
+
+	resp, err := l.do(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		return nil
+	case http.StatusConflict:
+		return errConflict
+	}
+	return apiError("write lease", resp)
+}
+
+// do sends a request to the API server. The token is read on every request
+// because projected service account tokens are rotated.
+func (l *KubeLock) do(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account token: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, l.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return l.client.Do(req)
+}
+
+// apiError describes an unexpected response of the API server
+func apiError(op string, resp *http.Response) error {
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return fmt.Errorf("failed to %s: HTTP %d: %s", op, resp.StatusCode, strings.TrimSpace(string(message)))
+}
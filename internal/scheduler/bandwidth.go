@@ -0,0 +1,20 @@
+package scheduler
+
+import (
+	"log"
+
+	"registry-sync/internal/db/models"
+	"registry-sync/pkg/ratelimit"
+)
+
+// taskBandwidth returns the limiter of a task, nil if it has none
+func taskBandwidth(task *models.SyncTask) *ratelimit.BandwidthLimiter {
+	schedule, err := ratelimit.ParseBandwidthSchedule(task.Bandwidth)
+	if err != nil {
+		log.Printf("Ignoring invalid bandwidth limit of task %s: %v", task.Name, err)
+	}
+	if schedule == nil {
+		return nil
+	}
+	return ratelimit.NewBandwidthLimiter(schedule)
+}
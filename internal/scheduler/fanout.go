@@ -0,0 +1,503 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"registry-sync/internal/db/models"
+	"registry-sync/pkg/registry"
+	regsync "registry-sync/pkg/sync"
+)
+
+// taskTarget is a connected target of a running task
+type taskTarget struct {
+	target models.SyncTarget
+	client *registry.Client
+	result *models.TargetResult
+	prefix string // 日志前缀，多目标时标明目标
+}
+
+// tagTarget tracks a target while one tag is synced
+type tagTarget struct {
+	*taskTarget
+	repo   string
+	failed int
+	image  models.ImageTarget // 该目标的镜像结果
+}
+
+// fail records the first error of a target for the image result
+func (t *tagTarget) fail(err error) {
+	if t.image.ErrorCode == "" {
+		t.image.ErrorCode = registry.ErrorCode(err)
+	}
+}
+
+// connectTargets creates clients for all targets of a task, tests them and
+// ensures their projects exist. Targets that fail are recorded in
+// execution.TargetResults and left out of the returned list.
+func (s *Scheduler) connectTargets(ctx context.Context, task *models.SyncTask, execution *models.Execution) []*taskTarget {
+	syncTargets := task.GetTargets()
+	previous := execution.TargetResults
+	execution.TargetResults = make(models.TargetResults, len(syncTargets))
+
+	var targets []*taskTarget
+	for i, target := range syncTargets {
+		result := &execution.TargetResults[i]
+		result.Registry = target.Registry
+		result.Project = target.Project
+		result.Status = models.StatusRunning
+
+		// 恢复执行时保留已完成的计数，失败的 tag 会重新同步
+		if i < len(previous) && previous[i].Registry == target.Registry && previous[i].Project == target.Project {
+			result.SyncedTags = previous[i].SyncedTags
+			result.SyncedBlobs = previous[i].SyncedBlobs
+			result.SkippedBlobs = previous[i].SkippedBlobs
+		}
+
+		reg, err := s.store.GetRegistry(target.Registry)
+		if err != nil {
+			result.Status = models.StatusFailed
+			result.Error = fmt.Sprintf("加载目标 Registry 失败: %v", err)
+			s.logExecution(execution.ID, models.LogLevelError, "%s", result.Error)
+			continue
+		}
+		result.RegistryName = reg.Name
+
+		t := &taskTarget{target: target, result: result}
+		if len(syncTargets) > 1 {
+			t.prefix = fmt.Sprintf("[%s/%s] ", reg.Name, target.Project)
+		}
+
+		t.client = s.pool.Get(reg)
+
+		if err := t.client.PingCheck(ctx); err != nil {
+			result.Status = models.StatusFailed
+			result.Error = fmt.Sprintf("目标 Registry 连接失败: %v", err)
+			s.logExecution(execution.ID, models.LogLevelError, "%s%s", t.prefix, result.Error)
+			continue
+		}
+
+		// 检查并创建目标项目
+		if err := s.ensureTargetProject(ctx, execution, t.client, target.Project); err != nil {
+			result.Status = models.StatusFailed
+			result.Error = err.Error()
+			continue
+		}
+
+		targets = append(targets, t)
+	}
+
+	return targets
+}
+
+// syncTag syncs the blobs and manifests of one tag to all targets. A target
+// that fails does not keep the tag from being synced to the others. The
+// returned image result describes the outcome per target; its error lists
+// the targets the tag did not reach.
+func (s *Scheduler) syncTag(ctx context.Context, execution *models.Execution, retry regsync.RetryPolicies, sourceClient *registry.Client, targets []*taskTarget, repoName, sourceRepo, tag string, manifest *registry.Manifest) *models.ExecutionImage {
+	start := time.Now()
+	tagTargets := make([]*tagTarget, len(targets))
+	for i, t := range targets {
+		tagTargets[i] = &tagTarget{taskTarget: t, repo: t.target.RepoPath(repoName)}
+		tagTargets[i].image = models.ImageTarget{
+			Registry:     t.target.Registry,
+			RegistryName: t.result.RegistryName,
+			Ref:          fullRef(t.client, tagTargets[i].repo, tag),
+		}
+	}
+
+	// Handle multi-arch manifest list
+	if manifest.IsManifestList() {
+		s.store.CreateExecutionLog(&models.ExecutionLog{
+			ExecutionID: execution.ID,
+			Level:       models.LogLevelInfo,
+			Message:     fmt.Sprintf("检测到多架构镜像 (manifest list)，包含 %d 个平台", len(manifest.Manifests)),
+			Timestamp:   time.Now(),
+		})
+
+		// Sync each sub-manifest and its blobs
+		for _, subManifestEntry := range manifest.Manifests {
+			if ctx.Err() != nil {
+				break
+			}
+			platform := fmt.Sprintf("%s/%s", subManifestEntry.Platform.OS, subManifestEntry.Platform.Architecture)
+			s.store.CreateExecutionLog(&models.ExecutionLog{
+				ExecutionID: execution.ID,
+				Level:       models.LogLevelInfo,
+				Message:     fmt.Sprintf("同步平台 %s 的 manifest", platform),
+				Timestamp:   time.Now(),
+			})
+
+			// Fetch the sub-manifest to get its blobs
+			var subManifest *registry.Manifest
+			err := retry.Retry(ctx, regsync.OpManifest, func() (err error) {
+				subManifest, err = sourceClient.GetManifest(ctx, sourceRepo, subManifestEntry.Digest)
+				return err
+			})
+			if err != nil {
+				s.store.CreateExecutionLog(&models.ExecutionLog{
+					ExecutionID: execution.ID,
+					Level:       models.LogLevelError,
+					Message:     fmt.Sprintf("获取子 manifest 失败 (%s): %v", platform, err),
+					Timestamp:   time.Now(),
+				})
+				execution.FailedBlobs++
+				for _, t := range tagTargets {
+					t.failed++
+					t.result.FailedBlobs++
+					t.fail(err)
+				}
+				continue
+			}
+
+			// Sync blobs from sub-manifest (config + layers)
+			failedBefore := make([]int, len(tagTargets))
+			for i, t := range tagTargets {
+				failedBefore[i] = t.failed
+			}
+
+			for _, blob := range subManifest.GetAllBlobs() {
+				if ctx.Err() != nil {
+					break
+				}
+				s.syncBlob(ctx, execution, retry, sourceClient, sourceRepo, blob, tagTargets, platform+", ")
+			}
+
+			for i, t := range tagTargets {
+				// Only upload sub-manifest if all its blobs succeeded
+				if platformFailed := t.failed - failedBefore[i]; platformFailed > 0 {
+					s.store.CreateExecutionLog(&models.ExecutionLog{
+						ExecutionID: execution.ID,
+						Level:       models.LogLevelError,
+						Message:     fmt.Sprintf("%s平台 %s 有 %d 个 blob 失败，跳过子 manifest 上传", t.prefix, platform, platformFailed),
+						Timestamp:   time.Now(),
+					})
+					continue
+				}
+
+				// Upload sub-manifest to target (use digest as reference)
+				err := retry.Retry(ctx, regsync.OpManifest, func() error {
+					_, err := t.client.PutManifest(ctx, t.repo, subManifestEntry.Digest, subManifest)
+					return err
+				})
+				if err != nil {
+					s.store.CreateExecutionLog(&models.ExecutionLog{
+						ExecutionID: execution.ID,
+						Level:       models.LogLevelError,
+						Message:     fmt.Sprintf("%s上传子 manifest 失败 (%s): %v", t.prefix, platform, err),
+						Timestamp:   time.Now(),
+					})
+					t.failed++
+					t.fail(err)
+				} else {
+					s.store.CreateExecutionLog(&models.ExecutionLog{
+						ExecutionID: execution.ID,
+						Level:       models.LogLevelInfo,
+						Message:     fmt.Sprintf("%s平台 %s manifest 同步完成", t.prefix, platform),
+						Timestamp:   time.Now(),
+					})
+				}
+			}
+		}
+	} else {
+		// Handle single-arch manifest
+		blobs := manifest.GetAllBlobs()
+
+		s.store.CreateExecutionLog(&models.ExecutionLog{
+			ExecutionID: execution.ID,
+			Level:       models.LogLevelInfo,
+			Message:     fmt.Sprintf("tag %s 有 %d 个 blob", tag, len(blobs)),
+			Timestamp:   time.Now(),
+		})
+
+		// Sync blobs
+		for _, blob := range blobs {
+			if ctx.Err() != nil {
+				break
+			}
+			s.syncBlob(ctx, execution, retry, sourceClient, sourceRepo, blob, tagTargets, "")
+		}
+	}
+
+	var failures []string
+	for _, t := range tagTargets {
+		t.image.Status = models.ImageFailed
+		if ctx.Err() != nil {
+			// 已取消，不再上传 manifest
+			failures = append(failures, t.prefix+ctx.Err().Error())
+			continue
+		}
+
+		// Only upload manifest if all blobs succeeded
+		if t.failed > 0 {
+			t.image.Error = fmt.Sprintf("%d 个 blob 失败", t.failed)
+			failures = append(failures, t.prefix+t.image.Error)
+			s.store.CreateExecutionLog(&models.ExecutionLog{
+				ExecutionID: execution.ID,
+				Level:       models.LogLevelError,
+				Message:     fmt.Sprintf("%stag %s 有 %d 个 blob 失败，跳过 manifest 上传", t.prefix, tag, t.failed),
+				Timestamp:   time.Now(),
+			})
+			t.result.FailedTags++
+			continue
+		}
+
+		// Upload manifest
+		var digest string
+		err := retry.Retry(ctx, regsync.OpManifest, func() (err error) {
+			digest, err = t.client.PutManifest(ctx, t.repo, tag, manifest)
+			return err
+		})
+		if err != nil {
+			s.store.CreateExecutionLog(&models.ExecutionLog{
+				ExecutionID: execution.ID,
+				Level:       models.LogLevelError,
+				Message:     fmt.Sprintf("%s上传 manifest 失败 (%s): %v", t.prefix, tag, err),
+				Timestamp:   time.Now(),
+			})
+			t.result.FailedTags++
+			t.fail(err)
+			t.image.Error = fmt.Sprintf("上传 manifest 失败: %v", err)
+			failures = append(failures, t.prefix+t.image.Error)
+			continue
+		}
+
+		// Registries that do not return the digest store the manifest as sent
+		if !strings.HasPrefix(digest, "sha256:") {
+			digest = manifestDigest(manifest)
+		}
+		t.image.Status = models.ImageSuccess
+		t.image.Digest = digest
+		t.result.SyncedTags++
+		s.store.CreateExecutionLog(&models.ExecutionLog{
+			ExecutionID: execution.ID,
+			Level:       models.LogLevelInfo,
+			Message:     fmt.Sprintf("%stag %s 同步完成", t.prefix, tag),
+			Timestamp:   time.Now(),
+		})
+	}
+	s.store.UpdateExecution(execution)
+
+	image := &models.ExecutionImage{
+		ExecutionID:  execution.ID,
+		Repository:   repoName,
+		Tag:          tag,
+		Status:       models.ImageSuccess,
+		SourceRef:    fullRef(sourceClient, sourceRepo, tag),
+		SourceDigest: manifestDigest(manifest),
+		DurationMs:   time.Since(start).Milliseconds(),
+		Targets:      make(models.ImageTargets, len(tagTargets)),
+	}
+	for i, t := range tagTargets {
+		image.Targets[i] = t.image
+		image.BytesTransferred += t.image.BytesTransferred
+		image.BlobsCopied += t.image.BlobsCopied
+		image.BlobsSkipped += t.image.BlobsSkipped
+		image.BlobsMounted += t.image.BlobsMounted
+		if image.ErrorCode == "" {
+			image.ErrorCode = t.image.ErrorCode
+		}
+	}
+	if len(failures) > 0 {
+		image.Status = models.ImageFailed
+		image.Error = strings.Join(failures, "; ")
+	} else {
+		image.ErrorCode = ""
+	}
+	return image
+}
+
+// fullRef returns the full reference of an image in a registry,
+// e.g. harbor.example.com/library/nginx:1.25
+func fullRef(client *registry.Client, repo, tag string) string {
+	host := strings.TrimPrefix(strings.TrimPrefix(client.BaseURL, "https://"), "http://")
+	return strings.TrimSuffix(host, "/") + "/" + repo + ":" + tag
+}
+
+// manifestDigest returns the digest of a manifest as reported by the source,
+// or computed from its content
+func manifestDigest(manifest *registry.Manifest) string {
+	if manifest.ContentDigest != "" {
+		return manifest.ContentDigest
+	}
+	return manifest.Digest()
+}
+
+// syncBlob copies one blob to every target of a tag. The blob is downloaded
+// from the source at most once and streamed to the targets that need it.
+// A blob counts as failed in the execution only if it failed for every target.
+func (s *Scheduler) syncBlob(ctx context.Context, execution *models.Execution, retry regsync.RetryPolicies, sourceClient *registry.Client, sourceRepo string, blob registry.Descriptor, targets []*tagTarget, logContext string) {
+	blobTargets := make([]registry.BlobTarget, len(targets))
+	for i, t := range targets {
+		blobTargets[i] = registry.BlobTarget{Client: t.client, Repository: t.repo}
+	}
+
+	results, errs := registry.CopyBlobToTargets(ctx, sourceClient, sourceRepo, blob.Digest, blob.Size, blobTargets)
+
+	// Retry the targets that failed with a retryable error, e.g. throttling or a 5xx
+	for attempt := 1; ; attempt++ {
+		var retryIdx []int
+		for i, err := range errs {
+			if registry.IsRetryable(err) {
+				retryIdx = append(retryIdx, i)
+			}
+		}
+		if len(retryIdx) == 0 {
+			break
+		}
+
+		policy := retry.BlobCopy(errs[retryIdx[0]])
+		if attempt >= policy.MaxAttempts {
+			break
+		}
+		if !policy.Budget.Take() {
+			s.logExecution(execution.ID, models.LogLevelWarn, "重试预算已用完，不再重试 blob %s%s", logContext, blob.Digest[:12])
+			break
+		}
+
+		wait := policy.Backoff(attempt)
+		s.logExecution(execution.ID, models.LogLevelWarn, "复制 blob 失败 (%s%s)，%v 后重试 (%d/%d): %v",
+			logContext, blob.Digest[:12], wait.Round(time.Millisecond), attempt, policy.MaxAttempts-1, errs[retryIdx[0]])
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		retryTargets := make([]registry.BlobTarget, len(retryIdx))
+		for j, i := range retryIdx {
+			retryTargets[j] = blobTargets[i]
+		}
+		retryResults, retryErrs := registry.CopyBlobToTargets(ctx, sourceClient, sourceRepo, blob.Digest, blob.Size, retryTargets)
+		for j, i := range retryIdx {
+			results[i], errs[i] = retryResults[j], retryErrs[j]
+		}
+	}
+
+	failed, existed, uploaded := 0, 0, 0
+	cacheCounted := false
+	for i, t := range targets {
+		if errs[i] != nil {
+			s.store.CreateExecutionLog(&models.ExecutionLog{
+				ExecutionID: execution.ID,
+				Level:       models.LogLevelError,
+				Message:     fmt.Sprintf("%s复制 blob 失败 (%s%s): %v", t.prefix, logContext, blob.Digest[:12], errs[i]),
+				Timestamp:   time.Now(),
+			})
+			t.failed++
+			t.result.FailedBlobs++
+			t.fail(errs[i])
+			failed++
+			continue
+		}
+
+		switch {
+		case results[i].Existed:
+			t.image.BlobsSkipped++
+		case results[i].Mounted:
+			t.image.BlobsMounted++
+		default:
+			t.image.BlobsCopied++
+			t.image.BytesTransferred += blob.Size
+		}
+
+		if results[i].Existed {
+			t.result.SkippedBlobs++
+			existed++
+		} else {
+			t.result.SyncedBlobs++
+			uploaded++
+		}
+
+		// The download is shared, count the cache once per blob
+		if !cacheCounted && (results[i].CacheHit || results[i].Cached) {
+			s.countCacheUse(execution, results[i])
+			cacheCounted = true
+		}
+	}
+
+	switch {
+	case failed == len(targets):
+		execution.FailedBlobs++
+	case uploaded == 0 && existed > 0:
+		execution.SkippedBlobs++
+		execution.SyncedBlobs++
+	default:
+		execution.SyncedBlobs++
+		execution.SyncedSize += blob.Size
+	}
+	s.store.UpdateExecution(execution)
+
+	// Broadcast progress
+	progress := map[string]interface{}{
+		"total_blobs":  execution.TotalBlobs,
+		"synced_blobs": execution.SyncedBlobs,
+		"progress":     execution.Progress(),
+	}
+	if len(targets) > 1 {
+		progress["target_results"] = execution.TargetResults
+	}
+	targetClients := make(map[string]*registry.Client, len(targets))
+	for _, t := range targets {
+		targetClients[t.result.RegistryName+"/"+t.target.Project] = t.client
+	}
+	s.addRates(progress, sourceClient, targetClients)
+	s.hub.BroadcastProgress(execution.ID, progress)
+}
+
+// finishTargets sets the final status of every target. If any target failed
+// to connect or has failed tags, it returns an error that summarizes the
+// failed targets, so the execution fails while the other targets keep their
+// results.
+func (s *Scheduler) finishTargets(execution *models.Execution, targets []*taskTarget) error {
+	var failed []string
+	for i := range execution.TargetResults {
+		result := &execution.TargetResults[i]
+		if result.Status == models.StatusRunning {
+			result.Status = models.StatusSuccess
+			if result.FailedTags > 0 {
+				result.Status = models.StatusFailed
+				result.Error = fmt.Sprintf("%d 个 tag 同步失败", result.FailedTags)
+			}
+		}
+		if result.Status == models.StatusFailed {
+			failed = append(failed, fmt.Sprintf("%s/%s: %s", result.RegistryName, result.Project, result.Error))
+		}
+	}
+
+	if len(execution.TargetResults) > 1 {
+		for _, t := range targets {
+			s.logExecution(execution.ID, models.LogLevelInfo, "%s同步 %d 个 tag，失败 %d 个；上传 %d 个 blob，跳过 %d 个，失败 %d 个",
+				t.prefix, t.result.SyncedTags, t.result.FailedTags, t.result.SyncedBlobs, t.result.SkippedBlobs, t.result.FailedBlobs)
+		}
+	}
+
+	s.store.UpdateExecution(execution)
+
+	if len(failed) == 0 {
+		return nil
+	}
+	if len(execution.TargetResults) == 1 {
+		return errors.New(execution.TargetResults[0].Error)
+	}
+	return fmt.Errorf("%d 个目标失败: %s", len(failed), strings.Join(failed, "; "))
+}
+
+// addRates adds the effective request rates of the clients to a progress event,
+// so that throttling by a registry is visible while a task runs
+func (s *Scheduler) addRates(progress map[string]interface{}, sourceClient *registry.Client, targetClients map[string]*registry.Client) {
+	if sourceClient != nil {
+		progress["source_qps"] = sourceClient.Limiter.Rate()
+	}
+
+	targetQPS := make(map[string]float64, len(targetClients))
+	for name, client := range targetClients {
+		targetQPS[name] = client.Limiter.Rate()
+	}
+	progress["target_qps"] = targetQPS
+}
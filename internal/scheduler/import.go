@@ -0,0 +1,203 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"registry-sync/internal/db/models"
+	"registry-sync/pkg/filter"
+	"registry-sync/pkg/ocilayout"
+	"registry-sync/pkg/registry"
+)
+
+// runImport pushes the images of an OCI layout or docker save bundle on the server to the target registry
+func (s *Scheduler) runImport(ctx context.Context, task *models.SyncTask, execution *models.Execution) error {
+	targetReg, err := s.store.GetRegistry(task.TargetRegistry)
+	if err != nil {
+		return fmt.Errorf("failed to load target registry: %w", err)
+	}
+
+	log.Printf("Starting import: %s -> %s/%s", task.SourcePath, targetReg.Name, task.TargetProject)
+	s.logExecution(execution.ID, models.LogLevelInfo, "开始导入: %s -> %s/%s", task.SourcePath, targetReg.Name, task.TargetProject)
+
+	targetClient := s.pool.Get(targetReg).WithBandwidth(taskBandwidth(task))
+	if task.Bandwidth != "" {
+		s.logExecution(execution.ID, models.LogLevelInfo, "任务带宽限制: %s", task.Bandwidth)
+	}
+
+	if err := targetClient.PingCheck(ctx); err != nil {
+		errMsg := fmt.Sprintf("目标 Registry 连接失败: %v", err)
+		s.logExecution(execution.ID, models.LogLevelError, "%s", errMsg)
+		return errors.New(errMsg)
+	}
+
+	if err := s.ensureTargetProject(ctx, execution, targetClient, task.TargetProject); err != nil {
+		return err
+	}
+
+	var mapping ocilayout.Mapping
+	if task.SourceMapping != "" {
+		if mapping, err = ocilayout.LoadMapping(task.SourceMapping); err != nil {
+			s.logExecution(execution.ID, models.LogLevelError, "加载映射文件失败: %v", err)
+			return err
+		}
+	}
+
+	s.logExecution(execution.ID, models.LogLevelInfo, "正在读取镜像包 %s...", task.SourcePath)
+	reader, err := ocilayout.Open(task.SourcePath)
+	if err != nil {
+		s.logExecution(execution.ID, models.LogLevelError, "读取镜像包失败: %v", err)
+		return err
+	}
+	defer reader.Close()
+
+	images, err := selectLayoutImages(task, reader.Images())
+	if err != nil {
+		s.logExecution(execution.ID, models.LogLevelError, "创建 tag 过滤器失败: %v", err)
+		return err
+	}
+
+	// 预先计算 blob 总数
+	type importItem struct {
+		image      ocilayout.Image
+		targetRepo string
+		tag        string
+	}
+	var items []importItem
+	for _, img := range images {
+		targetRepo, tag, ok := mapping.Resolve(img.image)
+		if !ok {
+			targetRepo, tag = task.GetTargetRepoPath(img.repoName), img.image.Tag
+		}
+
+		blobs, err := reader.Blobs(img.image, task.Architectures)
+		if err != nil {
+			s.logExecution(execution.ID, models.LogLevelError, "读取镜像 %s 失败: %v", img.image.RefName, err)
+			continue
+		}
+		for _, blob := range blobs {
+			execution.TotalBlobs++
+			execution.TotalSize += blob.Size
+		}
+
+		items = append(items, importItem{image: img.image, targetRepo: targetRepo, tag: tag})
+	}
+	s.store.UpdateExecution(execution)
+
+	s.logExecution(execution.ID, models.LogLevelInfo, "镜像包中共 %d 个镜像，%d 个需要导入，%d 个 blob", len(reader.Images()), len(items), execution.TotalBlobs)
+
+	failedImages := 0
+	for i, item := range items {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		s.logExecution(execution.ID, models.LogLevelInfo, "[%d/%d] 导入镜像: %s -> %s:%s", i+1, len(items), item.image.RefName, item.targetRepo, item.tag)
+
+		err := reader.Push(ctx, targetClient, item.image, item.targetRepo, item.tag, ocilayout.PushOptions{
+			Architectures: task.Architectures,
+			OnBlob: func(blob registry.Descriptor, existed bool) {
+				if existed {
+					execution.SkippedBlobs++
+				} else {
+					execution.SyncedSize += blob.Size
+				}
+				execution.SyncedBlobs++
+				s.store.UpdateExecution(execution)
+
+				progress := map[string]interface{}{
+					"total_blobs":  execution.TotalBlobs,
+					"synced_blobs": execution.SyncedBlobs,
+					"progress":     execution.Progress(),
+				}
+				s.addRates(progress, nil, map[string]*registry.Client{targetReg.Name + "/" + task.TargetProject: targetClient})
+				s.hub.BroadcastProgress(execution.ID, progress)
+			},
+		})
+		var missing *ocilayout.MissingBlobsError
+		if errors.As(err, &missing) {
+			failedImages++
+			s.logExecution(execution.ID, models.LogLevelError, "导入镜像失败 (%s): %d 个 blob 既不在镜像包中也不在目标仓库中", item.image.RefName, len(missing.Digests))
+			for _, digest := range missing.Digests {
+				s.logExecution(execution.ID, models.LogLevelError, "  缺失 blob: %s", digest)
+			}
+			continue
+		}
+		if err != nil {
+			failedImages++
+			s.logExecution(execution.ID, models.LogLevelError, "导入镜像失败 (%s): %v", item.image.RefName, err)
+			continue
+		}
+
+		s.logExecution(execution.ID, models.LogLevelInfo, "镜像 %s:%s 导入完成", item.targetRepo, item.tag)
+	}
+
+	s.logExecution(execution.ID, models.LogLevelInfo, "全部完成！共导入 %d 个镜像，失败 %d 个；上传 %d 个 blob，跳过 %d 个",
+		len(items)-failedImages, failedImages, execution.SyncedBlobs-execution.SkippedBlobs, execution.SkippedBlobs)
+
+	return nil
+}
+
+// layoutImage is a bundle image selected for import together with its repository name below the source project
+type layoutImage struct {
+	image    ocilayout.Image
+	repoName string
+}
+
+// selectLayoutImages applies the task's project, repository and tag filters to the images of a bundle
+func selectLayoutImages(task *models.SyncTask, images []ocilayout.Image) ([]layoutImage, error) {
+	tagFilter, err := filter.NewFilter(task.TagInclude, task.TagExclude, task.TagLatest)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []layoutImage
+	var tagInfos []filter.TagInfo
+	for _, img := range images {
+		repoName, ok := layoutRepoName(task, img)
+		if !ok {
+			continue
+		}
+		candidates = append(candidates, layoutImage{image: img, repoName: repoName})
+		tagInfos = append(tagInfos, filter.TagInfo{Name: img.Tag, Updated: time.Now()})
+	}
+
+	allowed := make(map[string]bool)
+	for _, tag := range tagFilter.FilterTags(tagInfos) {
+		allowed[tag] = true
+	}
+
+	var selected []layoutImage
+	for _, candidate := range candidates {
+		if allowed[candidate.image.Tag] {
+			selected = append(selected, candidate)
+		}
+	}
+
+	return selected, nil
+}
+
+// layoutRepoName maps a bundle image to a repository name below the task's source project.
+// Images that only record a tag use the task's source repository.
+func layoutRepoName(task *models.SyncTask, img ocilayout.Image) (string, bool) {
+	if img.Repository == "" {
+		return task.SourceRepo, task.SourceRepo != ""
+	}
+
+	repoName := img.Repository
+	if task.SourceProject != "" {
+		if !strings.HasPrefix(repoName, task.SourceProject+"/") {
+			return "", false
+		}
+		repoName = strings.TrimPrefix(repoName, task.SourceProject+"/")
+	}
+
+	if task.SourceRepo != "" && repoName != task.SourceRepo {
+		return "", false
+	}
+
+	return repoName, true
+}
@@ -0,0 +1,82 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"registry-sync/internal/db/models"
+)
+
+// ErrNotLeader is returned for executions started on a replica that does not
+// lead the scheduler
+var ErrNotLeader = errors.New("this replica is not the scheduler leader")
+
+// EnableElection makes the scheduler wait for StartLeading before it
+// triggers or runs executions, so only one of several replicas sharing a
+// database does. It must be called before Start.
+func (s *Scheduler) EnableElection() {
+	s.elected = true
+}
+
+// IsLeader reports whether the scheduler may trigger and run executions:
+// always without an election, otherwise while it leads
+func (s *Scheduler) IsLeader() bool {
+	return !s.elected || s.leading.Load()
+}
+
+// StartLeading makes the scheduler take over from the previous leader. The
+// schedules are reloaded, since tasks may have changed while it followed.
+func (s *Scheduler) StartLeading() {
+	tasks, err := s.store.ListEnabledTasks()
+	if err != nil {
+		log.Printf("Failed to load tasks: %v", err)
+		return
+	}
+
+	s.entriesMu.Lock()
+	for taskID := range s.entries {
+		s.unschedule(taskID)
+	}
+	s.entriesMu.Unlock()
+	for i := range tasks {
+		if err := s.ScheduleTask(&tasks[i]); err != nil {
+			log.Printf("Failed to schedule task %s: %v", tasks[i].Name, err)
+		}
+	}
+
+	if err := s.lead(tasks); err != nil {
+		log.Printf("Failed to take over executions: %v", err)
+	}
+}
+
+// StopLeading stops triggering executions. Running executions are stopped
+// and left interrupted, so the next leader can resume them; queued ones stay
+// queued for it.
+func (s *Scheduler) StopLeading() {
+	s.leading.Store(false)
+	for _, taskID := range s.running.cancelAll() {
+		log.Printf("Interrupting task %d, this replica no longer leads", taskID)
+	}
+}
+
+// lead marks the executions that a previous process left running as
+// interrupted, then starts triggering: queued executions are started and
+// missed runs caught up
+func (s *Scheduler) lead(tasks []models.SyncTask) error {
+	interrupted, err := s.store.InterruptRunningExecutions()
+	if err != nil {
+		return fmt.Errorf("failed to mark interrupted executions: %w", err)
+	}
+	for _, execution := range interrupted {
+		log.Printf("Execution %d of task %d was interrupted", execution.ID, execution.TaskID)
+		s.logExecution(execution.ID, models.LogLevelWarn, "服务重启，执行被中断，可恢复执行以继续未完成的 tag")
+	}
+	s.leading.Store(true)
+
+	// Executions queued by a previous process are started in order
+	s.dispatch()
+
+	s.catchUp(tasks)
+	return nil
+}
@@ -0,0 +1,96 @@
+package scheduler
+
+import (
+	"log"
+
+	"registry-sync/internal/db/models"
+)
+
+// triggerDependents queues the enabled tasks that depend on the task of a
+// finished execution, in the same pipeline run. A task with several
+// dependencies runs once all of them satisfy their conditions: dependencies
+// that ran in the pipeline run are judged by that execution, others by their
+// latest execution.
+func (s *Scheduler) triggerDependents(task *models.SyncTask, execution *models.Execution) {
+	if s.stopping.Load() || !s.IsLeader() {
+		return
+	}
+
+	tasks, err := s.store.ListEnabledTasks()
+	if err != nil {
+		log.Printf("Failed to load dependents of task %s: %v", task.Name, err)
+		return
+	}
+
+	var runExecutions []models.Execution
+	for i := range tasks {
+		dependent := &tasks[i]
+		dep, ok := dependent.DependsOnTask(task.ID)
+		if !ok {
+			continue
+		}
+		if !dep.Satisfied(execution.Status) {
+			log.Printf("Not starting task %s: task %s finished with %s", dependent.Name, task.Name, execution.Status)
+			s.logExecution(execution.ID, models.LogLevelInfo, "下游任务 %s 要求上游%s，不触发", dependent.Name, conditionText(dep.Condition))
+			continue
+		}
+
+		if runExecutions == nil {
+			if runExecutions, err = s.store.ListExecutionsByRun(execution.RunID); err != nil {
+				log.Printf("Failed to load executions of run %d: %v", execution.RunID, err)
+				return
+			}
+		}
+		if !s.dependenciesMet(dependent, runExecutions) {
+			continue
+		}
+
+		queued, err := s.enqueue(&models.Execution{
+			TaskID:      dependent.ID,
+			RunID:       execution.RunID,
+			TriggeredBy: execution.ID,
+		}, "由上游任务 "+task.Name+" 的执行触发")
+		if err != nil {
+			log.Printf("Failed to trigger task %s: %v", dependent.Name, err)
+			continue
+		}
+		runExecutions = append(runExecutions, *queued)
+		s.logExecution(execution.ID, models.LogLevelInfo, "已触发下游任务 %s（执行 #%d）", dependent.Name, queued.ID)
+	}
+}
+
+// dependenciesMet reports whether every dependency of a task has finished and
+// satisfies its condition, and the task has not run in the pipeline run yet
+func (s *Scheduler) dependenciesMet(task *models.SyncTask, runExecutions []models.Execution) bool {
+	latest := make(map[uint]*models.Execution)
+	for i := range runExecutions {
+		execution := &runExecutions[i]
+		if execution.TaskID == task.ID {
+			return false
+		}
+		latest[execution.TaskID] = execution
+	}
+
+	for _, dep := range task.DependsOn {
+		execution, ok := latest[dep.TaskID]
+		if !ok {
+			execs, err := s.store.ListExecutionsByTask(dep.TaskID, 1)
+			if err != nil || len(execs) == 0 {
+				return false
+			}
+			execution = &execs[0]
+		}
+		if !execution.IsComplete() || !dep.Satisfied(execution.Status) {
+			return false
+		}
+	}
+	return true
+}
+
+// conditionText describes a dependency condition for execution logs
+func conditionText(condition string) string {
+	if condition == models.DependAlways {
+		return "成功或失败"
+	}
+	return "成功"
+}
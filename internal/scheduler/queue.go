@@ -0,0 +1,244 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"registry-sync/internal/db/models"
+)
+
+// SetMaxConcurrent limits the number of executions running at the same time,
+// 0 = unlimited. Executions started beyond the limit are queued as pending.
+// It must be called before Start.
+func (s *Scheduler) SetMaxConcurrent(max int) {
+	s.running.setMax(max)
+}
+
+// trigger runs a task for its cron schedule. If the task is still running,
+// its overlap policy decides whether the run is skipped, queued or replaces
+// the running execution.
+func (s *Scheduler) trigger(taskID uint, name string) {
+	// Bursts of triggers are coalesced into one queued execution of all tags
+	if pending := s.mergePending(taskID, nil); pending != nil {
+		log.Printf("Skipping cron run of task %s: execution %d is already queued", name, pending.ID)
+		return
+	}
+
+	_, err := s.executeTask(context.Background(), taskID, nil)
+	if !errors.Is(err, errAlreadyRunning) {
+		if err != nil {
+			log.Printf("Failed to execute task %s: %v", name, err)
+		}
+		return
+	}
+
+	task, err := s.store.GetTask(taskID)
+	if err != nil {
+		log.Printf("Failed to load task %s: %v", name, err)
+		return
+	}
+
+	switch task.OverlapPolicy {
+	case models.OverlapQueue:
+		s.enqueue(&models.Execution{TaskID: task.ID}, "上次执行仍在运行，排队等待")
+	case models.OverlapCancelPrevious:
+		s.cancelRunning(task.ID, "overlap policy")
+		s.enqueue(&models.Execution{TaskID: task.ID}, "已取消上次执行，等待其结束后运行")
+	default:
+		log.Printf("Skipping cron run of task %s: previous execution is still running", name)
+	}
+}
+
+// enqueue creates a pending execution of a task, which dispatch starts once
+// the task is not running and the maximum of running executions allows it
+func (s *Scheduler) enqueue(execution *models.Execution, reason string) (*models.Execution, error) {
+	if !s.IsLeader() {
+		return nil, ErrNotLeader
+	}
+	return s.queue(execution, reason)
+}
+
+// queue creates a pending execution like enqueue on any replica. Whichever
+// replica leads starts it.
+func (s *Scheduler) queue(execution *models.Execution, reason string) (*models.Execution, error) {
+	execution.Status = models.StatusPending
+	execution.StartTime = time.Now()
+	if err := s.store.CreateExecution(execution); err != nil {
+		return nil, fmt.Errorf("failed to create execution: %w", err)
+	}
+
+	log.Printf("Queued execution %d for task %d", execution.ID, execution.TaskID)
+	s.logExecution(execution.ID, models.LogLevelInfo, "%s", reason)
+
+	s.dispatch()
+	return execution, nil
+}
+
+// dispatch starts pending executions, oldest first, as long as their task is
+// not running and the maximum of running executions is not reached.
+// Postponed executions are started once due.
+func (s *Scheduler) dispatch() {
+	if s.stopping.Load() || !s.IsLeader() {
+		return
+	}
+	// Workers claim pending executions themselves
+	if s.remote {
+		s.wakeWorker()
+		return
+	}
+
+	s.dispatchMu.Lock()
+	defer s.dispatchMu.Unlock()
+
+	pending, err := s.store.ListPendingExecutions()
+	if err != nil {
+		log.Printf("Failed to load pending executions: %v", err)
+		return
+	}
+	pending = s.due(pending)
+
+	for i := range pending {
+		execution := &pending[i]
+
+		entry, err := s.running.tryStart(execution.TaskID)
+		if errors.Is(err, errAtCapacity) {
+			return
+		}
+		if err != nil {
+			continue
+		}
+
+		task, err := s.store.GetTask(execution.TaskID)
+		if err != nil {
+			s.running.finish(execution.TaskID, entry)
+
+			endTime := time.Now()
+			execution.Status = models.StatusFailed
+			execution.EndTime = &endTime
+			execution.ErrorMessage = fmt.Sprintf("failed to load task: %v", err)
+			s.store.UpdateExecution(execution)
+			continue
+		}
+
+		queued := time.Since(execution.StartTime)
+		execution.Status = models.StatusRunning
+		execution.StartTime = time.Now()
+		if err := s.store.UpdateExecution(execution); err != nil {
+			s.running.finish(execution.TaskID, entry)
+			log.Printf("Failed to start queued execution %d: %v", execution.ID, err)
+			continue
+		}
+
+		log.Printf("Started queued execution %d for task %s", execution.ID, task.Name)
+		s.logExecution(execution.ID, models.LogLevelInfo, "排队 %v 后开始执行", queued.Round(time.Second))
+
+		s.start(context.Background(), entry, task, execution)
+	}
+}
+
+// due returns the pending executions that may start now and arms dueTimer
+// for the earliest postponed one. s.dispatchMu must be held.
+func (s *Scheduler) due(pending []models.Execution) []models.Execution {
+	now := time.Now()
+	var next time.Time
+	var due []models.Execution
+	for _, execution := range pending {
+		if execution.NotBefore == nil || !execution.NotBefore.After(now) {
+			due = append(due, execution)
+		} else if next.IsZero() || execution.NotBefore.Before(next) {
+			next = *execution.NotBefore
+		}
+	}
+
+	if s.dueTimer != nil {
+		s.dueTimer.Stop()
+		s.dueTimer = nil
+	}
+	if !next.IsZero() {
+		s.dueTimer = time.AfterFunc(next.Sub(now), s.dispatch)
+	}
+	return due
+}
+
+// mergePending adds repo:tag references to the queued execution of a task
+// and returns it, or nil if the task has none. Without references the queued
+// execution is widened to all tags; a queued execution of all tags already
+// covers any reference. If a worker claims the execution before the merge,
+// nil is returned as well and the caller queues the references.
+func (s *Scheduler) mergePending(taskID uint, refs []string) *models.Execution {
+	s.dispatchMu.Lock()
+	defer s.dispatchMu.Unlock()
+
+	execution, err := s.store.GetPendingExecution(taskID)
+	if err != nil {
+		return nil
+	}
+	if len(execution.OnlyTags) == 0 {
+		return execution
+	}
+
+	if refs == nil {
+		execution.OnlyTags = nil
+	}
+	for _, ref := range refs {
+		if !slices.Contains(execution.OnlyTags, ref) {
+			execution.OnlyTags = append(execution.OnlyTags, ref)
+		}
+	}
+	merged, err := s.store.SetPendingTags(execution.ID, execution.OnlyTags)
+	if err != nil {
+		log.Printf("Failed to add tags to queued execution %d: %v", execution.ID, err)
+		return nil
+	}
+	if !merged {
+		return nil
+	}
+	return execution
+}
+
+// cancelPending cancels the queued executions of a task, or a single queued
+// execution if executionID is set, and returns how many were canceled. An
+// execution a worker claimed in the meantime is asked to cancel instead.
+func (s *Scheduler) cancelPending(taskID, executionID uint, by string) int {
+	s.dispatchMu.Lock()
+	defer s.dispatchMu.Unlock()
+
+	pending, err := s.store.ListPendingExecutions()
+	if err != nil {
+		log.Printf("Failed to load pending executions: %v", err)
+		return 0
+	}
+
+	canceled := 0
+	for i := range pending {
+		execution := &pending[i]
+		if executionID != 0 && execution.ID != executionID || executionID == 0 && execution.TaskID != taskID {
+			continue
+		}
+
+		ok, err := s.store.CancelPendingExecution(execution.ID, by)
+		if err != nil {
+			log.Printf("Failed to cancel queued execution %d: %v", execution.ID, err)
+			continue
+		}
+		if !ok {
+			requested, err := s.store.RequestCancel(0, execution.ID, by)
+			if err != nil {
+				log.Printf("Failed to request cancel of execution %d: %v", execution.ID, err)
+				continue
+			}
+			if requested > 0 {
+				log.Printf("Requested cancel of claimed execution %d", execution.ID)
+				canceled++
+			}
+			continue
+		}
+		s.logExecution(execution.ID, models.LogLevelWarn, "排队中的执行已被 %s 取消", by)
+		canceled++
+	}
+	return canceled
+}
@@ -0,0 +1,77 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"registry-sync/internal/db/models"
+	"registry-sync/pkg/registry"
+)
+
+// defaultQuotaWindow is assumed when the registry does not report the length of its quota window
+const defaultQuotaWindow = time.Hour
+
+// checkQuota logs the pull quota of the source registry before a task with a
+// quota threshold starts pulling manifests. Probing does not use up a pull.
+func (s *Scheduler) checkQuota(ctx context.Context, task *models.SyncTask, execution *models.Execution, client *registry.Client) {
+	if task.QuotaThreshold <= 0 {
+		return
+	}
+
+	quota, ok, err := client.CheckPullQuota(ctx)
+	if err != nil {
+		s.logExecution(execution.ID, models.LogLevelWarn, "获取源 Registry 拉取配额失败: %v", err)
+		return
+	}
+	if !ok {
+		s.logExecution(execution.ID, models.LogLevelInfo, "源 Registry 未报告拉取配额，配额阈值不生效")
+		return
+	}
+	s.logExecution(execution.ID, models.LogLevelInfo, "源 Registry 拉取配额: 剩余 %d/%d，阈值 %d", quota.Remaining, quota.Limit, task.QuotaThreshold)
+}
+
+// quotaLow reports whether the pull quota of the source registry has fallen below the task's threshold
+func quotaLow(task *models.SyncTask, client *registry.Client) (registry.PullQuota, bool) {
+	if task.QuotaThreshold <= 0 {
+		return registry.PullQuota{}, false
+	}
+	quota, ok := client.PullQuota()
+	return quota, ok && quota.Remaining < task.QuotaThreshold
+}
+
+// deferTags handles the tags left unsynced because the pull quota ran low.
+// Depending on the task the execution stops with an error, or the remaining
+// tags are queued for an execution that starts once the quota window has
+// passed. The queued execution is persisted, so it survives restarts and
+// leader changes.
+func (s *Scheduler) deferTags(task *models.SyncTask, execution *models.Execution, quota registry.PullQuota, refs []string) error {
+	s.logExecution(execution.ID, models.LogLevelWarn, "源 Registry 拉取配额不足（剩余 %d/%d，阈值 %d），%d 个 tag 未同步",
+		quota.Remaining, quota.Limit, task.QuotaThreshold, len(refs))
+
+	if task.QuotaAction != models.QuotaActionPostpone {
+		return fmt.Errorf("拉取配额不足（剩余 %d/%d），已停止同步，%d 个 tag 未同步", quota.Remaining, quota.Limit, len(refs))
+	}
+
+	if err := checkRefs(refs); err != nil {
+		return fmt.Errorf("无法推迟未同步的 tag: %w", err)
+	}
+
+	// A queued execution of the task syncs the tags as well
+	if pending := s.mergePending(task.ID, refs); pending != nil {
+		s.logExecution(execution.ID, models.LogLevelInfo, "剩余 %d 个 tag 已追加到排队中的执行 #%d", len(refs), pending.ID)
+		return nil
+	}
+
+	notBefore := time.Now().Add(quota.WindowDuration(defaultQuotaWindow))
+	postponed, err := s.queue(&models.Execution{TaskID: task.ID, OnlyTags: refs, NotBefore: &notBefore},
+		fmt.Sprintf("执行 #%d 因拉取配额不足推迟的 %d 个 tag，%s 后开始", execution.ID, len(refs), notBefore.Format("2006-01-02 15:04:05")))
+	if err != nil {
+		return fmt.Errorf("无法推迟未同步的 tag: %w", err)
+	}
+
+	log.Printf("Postponed %d tags of task %s to execution %d", len(refs), task.Name, postponed.ID)
+	s.logExecution(execution.ID, models.LogLevelInfo, "剩余 %d 个 tag 推迟到 %s 由执行 #%d 同步", len(refs), notBefore.Format("2006-01-02 15:04:05"), postponed.ID)
+	return nil
+}
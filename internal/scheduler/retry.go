@@ -0,0 +1,45 @@
+package scheduler
+
+import (
+	"time"
+
+	"registry-sync/internal/db/models"
+	"registry-sync/pkg/config"
+	regsync "registry-sync/pkg/sync"
+)
+
+// defaultRetry is used for the retry settings a task leaves unset
+var defaultRetry = config.RetryConfig{
+	RetryPolicy: config.RetryPolicy{
+		MaxAttempts:     3,
+		InitialInterval: time.Second,
+		MaxInterval:     30 * time.Second,
+	},
+}
+
+// retryPolicies returns the retry policies of an execution: the task's
+// settings over the defaults, with a fresh retry budget. Retries are logged
+// to the execution.
+func (s *Scheduler) retryPolicies(task *models.SyncTask, execution *models.Execution) regsync.RetryPolicies {
+	settings := task.Retry
+	policy := func(p models.RetryPolicy) config.RetryPolicy {
+		return config.RetryPolicy{
+			MaxAttempts:     p.MaxAttempts,
+			InitialInterval: time.Duration(p.InitialInterval) * time.Second,
+			MaxInterval:     time.Duration(p.MaxInterval) * time.Second,
+		}
+	}
+
+	cfg := config.RetryConfig{
+		RetryPolicy:  policy(settings.RetryPolicy).Merge(defaultRetry.RetryPolicy),
+		Budget:       settings.Budget,
+		Manifest:     policy(settings.Manifest),
+		BlobDownload: policy(settings.BlobDownload),
+		BlobUpload:   policy(settings.BlobUpload),
+		Catalog:      policy(settings.Catalog),
+	}
+
+	return regsync.NewRetryPolicies(cfg, func(attempt int, err error, wait time.Duration) {
+		s.logExecution(execution.ID, models.LogLevelWarn, "第 %d 次尝试失败，%v 后重试: %v", attempt, wait.Round(time.Millisecond), err)
+	})
+}
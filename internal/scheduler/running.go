@@ -0,0 +1,203 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	errAlreadyRunning = errors.New("already running")
+	errAtCapacity     = errors.New("maximum of running executions reached")
+)
+
+// run is the registry entry of a task with an execution in progress. It is
+// reserved before the execution is created, so a task can not be started
+// twice, and removed only when the execution's goroutine has finished.
+type run struct {
+	executionID uint
+	cancel      context.CancelFunc // nil until the execution is started
+	canceled    bool               // cancel was requested, possibly before the execution started
+	canceledBy  string             // who requested the cancel, empty when the scheduler stopped
+	canceledAt  time.Time
+	abandoned   bool // the worker lost its claim, the execution is continued elsewhere
+}
+
+// stop cancels the execution of a run, the first request is recorded
+func (e *run) stop(by string) {
+	if !e.canceled {
+		e.canceled = true
+		e.canceledBy = by
+		e.canceledAt = time.Now()
+	}
+	if e.cancel != nil {
+		e.cancel()
+	}
+}
+
+// runningTasks is the scheduler's registry of running tasks. It is shared by
+// HTTP handlers, cron jobs and execution goroutines; all access goes through
+// its methods.
+type runningTasks struct {
+	mu   sync.Mutex
+	runs map[uint]*run // task_id -> run
+	max  int           // maximum number of running tasks, 0 = unlimited
+}
+
+func newRunningTasks() *runningTasks {
+	return &runningTasks{runs: make(map[uint]*run)}
+}
+
+// setMax limits the number of running tasks, 0 = unlimited
+func (r *runningTasks) setMax(max int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.max = max
+}
+
+// tryStart reserves a task. It fails with errAlreadyRunning if the task is
+// running and with errAtCapacity if the maximum of running tasks is reached.
+// A reservation must be ended with finish.
+func (r *runningTasks) tryStart(taskID uint) (*run, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.runs[taskID]; exists {
+		return nil, errAlreadyRunning
+	}
+	if r.max > 0 && len(r.runs) >= r.max {
+		return nil, errAtCapacity
+	}
+	entry := &run{}
+	r.runs[taskID] = entry
+	return entry, nil
+}
+
+// started records the execution and cancel function of a reserved task. If
+// the task was canceled in the meantime, the execution is canceled at once.
+func (r *runningTasks) started(entry *run, executionID uint, cancel context.CancelFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry.executionID = executionID
+	entry.cancel = cancel
+	if entry.canceled {
+		cancel()
+	}
+}
+
+// finish releases the reservation of a task
+func (r *runningTasks) finish(taskID uint, entry *run) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.runs[taskID] == entry {
+		delete(r.runs, taskID)
+	}
+}
+
+// cancel requests a running task to stop and returns false if it is not
+// running. The task stays registered until its execution has finished.
+func (r *runningTasks) cancel(taskID uint, by string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, exists := r.runs[taskID]
+	if !exists {
+		return false
+	}
+	entry.stop(by)
+	return true
+}
+
+// cancelExecution requests a running execution to stop and returns its task,
+// or false if the execution is not running
+func (r *runningTasks) cancelExecution(executionID uint, by string) (uint, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for taskID, entry := range r.runs {
+		if entry.executionID == executionID && entry.cancel != nil {
+			entry.stop(by)
+			return taskID, true
+		}
+	}
+	return 0, false
+}
+
+// cancelAll requests all running tasks to stop and returns their IDs
+func (r *runningTasks) cancelAll() []uint {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	taskIDs := make([]uint, 0, len(r.runs))
+	for taskID, entry := range r.runs {
+		entry.stop("")
+		taskIDs = append(taskIDs, taskID)
+	}
+	return taskIDs
+}
+
+// abandon stops a running execution that this worker no longer holds and
+// returns false if it is not running
+func (r *runningTasks) abandon(executionID uint) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, entry := range r.runs {
+		if entry.executionID == executionID && entry.cancel != nil {
+			entry.abandoned = true
+			entry.cancel()
+			return true
+		}
+	}
+	return false
+}
+
+// isAbandoned reports whether a run was abandoned
+func (r *runningTasks) isAbandoned(entry *run) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return entry.abandoned
+}
+
+// executions returns the IDs of the started executions
+func (r *runningTasks) executions() []uint {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := make([]uint, 0, len(r.runs))
+	for _, entry := range r.runs {
+		if entry.cancel != nil {
+			ids = append(ids, entry.executionID)
+		}
+	}
+	return ids
+}
+
+// full reports whether the maximum of running tasks is reached
+func (r *runningTasks) full() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.max > 0 && len(r.runs) >= r.max
+}
+
+// count returns the number of running tasks
+func (r *runningTasks) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.runs)
+}
+
+// cancellation reports whether a run was canceled, by whom and when
+func (r *runningTasks) cancellation(entry *run) (by string, at time.Time, canceled bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return entry.canceledBy, entry.canceledAt, entry.canceled
+}
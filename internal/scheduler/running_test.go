@@ -0,0 +1,264 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"registry-sync/internal/clientpool"
+	"registry-sync/internal/db/models"
+	"registry-sync/internal/db/store"
+	"registry-sync/internal/websocket"
+)
+
+// contenders is the number of goroutines racing for the same task
+const contenders = 64
+
+func TestTryStartOnce(t *testing.T) {
+	r := newRunningTasks()
+
+	for round := 0; round < 20; round++ {
+		var (
+			wg      sync.WaitGroup
+			won     atomic.Int32
+			entries = make(chan *run, contenders)
+		)
+		for i := 0; i < contenders; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+
+				// Cancels and readers race with the starts
+				switch i % 4 {
+				case 1:
+					r.cancel(1, "test")
+				case 2:
+					r.cancelExecution(uint(round), "test")
+				case 3:
+					r.executions()
+					r.count()
+					r.full()
+				}
+
+				entry, err := r.tryStart(1)
+				if err != nil {
+					if !errors.Is(err, errAlreadyRunning) {
+						t.Errorf("tryStart: unexpected error %v", err)
+					}
+					return
+				}
+				won.Add(1)
+				entries <- entry
+			}(i)
+		}
+		wg.Wait()
+		close(entries)
+
+		if n := won.Load(); n != 1 {
+			t.Fatalf("round %d: %d starts won, want 1", round, n)
+		}
+
+		entry := <-entries
+		ctx, cancel := context.WithCancel(context.Background())
+		r.started(entry, uint(round), cancel)
+		if entry.canceled && ctx.Err() == nil {
+			t.Fatalf("round %d: run canceled before start was not canceled when started", round)
+		}
+		cancel()
+
+		// A stale entry must not release the task
+		r.finish(1, &run{})
+		if _, err := r.tryStart(1); !errors.Is(err, errAlreadyRunning) {
+			t.Fatalf("round %d: tryStart after stale finish: got %v, want errAlreadyRunning", round, err)
+		}
+		r.finish(1, entry)
+	}
+
+	if n := r.count(); n != 0 {
+		t.Fatalf("%d tasks still running, want 0", n)
+	}
+}
+
+func TestTryStartFinishCancel(t *testing.T) {
+	r := newRunningTasks()
+
+	var (
+		wg      sync.WaitGroup
+		holders atomic.Int32
+		starts  atomic.Int32
+	)
+	for i := 0; i < contenders; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			for j := 0; j < 200; j++ {
+				if i%8 == 0 {
+					r.cancel(1, "test")
+					r.cancelAll()
+					continue
+				}
+
+				entry, err := r.tryStart(1)
+				if err != nil {
+					continue
+				}
+				if n := holders.Add(1); n != 1 {
+					t.Errorf("%d holders of the task, want 1", n)
+				}
+				starts.Add(1)
+
+				_, cancel := context.WithCancel(context.Background())
+				r.started(entry, uint(i*1000+j), cancel)
+				r.cancellation(entry)
+
+				holders.Add(-1)
+				r.finish(1, entry)
+				cancel()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if starts.Load() == 0 {
+		t.Fatal("no start won")
+	}
+	if n := r.count(); n != 0 {
+		t.Fatalf("%d tasks still running, want 0", n)
+	}
+}
+
+func TestTryStartAtCapacity(t *testing.T) {
+	r := newRunningTasks()
+	r.setMax(3)
+
+	var (
+		wg       sync.WaitGroup
+		won      atomic.Int32
+		capacity atomic.Int32
+	)
+	for i := 0; i < contenders; i++ {
+		wg.Add(1)
+		go func(taskID uint) {
+			defer wg.Done()
+
+			_, err := r.tryStart(taskID)
+			switch {
+			case err == nil:
+				won.Add(1)
+			case errors.Is(err, errAtCapacity):
+				capacity.Add(1)
+			default:
+				t.Errorf("tryStart(%d): unexpected error %v", taskID, err)
+			}
+		}(uint(i + 1))
+	}
+	wg.Wait()
+
+	if n := won.Load(); n != 3 {
+		t.Fatalf("%d starts won, want 3", n)
+	}
+	if n := capacity.Load(); n != contenders-3 {
+		t.Fatalf("%d starts at capacity, want %d", n, contenders-3)
+	}
+	if !r.full() {
+		t.Fatal("full() = false at the maximum")
+	}
+}
+
+func TestExecuteTaskOnce(t *testing.T) {
+	// The source registry answers once released, so the execution keeps
+	// running while the starts race
+	release := make(chan struct{})
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer registry.Close()
+	defer close(release)
+
+	st, err := store.NewStore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	reg := &models.Registry{Name: "src", URL: registry.URL}
+	if err := st.CreateRegistry(reg); err != nil {
+		t.Fatal(err)
+	}
+	task := &models.SyncTask{
+		Name:           "race",
+		SourceRegistry: reg.ID,
+		SourceProject:  "library",
+		TargetRegistry: reg.ID,
+		TargetProject:  "mirror",
+	}
+	if err := st.CreateTask(task); err != nil {
+		t.Fatal(err)
+	}
+
+	hub := websocket.NewHub()
+	go hub.Run()
+	s := NewScheduler(st, hub, clientpool.New())
+
+	var (
+		wg  sync.WaitGroup
+		won atomic.Int32
+	)
+	for i := 0; i < contenders; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := s.ExecuteTask(context.Background(), task.ID)
+			if err != nil {
+				if !errors.Is(err, errAlreadyRunning) {
+					t.Errorf("ExecuteTask: unexpected error %v", err)
+				}
+				return
+			}
+			won.Add(1)
+		}()
+	}
+	wg.Wait()
+
+	if n := won.Load(); n != 1 {
+		t.Fatalf("%d executions started, want 1", n)
+	}
+	executions, err := st.ListExecutionsByTask(task.ID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(executions) != 1 {
+		t.Fatalf("%d executions recorded, want 1", len(executions))
+	}
+
+	if err := s.CancelTask(task.ID, "test"); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for s.running.count() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("execution did not finish after cancel")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	execution, err := st.GetExecution(executions[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if execution.Status != models.StatusCanceled {
+		t.Fatalf("execution status = %s, want %s", execution.Status, models.StatusCanceled)
+	}
+}
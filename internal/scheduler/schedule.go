@@ -0,0 +1,119 @@
+package scheduler
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"registry-sync/internal/db/models"
+)
+
+// cronParser accepts standard 5-field expressions, 6-field expressions with a
+// leading seconds field, descriptors such as @daily or @every 10m and an
+// optional CRON_TZ= prefix
+var cronParser = cron.NewParser(
+	cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
+)
+
+// maxPreviewRuns limits how many fire times NextRuns returns
+const maxPreviewRuns = 100
+
+// ParseSchedule parses a cron expression in the given timezone, empty means
+// the server's timezone. A CRON_TZ= prefix in the expression takes precedence
+// over the timezone.
+func ParseSchedule(expr, timezone string) (cron.Schedule, error) {
+	if timezone != "" {
+		if _, err := time.LoadLocation(timezone); err != nil {
+			return nil, fmt.Errorf("invalid timezone %q: %w", timezone, err)
+		}
+		if !strings.HasPrefix(expr, "CRON_TZ=") && !strings.HasPrefix(expr, "TZ=") {
+			expr = "CRON_TZ=" + timezone + " " + expr
+		}
+	}
+
+	schedule, err := cronParser.Parse(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron expression %q: %w", expr, err)
+	}
+	return schedule, nil
+}
+
+// NextRuns returns the next n fire times of a task's schedule after from,
+// in the schedule's timezone
+func NextRuns(task *models.SyncTask, from time.Time, n int) ([]time.Time, error) {
+	if task.CronExpression == "" {
+		return []time.Time{}, nil
+	}
+	schedule, err := ParseSchedule(task.CronExpression, task.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fire times are shown in the schedule's timezone
+	if spec, ok := schedule.(*cron.SpecSchedule); ok {
+		from = from.In(spec.Location)
+	}
+
+	if n > maxPreviewRuns {
+		n = maxPreviewRuns
+	}
+	runs := make([]time.Time, 0, n)
+	for next := from; len(runs) < n; {
+		next = schedule.Next(next)
+		if next.IsZero() {
+			break // the expression never matches again
+		}
+		runs = append(runs, next)
+	}
+	return runs, nil
+}
+
+// catchUp runs tasks once whose scheduled run was due while the server was
+// down, if their catch-up policy asks for it
+func (s *Scheduler) catchUp(tasks []models.SyncTask) {
+	now := time.Now()
+	for i := range tasks {
+		task := &tasks[i]
+		if task.CronExpression == "" || task.CatchUp != models.CatchUpRunOnce {
+			continue
+		}
+
+		// Tasks never triggered count from their creation
+		var last time.Time
+		if task.LastScheduledAt != nil {
+			last = *task.LastScheduledAt
+		} else {
+			last = task.CreatedAt
+		}
+		if last.IsZero() {
+			continue
+		}
+
+		schedule, err := ParseSchedule(task.CronExpression, task.Timezone)
+		if err != nil {
+			continue // already reported by ScheduleTask
+		}
+		missed := schedule.Next(last)
+		if missed.IsZero() || missed.After(now) {
+			continue
+		}
+
+		log.Printf("Catching up missed run of task %s, due at %s", task.Name, missed.Format(time.RFC3339))
+		s.fire(task.ID, task.Name)
+	}
+}
+
+// fire records a scheduled trigger of a task and runs it
+func (s *Scheduler) fire(taskID uint, name string) {
+	// Followers keep their schedules but leave the runs to the leader
+	if !s.IsLeader() {
+		return
+	}
+	if err := s.store.SetTaskLastScheduled(taskID, time.Now()); err != nil {
+		log.Printf("Failed to record schedule of task %s: %v", name, err)
+	}
+	s.trigger(taskID, name)
+}
@@ -3,39 +3,85 @@ package scheduler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/robfig/cron/v3"
 
+	"registry-sync/internal/clientpool"
 	"registry-sync/internal/db/models"
 	"registry-sync/internal/db/store"
 	"registry-sync/internal/websocket"
-	"registry-sync/pkg/config"
+	"registry-sync/pkg/blobcache"
 	"registry-sync/pkg/filter"
 	"registry-sync/pkg/notification"
 	"registry-sync/pkg/registry"
+	regsync "registry-sync/pkg/sync"
 )
 
 // Scheduler manages task scheduling and execution
 type Scheduler struct {
-	store   *store.Store
-	cron    *cron.Cron
-	hub     *websocket.Hub
-	running map[uint]context.CancelFunc // task_id -> cancel function
+	store     *store.Store
+	cron      *cron.Cron
+	hub       *websocket.Hub
+	running   *runningTasks    // tasks with an execution in progress
+	pool      *clientpool.Pool // registry clients shared by all tasks
+	blobCache *blobcache.Cache // shared by all tasks, nil if disabled
+	stopping  atomic.Bool      // set by Stop, executions canceled afterwards are interrupted
+	timeout   time.Duration    // maximum duration of executions of tasks without a timeout, 0 = unlimited
+	elected   bool             // leadership is decided by an election, see EnableElection
+	leading   atomic.Bool      // set while the scheduler leads, see IsLeader
+	remote    bool             // executions are run by worker processes, see EnableWorkers
+	workerID  string           // set if this process is a worker, see EnableWorker
+	lease     time.Duration    // duration of the worker's claims on executions
+	wake      chan struct{}    // makes the worker check the queue
+
+	heartbeatMu   sync.Mutex
+	lastHeartbeat time.Time // last time the worker renewed all its leases
+
+	entriesMu sync.Mutex
+	entries   map[uint]cron.EntryID // task_id -> cron entry of scheduled tasks
+
+	dispatchMu sync.Mutex  // serializes starting and canceling pending executions
+	dueTimer   *time.Timer // dispatches when the next postponed execution is due
 }
 
 // NewScheduler creates a new scheduler
-func NewScheduler(store *store.Store, hub *websocket.Hub) *Scheduler {
+func NewScheduler(store *store.Store, hub *websocket.Hub, pool *clientpool.Pool) *Scheduler {
 	return &Scheduler{
 		store:   store,
 		cron:    cron.New(),
 		hub:     hub,
-		running: make(map[uint]context.CancelFunc),
+		running: newRunningTasks(),
+		pool:    pool,
+		entries: make(map[uint]cron.EntryID),
 	}
 }
 
+// SetBlobCache enables a local blob cache that all tasks download through
+func (s *Scheduler) SetBlobCache(cache *blobcache.Cache) {
+	s.blobCache = cache
+}
+
+// SetExecutionTimeout sets the maximum duration of executions of tasks that
+// do not set their own timeout, 0 = unlimited. It must be called before Start.
+func (s *Scheduler) SetExecutionTimeout(timeout time.Duration) {
+	s.timeout = timeout
+}
+
+// executionTimeout returns the maximum duration of an execution of a task
+func (s *Scheduler) executionTimeout(task *models.SyncTask) time.Duration {
+	if task.Timeout > 0 {
+		return time.Duration(task.Timeout) * time.Second
+	}
+	return s.timeout
+}
+
 // Start starts the scheduler
 func (s *Scheduler) Start() error {
 	log.Println("Starting scheduler...")
@@ -56,6 +102,20 @@ func (s *Scheduler) Start() error {
 	}
 
 	s.cron.Start()
+
+	if s.remote {
+		go s.coordinate()
+	}
+
+	// Replicas wait for the election, see StartLeading
+	if s.elected {
+		log.Println("Scheduler started, waiting for leadership")
+		return nil
+	}
+	if err := s.lead(tasks); err != nil {
+		return err
+	}
+
 	log.Println("Scheduler started")
 	return nil
 }
@@ -63,49 +123,129 @@ func (s *Scheduler) Start() error {
 // Stop stops the scheduler
 func (s *Scheduler) Stop() {
 	log.Println("Stopping scheduler...")
+	s.stopping.Store(true)
 	s.cron.Stop()
 
 	// Cancel all running tasks
-	for taskID, cancel := range s.running {
+	for _, taskID := range s.running.cancelAll() {
 		log.Printf("Cancelling task %d", taskID)
-		cancel()
 	}
 
 	log.Println("Scheduler stopped")
 }
 
-// ScheduleTask schedules a task
+// ScheduleTask schedules a task, replacing its previous schedule
 func (s *Scheduler) ScheduleTask(task *models.SyncTask) error {
+	s.entriesMu.Lock()
+	defer s.entriesMu.Unlock()
+
+	s.unschedule(task.ID)
 	if task.CronExpression == "" {
 		return nil
 	}
 
-	_, err := s.cron.AddFunc(task.CronExpression, func() {
-		log.Printf("Cron triggered for task: %s", task.Name)
-		if err := s.ExecuteTask(context.Background(), task.ID); err != nil {
-			log.Printf("Failed to execute task %s: %v", task.Name, err)
-		}
-	})
-
+	schedule, err := ParseSchedule(task.CronExpression, task.Timezone)
 	if err != nil {
 		return fmt.Errorf("failed to add cron job: %w", err)
 	}
 
-	log.Printf("Scheduled task %s with cron: %s", task.Name, task.CronExpression)
+	taskID, name := task.ID, task.Name
+	s.entries[task.ID] = s.cron.Schedule(schedule, cron.FuncJob(func() {
+		log.Printf("Cron triggered for task: %s", name)
+		s.fire(taskID, name)
+	}))
+
+	if task.Timezone != "" {
+		log.Printf("Scheduled task %s with cron: %s (%s)", task.Name, task.CronExpression, task.Timezone)
+	} else {
+		log.Printf("Scheduled task %s with cron: %s", task.Name, task.CronExpression)
+	}
 	return nil
 }
 
+// Reschedule reloads a task and updates its cron schedule: enabled tasks
+// with a cron expression are (re)scheduled, others are unscheduled
+func (s *Scheduler) Reschedule(taskID uint) error {
+	task, err := s.store.GetTask(taskID)
+	if err != nil {
+		return fmt.Errorf("failed to load task: %w", err)
+	}
+	if !task.Enabled || task.CronExpression == "" {
+		s.Unschedule(taskID)
+		return nil
+	}
+
+	// Runs due before a schedule was enabled are not missed
+	s.entriesMu.Lock()
+	_, scheduled := s.entries[taskID]
+	s.entriesMu.Unlock()
+	if !scheduled {
+		if err := s.store.SetTaskLastScheduled(taskID, time.Now()); err != nil {
+			return fmt.Errorf("failed to record schedule: %w", err)
+		}
+	}
+
+	return s.ScheduleTask(task)
+}
+
+// Unschedule removes the cron schedule of a task. Running executions are
+// not affected.
+func (s *Scheduler) Unschedule(taskID uint) {
+	s.entriesMu.Lock()
+	defer s.entriesMu.Unlock()
+
+	if s.unschedule(taskID) {
+		log.Printf("Unscheduled task %d", taskID)
+	}
+}
+
+// unschedule removes the cron entry of a task, s.entriesMu must be held
+func (s *Scheduler) unschedule(taskID uint) bool {
+	entryID, exists := s.entries[taskID]
+	if !exists {
+		return false
+	}
+	s.cron.Remove(entryID)
+	delete(s.entries, taskID)
+	return true
+}
+
 // ExecuteTask executes a task immediately
 func (s *Scheduler) ExecuteTask(parentCtx context.Context, taskID uint) error {
-	// Check if task is already running
-	if _, exists := s.running[taskID]; exists {
-		return fmt.Errorf("task %d is already running", taskID)
+	_, err := s.executeTask(parentCtx, taskID, nil)
+	return err
+}
+
+// executeTask starts an execution of a task. If onlyTags is set, only these
+// repo:tag references are synced. If the maximum of running executions is
+// reached, the execution is queued as pending.
+func (s *Scheduler) executeTask(parentCtx context.Context, taskID uint, onlyTags []string) (*models.Execution, error) {
+	if !s.IsLeader() {
+		return nil, ErrNotLeader
+	}
+
+	// Workers run the execution, the task may be running on any of them
+	if s.remote {
+		if _, err := s.store.GetRunningExecution(taskID); err == nil {
+			return nil, fmt.Errorf("task %d: %w", taskID, errAlreadyRunning)
+		}
+		return s.enqueue(&models.Execution{TaskID: taskID, OnlyTags: onlyTags}, "等待 worker 执行")
+	}
+
+	// Reserve the task, so concurrent triggers can not start it twice
+	entry, err := s.running.tryStart(taskID)
+	if errors.Is(err, errAtCapacity) {
+		return s.enqueue(&models.Execution{TaskID: taskID, OnlyTags: onlyTags}, "达到最大并发执行数，排队等待")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("task %d: %w", taskID, err)
 	}
 
 	// Load task
 	task, err := s.store.GetTask(taskID)
 	if err != nil {
-		return fmt.Errorf("failed to load task: %w", err)
+		s.running.finish(taskID, entry)
+		return nil, fmt.Errorf("failed to load task: %w", err)
 	}
 
 	// Create execution record
@@ -113,26 +253,248 @@ func (s *Scheduler) ExecuteTask(parentCtx context.Context, taskID uint) error {
 		TaskID:    task.ID,
 		Status:    models.StatusRunning,
 		StartTime: time.Now(),
+		OnlyTags:  onlyTags,
 	}
 
 	if err := s.store.CreateExecution(execution); err != nil {
-		return fmt.Errorf("failed to create execution: %w", err)
+		s.running.finish(taskID, entry)
+		return nil, fmt.Errorf("failed to create execution: %w", err)
 	}
 
 	log.Printf("Started execution %d for task %s", execution.ID, task.Name)
 
-	// Create cancellable context
-	ctx, cancel := context.WithCancel(parentCtx)
-	s.running[taskID] = cancel
+	s.start(parentCtx, entry, task, execution)
+	return execution, nil
+}
+
+// ExecuteTags starts an execution of a task that syncs only the given
+// repo:tag references. If the task already has a queued execution, the
+// references are added to it instead; if the task is running, they are queued.
+func (s *Scheduler) ExecuteTags(parentCtx context.Context, taskID uint, refs []string, reason string) (*models.Execution, error) {
+	if !s.IsLeader() {
+		return nil, ErrNotLeader
+	}
+	if err := checkRefs(refs); err != nil {
+		return nil, err
+	}
+	if execution := s.mergePending(taskID, refs); execution != nil {
+		s.logExecution(execution.ID, models.LogLevelInfo, "%s，追加 %d 个 tag", reason, len(refs))
+		return execution, nil
+	}
+
+	execution, err := s.executeTask(parentCtx, taskID, refs)
+	if errors.Is(err, errAlreadyRunning) {
+		return s.enqueue(&models.Execution{TaskID: taskID, OnlyTags: refs}, "任务正在运行，排队等待")
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.logExecution(execution.ID, models.LogLevelInfo, "%s", reason)
+	return execution, nil
+}
+
+// ErrInvalidRef is returned for tag references that are not repo:tag
+var ErrInvalidRef = errors.New("invalid tag reference, expected repo:tag")
+
+// checkRefs returns ErrInvalidRef for the first malformed reference of refs
+func checkRefs(refs []string) error {
+	for _, ref := range refs {
+		if _, _, ok := models.SplitRef(ref); !ok {
+			return fmt.Errorf("%w: %q", ErrInvalidRef, ref)
+		}
+	}
+	return nil
+}
+
+// RetryFailed starts a new execution of the task of an execution that syncs
+// only the tags which failed in it, and returns the new execution
+func (s *Scheduler) RetryFailed(parentCtx context.Context, executionID uint) (*models.Execution, error) {
+	execution, err := s.store.GetExecution(executionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load execution: %w", err)
+	}
+	if !execution.IsComplete() {
+		return nil, fmt.Errorf("execution %d is still %s", execution.ID, execution.Status)
+	}
+
+	failed, err := s.store.ListExecutionImagesByStatus(execution.ID, models.ImageFailed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load failed tags: %w", err)
+	}
+	if len(failed) == 0 {
+		return nil, fmt.Errorf("execution %d has no failed tags", execution.ID)
+	}
+
+	refs := make([]string, len(failed))
+	for i, image := range failed {
+		refs[i] = image.Ref()
+	}
+	if err := checkRefs(refs); err != nil {
+		return nil, err
+	}
+
+	retried, err := s.executeTask(parentCtx, execution.TaskID, refs)
+	if err != nil {
+		return nil, err
+	}
+	s.logExecution(retried.ID, models.LogLevelInfo, "重试执行 #%d 中失败的 %d 个 tag", execution.ID, len(refs))
+	return retried, nil
+}
+
+// ResumeExecution continues an interrupted or timed out execution. Only the
+// tags it had not completed are synced; filters and totals are those of the
+// original run. A resumed execution gets the full timeout again.
+func (s *Scheduler) ResumeExecution(parentCtx context.Context, executionID uint) error {
+	if !s.IsLeader() {
+		return ErrNotLeader
+	}
+
+	execution, err := s.store.GetExecution(executionID)
+	if err != nil {
+		return fmt.Errorf("failed to load execution: %w", err)
+	}
+	if execution.Status != models.StatusInterrupted && execution.Status != models.StatusTimedOut {
+		return fmt.Errorf("execution %d is %s, only interrupted or timed out executions can be resumed", execution.ID, execution.Status)
+	}
+
+	// Failed blobs are retried, count them again
+	execution.Task = models.SyncTask{}
+	execution.Logs = nil
+	execution.EndTime = nil
+	execution.ErrorMessage = ""
+	execution.FailedBlobs = 0
+
+	// Workers continue the execution from the queue, any worker may claim it
+	if s.remote {
+		queued, err := s.store.RequeueEndedExecution(execution.ID, execution.Status)
+		if err != nil {
+			return fmt.Errorf("failed to update execution: %w", err)
+		}
+		if !queued {
+			return fmt.Errorf("execution %d is no longer %s", execution.ID, execution.Status)
+		}
+		log.Printf("Queued execution %d for resumption", execution.ID)
+		s.logExecution(execution.ID, models.LogLevelInfo, "恢复执行，等待 worker 执行")
+		s.dispatch()
+		return nil
+	}
+
+	// Reserve the task, so concurrent triggers can not start it twice
+	entry, err := s.running.tryStart(execution.TaskID)
+	if err != nil {
+		return fmt.Errorf("task %d: %w", execution.TaskID, err)
+	}
+
+	task, err := s.store.GetTask(execution.TaskID)
+	if err != nil {
+		s.running.finish(execution.TaskID, entry)
+		return fmt.Errorf("failed to load task: %w", err)
+	}
+
+	execution.Status = models.StatusRunning
+	if err := s.store.UpdateExecution(execution); err != nil {
+		s.running.finish(execution.TaskID, entry)
+		return fmt.Errorf("failed to update execution: %w", err)
+	}
+
+	log.Printf("Resumed execution %d for task %s", execution.ID, task.Name)
+	s.logExecution(execution.ID, models.LogLevelInfo, "恢复执行")
+
+	s.start(parentCtx, entry, task, execution)
+	return nil
+}
+
+// errTimedOut cancels executions that ran longer than their timeout
+var errTimedOut = errors.New("execution timed out")
+
+// start runs an execution of a reserved task in the background and
+// releases the task when it has finished
+func (s *Scheduler) start(parentCtx context.Context, entry *run, task *models.SyncTask, execution *models.Execution) {
+	// Create cancellable context, limited to the task's timeout
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+	timeout := s.executionTimeout(task)
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeoutCause(parentCtx, timeout, errTimedOut)
+	} else {
+		ctx, cancel = context.WithCancel(parentCtx)
+	}
+	s.running.started(entry, execution.ID, cancel)
 
 	// Run task in background
 	go func() {
 		defer func() {
-			delete(s.running, taskID)
+			cancel()
+			s.running.finish(task.ID, entry)
+			s.dispatch()
 		}()
 
 		startTime := execution.StartTime
-		if err := s.runTask(ctx, task, execution); err != nil {
+		err := s.runTask(ctx, task, execution)
+		canceledBy, canceledAt, canceled := s.running.cancellation(entry)
+		if s.running.isAbandoned(entry) {
+			// Another worker continues the execution, its record is not ours anymore
+			log.Printf("Task %s stopped, execution %d was re-queued", task.Name, execution.ID)
+			return
+		}
+		if err != nil && s.workerID != "" && s.stopping.Load() && ctx.Err() != nil {
+			log.Printf("Task %s interrupted, re-queuing execution %d", task.Name, execution.ID)
+
+			// Another worker continues the execution
+			if err := s.store.RequeueExecution(execution.ID, s.workerID); err != nil {
+				log.Printf("Failed to re-queue execution %d: %v", execution.ID, err)
+			}
+			s.logExecution(execution.ID, models.LogLevelWarn, "worker %s 停止，执行重新排队，由其他 worker 继续未完成的 tag", s.workerID)
+			return
+		}
+		if err != nil && (s.stopping.Load() || !s.IsLeader()) && ctx.Err() != nil {
+			log.Printf("Task %s interrupted: %v", task.Name, err)
+
+			// Leave the execution resumable
+			endTime := time.Now()
+			execution.Status = models.StatusInterrupted
+			execution.EndTime = &endTime
+			execution.ErrorMessage = err.Error()
+			s.store.UpdateExecution(execution)
+			if !s.stopping.Load() {
+				s.logExecution(execution.ID, models.LogLevelWarn, "本实例不再是调度 leader，执行被中断，可恢复执行以继续未完成的 tag")
+			}
+		} else if canceled {
+			log.Printf("Task %s canceled by %s", task.Name, canceledBy)
+
+			// Update execution status
+			endTime := time.Now()
+			execution.Status = models.StatusCanceled
+			execution.EndTime = &endTime
+			execution.CanceledBy = canceledBy
+			execution.CanceledAt = &canceledAt
+			s.store.UpdateExecution(execution)
+			s.logExecution(execution.ID, models.LogLevelWarn, "执行已被 %s 取消", canceledBy)
+
+			// Broadcast cancellation
+			s.hub.BroadcastLog(execution.ID, "warn", fmt.Sprintf("Task canceled by %s", canceledBy))
+
+			// Send notification if configured
+			s.sendNotification(task, string(execution.Status), endTime.Sub(startTime), execution)
+		} else if err != nil && errors.Is(context.Cause(ctx), errTimedOut) {
+			log.Printf("Task %s timed out after %v: %v", task.Name, timeout, err)
+
+			// Leave the execution resumable
+			endTime := time.Now()
+			execution.Status = models.StatusTimedOut
+			execution.EndTime = &endTime
+			execution.ErrorMessage = fmt.Sprintf("execution timed out after %v", timeout)
+			s.store.UpdateExecution(execution)
+			s.logExecution(execution.ID, models.LogLevelError, "执行超过最长时间 %v，已终止，可恢复执行以继续未完成的 tag", timeout)
+
+			// Broadcast timeout
+			s.hub.BroadcastLog(execution.ID, "error", fmt.Sprintf("Task timed out after %v", timeout))
+
+			// Send notification if configured
+			s.sendNotification(task, string(execution.Status), endTime.Sub(startTime), execution)
+		} else if err != nil {
 			log.Printf("Task %s failed: %v", task.Name, err)
 
 			// Update execution status
@@ -170,50 +532,51 @@ func (s *Scheduler) ExecuteTask(parentCtx context.Context, taskID uint) error {
 			"synced_blobs": execution.SyncedBlobs,
 			"progress":     execution.Progress(),
 		})
-	}()
 
-	return nil
+		// Continue the pipeline with the tasks that depend on this one
+		if execution.Status != models.StatusInterrupted {
+			s.triggerDependents(task, execution)
+		}
+	}()
 }
 
 // runTask runs the actual sync task
 func (s *Scheduler) runTask(ctx context.Context, task *models.SyncTask, execution *models.Execution) error {
-	// Load source and target registries
+	if task.IsLayoutSource() {
+		return s.runImport(ctx, task, execution)
+	}
+
+	// Load source registry
 	sourceReg, err := s.store.GetRegistry(task.SourceRegistry)
 	if err != nil {
 		return fmt.Errorf("failed to load source registry: %w", err)
 	}
 
-	targetReg, err := s.store.GetRegistry(task.TargetRegistry)
-	if err != nil {
-		return fmt.Errorf("failed to load target registry: %w", err)
+	targetNames := make([]string, 0, len(task.GetTargets()))
+	for _, target := range task.GetTargets() {
+		name := fmt.Sprintf("#%d", target.Registry)
+		if reg, err := s.store.GetRegistry(target.Registry); err == nil {
+			name = reg.Name
+		}
+		targetNames = append(targetNames, name+"/"+target.Project)
 	}
 
-	log.Printf("Starting sync: %s/%s -> %s/%s", sourceReg.Name, task.GetSourceRepoPath(), targetReg.Name, task.TargetProject)
+	log.Printf("Starting sync: %s/%s -> %s", sourceReg.Name, task.GetSourceRepoPath(), strings.Join(targetNames, ", "))
 
 	// Create execution log
 	s.store.CreateExecutionLog(&models.ExecutionLog{
 		ExecutionID: execution.ID,
 		Level:       models.LogLevelInfo,
-		Message:     fmt.Sprintf("开始同步: %s/%s -> %s/%s", sourceReg.Name, task.GetSourceRepoPath(), targetReg.Name, task.TargetProject),
+		Message:     fmt.Sprintf("开始同步: %s/%s -> %s", sourceReg.Name, task.GetSourceRepoPath(), strings.Join(targetNames, ", ")),
 		Timestamp:   time.Now(),
 	})
 
 	// Create registry clients
-	sourceClient := registry.NewClient(
-		config.NormalizeRegistryURL(sourceReg.URL),
-		sourceReg.Username,
-		sourceReg.Password,
-		sourceReg.Insecure,
-		sourceReg.RateLimit,
-	)
-
-	targetClient := registry.NewClient(
-		config.NormalizeRegistryURL(targetReg.URL),
-		targetReg.Username,
-		targetReg.Password,
-		targetReg.Insecure,
-		targetReg.RateLimit,
-	)
+	sourceClient := s.pool.Get(sourceReg).WithBandwidth(taskBandwidth(task))
+	sourceClient.BlobCache = s.blobCache
+	if task.Bandwidth != "" {
+		s.logExecution(execution.ID, models.LogLevelInfo, "任务带宽限制: %s", task.Bandwidth)
+	}
 
 	// Test connectivity
 	s.store.CreateExecutionLog(&models.ExecutionLog{
@@ -231,18 +594,17 @@ func (s *Scheduler) runTask(ctx context.Context, task *models.SyncTask, executio
 			Message:     errMsg,
 			Timestamp:   time.Now(),
 		})
-		return fmt.Errorf(errMsg)
+		return errors.New(errMsg)
 	}
 
-	if err := targetClient.PingCheck(ctx); err != nil {
-		errMsg := fmt.Sprintf("目标 Registry 连接失败: %v", err)
-		s.store.CreateExecutionLog(&models.ExecutionLog{
-			ExecutionID: execution.ID,
-			Level:       models.LogLevelError,
-			Message:     errMsg,
-			Timestamp:   time.Now(),
-		})
-		return fmt.Errorf(errMsg)
+	// 连接所有目标；失败的目标单独记录，不影响其他目标
+	targets := s.connectTargets(ctx, task, execution)
+	if len(targets) == 0 {
+		s.store.UpdateExecution(execution)
+		if len(execution.TargetResults) == 1 {
+			return errors.New(execution.TargetResults[0].Error)
+		}
+		return errors.New("所有目标 Registry 均不可用")
 	}
 
 	s.store.CreateExecutionLog(&models.ExecutionLog{
@@ -251,61 +613,54 @@ func (s *Scheduler) runTask(ctx context.Context, task *models.SyncTask, executio
 		Message:     "Registry 连接成功",
 		Timestamp:   time.Now(),
 	})
+	s.checkQuota(ctx, task, execution, sourceClient)
+	retry := s.retryPolicies(task, execution)
 
-	// 检查并创建目标项目
-	s.store.CreateExecutionLog(&models.ExecutionLog{
-		ExecutionID: execution.ID,
-		Level:       models.LogLevelInfo,
-		Message:     fmt.Sprintf("检查目标项目 %s 是否存在...", task.TargetProject),
-		Timestamp:   time.Now(),
-	})
+	onlyTags := make(map[string]bool, len(execution.OnlyTags))
+	for _, ref := range execution.OnlyTags {
+		onlyTags[ref] = true
+	}
+	if len(onlyTags) > 0 {
+		s.logExecution(execution.ID, models.LogLevelInfo, "本次仅同步指定的 %d 个 tag", len(onlyTags))
+	}
 
-	exists, err := targetClient.ProjectExists(ctx, task.TargetProject)
+	// 恢复执行时只同步上次未完成的 tag
+	images, err := s.store.ListExecutionImages(execution.ID)
 	if err != nil {
-		// 项目检查失败，记录警告但继续（可能不是 Harbor）
-		s.store.CreateExecutionLog(&models.ExecutionLog{
-			ExecutionID: execution.ID,
-			Level:       models.LogLevelInfo,
-			Message:     fmt.Sprintf("无法检查项目存在性（可能不是 Harbor）: %v", err),
-			Timestamp:   time.Now(),
-		})
-	} else if !exists {
-		s.store.CreateExecutionLog(&models.ExecutionLog{
-			ExecutionID: execution.ID,
-			Level:       models.LogLevelInfo,
-			Message:     fmt.Sprintf("目标项目 %s 不存在，正在创建...", task.TargetProject),
-			Timestamp:   time.Now(),
-		})
-
-		if err := targetClient.CreateProject(ctx, task.TargetProject, true); err != nil {
-			errMsg := fmt.Sprintf("创建目标项目失败: %v", err)
-			s.store.CreateExecutionLog(&models.ExecutionLog{
-				ExecutionID: execution.ID,
-				Level:       models.LogLevelError,
-				Message:     errMsg,
-				Timestamp:   time.Now(),
-			})
-			return fmt.Errorf(errMsg)
-		}
+		return fmt.Errorf("failed to load execution images: %w", err)
+	}
+	resuming := len(images) > 0
 
-		s.store.CreateExecutionLog(&models.ExecutionLog{
-			ExecutionID: execution.ID,
-			Level:       models.LogLevelInfo,
-			Message:     fmt.Sprintf("成功创建目标项目 %s", task.TargetProject),
-			Timestamp:   time.Now(),
-		})
-	} else {
-		s.store.CreateExecutionLog(&models.ExecutionLog{
-			ExecutionID: execution.ID,
-			Level:       models.LogLevelInfo,
-			Message:     fmt.Sprintf("目标项目 %s 已存在", task.TargetProject),
-			Timestamp:   time.Now(),
-		})
+	type imageRef struct {
+		repoName string
+		tag      string
 	}
+	var plan []imageRef
 
 	// 确定要同步的仓库列表
 	var repositories []string
-	if task.SourceRepo == "" {
+	if resuming {
+		for _, image := range images {
+			if image.Status != models.ImageSuccess {
+				plan = append(plan, imageRef{repoName: image.Repository, tag: image.Tag})
+			}
+		}
+		s.logExecution(execution.ID, models.LogLevelInfo, "恢复执行：已完成 %d 个 tag，剩余 %d 个", len(images)-len(plan), len(plan))
+	} else if task.SourceRepo == "" && len(onlyTags) > 0 {
+		// 只同步指定 tag 所在的仓库，无需列出整个项目
+		seen := make(map[string]bool)
+		for _, ref := range execution.OnlyTags {
+			repoName, _, ok := models.SplitRef(ref)
+			if !ok {
+				s.logExecution(execution.ID, models.LogLevelWarn, "跳过无效的 tag 引用 %q", ref)
+				continue
+			}
+			if !seen[repoName] {
+				seen[repoName] = true
+				repositories = append(repositories, repoName)
+			}
+		}
+	} else if task.SourceRepo == "" {
 		// 同步整个项目
 		s.store.CreateExecutionLog(&models.ExecutionLog{
 			ExecutionID: execution.ID,
@@ -314,7 +669,11 @@ func (s *Scheduler) runTask(ctx context.Context, task *models.SyncTask, executio
 			Timestamp:   time.Now(),
 		})
 
-		repos, err := sourceClient.ListRepositories(ctx, task.SourceProject)
+		var repos []string
+		err := retry.Retry(ctx, regsync.OpCatalog, func() (err error) {
+			repos, err = sourceClient.ListRepositories(ctx, task.SourceProject)
+			return err
+		})
 		if err != nil {
 			errMsg := fmt.Sprintf("获取仓库列表失败: %v", err)
 			s.store.CreateExecutionLog(&models.ExecutionLog{
@@ -323,7 +682,7 @@ func (s *Scheduler) runTask(ctx context.Context, task *models.SyncTask, executio
 				Message:     errMsg,
 				Timestamp:   time.Now(),
 			})
-			return fmt.Errorf(errMsg)
+			return errors.New(errMsg)
 		}
 		repositories = repos
 
@@ -357,16 +716,26 @@ func (s *Scheduler) runTask(ctx context.Context, task *models.SyncTask, executio
 		tag        string
 		manifest   *registry.Manifest
 		sourceRepo string
-		targetRepo string
 	}
 	var allRepoTags []repoTagInfo
 	totalBlobsCount := 0
 
+	// 拉取配额不足时未同步的 tag（repo:tag）
+	var deferred []string
+	var quota registry.PullQuota
+
 	for _, repoName := range repositories {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		sourceRepoPath := task.SourceProject + "/" + repoName
 
 		// List tags
-		tags, err := sourceClient.ListTags(ctx, sourceRepoPath)
+		var tags []string
+		err := retry.Retry(ctx, regsync.OpCatalog, func() (err error) {
+			tags, err = sourceClient.ListTags(ctx, sourceRepoPath)
+			return err
+		})
 		if err != nil {
 			s.store.CreateExecutionLog(&models.ExecutionLog{
 				ExecutionID: execution.ID,
@@ -398,49 +767,103 @@ func (s *Scheduler) runTask(ctx context.Context, task *models.SyncTask, executio
 		}
 
 		filteredTags := tagFilter.FilterTags(tagInfos)
-
-		// Get manifests and count blobs
 		for _, tag := range filteredTags {
-			manifest, err := sourceClient.GetManifest(ctx, sourceRepoPath, tag)
-			if err != nil {
-				s.store.CreateExecutionLog(&models.ExecutionLog{
-					ExecutionID: execution.ID,
-					Level:       models.LogLevelError,
-					Message:     fmt.Sprintf("获取 manifest 失败 (%s:%s): %v", sourceRepoPath, tag, err),
-					Timestamp:   time.Now(),
-				})
+			if len(onlyTags) > 0 && !onlyTags[repoName+":"+tag] {
 				continue
 			}
+			plan = append(plan, imageRef{repoName: repoName, tag: tag})
+		}
+	}
 
-			// Count blobs including multi-arch manifests
-			blobCount := 0
-			if manifest.IsManifestList() {
-				// For manifest list, count sub-manifests + their blobs
-				blobCount += len(manifest.Manifests) // Sub-manifests themselves are blobs
-				for range manifest.Manifests {
-					// We'll fetch sub-manifests during sync to count their blobs
-					// For now, estimate based on typical image (config + layers)
-					blobCount += 10 // Rough estimate per architecture
-				}
-			} else {
-				blobs := manifest.GetAllBlobs()
-				blobCount = len(blobs)
+	// 记录本次执行的所有 tag，作为恢复执行的检查点
+	if resuming {
+		seen := make(map[string]bool)
+		for _, ref := range plan {
+			if !seen[ref.repoName] {
+				seen[ref.repoName] = true
+				repositories = append(repositories, ref.repoName)
 			}
+		}
+	} else {
+		images = make([]models.ExecutionImage, len(plan))
+		for i, ref := range plan {
+			images[i] = models.ExecutionImage{ExecutionID: execution.ID, Repository: ref.repoName, Tag: ref.tag, Status: models.ImagePending}
+		}
+		if err := s.store.CreateExecutionImages(images); err != nil {
+			s.logExecution(execution.ID, models.LogLevelWarn, "保存执行检查点失败，中断后将无法恢复: %v", err)
+		}
+	}
 
-			totalBlobsCount += blobCount
+	// Get manifests and count blobs
+	for _, image := range plan {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		repoName, tag := image.repoName, image.tag
+		ref := repoName + ":" + tag
+		sourceRepoPath := task.SourceProject + "/" + repoName
 
-			allRepoTags = append(allRepoTags, repoTagInfo{
-				repoName:   repoName,
-				tag:        tag,
-				manifest:   manifest,
-				sourceRepo: sourceRepoPath,
-				targetRepo: task.GetTargetRepoPath(repoName),
+		// 获取 manifest 会消耗拉取配额，配额不足时不再获取
+		if q, low := quotaLow(task, sourceClient); low {
+			quota = q
+			deferred = append(deferred, ref)
+			s.store.SetExecutionImageStatus(execution.ID, repoName, tag, models.ImageSkipped, "拉取配额不足")
+			continue
+		}
+
+		var manifest *registry.Manifest
+		err := retry.Retry(ctx, regsync.OpManifest, func() (err error) {
+			manifest, err = sourceClient.GetManifest(ctx, sourceRepoPath, tag)
+			return err
+		})
+		if err != nil {
+			s.store.CreateExecutionLog(&models.ExecutionLog{
+				ExecutionID: execution.ID,
+				Level:       models.LogLevelError,
+				Message:     fmt.Sprintf("获取 manifest 失败 (%s:%s): %v", sourceRepoPath, tag, err),
+				Timestamp:   time.Now(),
+			})
+			s.store.SaveExecutionImageResult(&models.ExecutionImage{
+				ExecutionID: execution.ID,
+				Repository:  repoName,
+				Tag:         tag,
+				Status:      models.ImageFailed,
+				Error:       fmt.Sprintf("获取 manifest 失败: %v", err),
+				ErrorCode:   registry.ErrorCode(err),
+				SourceRef:   fullRef(sourceClient, sourceRepoPath, tag),
 			})
+			continue
 		}
+
+		// Count blobs including multi-arch manifests
+		blobCount := 0
+		if manifest.IsManifestList() {
+			// For manifest list, count sub-manifests + their blobs
+			blobCount += len(manifest.Manifests) // Sub-manifests themselves are blobs
+			for range manifest.Manifests {
+				// We'll fetch sub-manifests during sync to count their blobs
+				// For now, estimate based on typical image (config + layers)
+				blobCount += 10 // Rough estimate per architecture
+			}
+		} else {
+			blobs := manifest.GetAllBlobs()
+			blobCount = len(blobs)
+		}
+
+		totalBlobsCount += blobCount
+
+		allRepoTags = append(allRepoTags, repoTagInfo{
+			repoName:   repoName,
+			tag:        tag,
+			manifest:   manifest,
+			sourceRepo: sourceRepoPath,
+		})
 	}
 
-	// 设置总 blob 数
-	execution.TotalBlobs = totalBlobsCount
+	// 设置总 blob 数；恢复执行时沿用原来的总数
+	if !resuming {
+		execution.TotalBlobs = totalBlobsCount
+	}
 	s.store.UpdateExecution(execution)
 
 	s.store.CreateExecutionLog(&models.ExecutionLog{
@@ -453,15 +876,29 @@ func (s *Scheduler) runTask(ctx context.Context, task *models.SyncTask, executio
 	// 第二步：遍历所有仓库进行同步
 	currentRepo := ""
 	for tagIndex, repoTag := range allRepoTags {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		// manifest list 的各平台 manifest 还需再拉取，配额不足时推迟
+		if q, low := quotaLow(task, sourceClient); low && repoTag.manifest.IsManifestList() {
+			quota = q
+			deferred = append(deferred, repoTag.repoName+":"+repoTag.tag)
+			s.store.SetExecutionImageStatus(execution.ID, repoTag.repoName, repoTag.tag, models.ImageSkipped, "拉取配额不足")
+			continue
+		}
+
 		// 如果是新仓库，输出仓库信息
 		if repoTag.repoName != currentRepo {
 			currentRepo = repoTag.repoName
-			s.store.CreateExecutionLog(&models.ExecutionLog{
-				ExecutionID: execution.ID,
-				Level:       models.LogLevelInfo,
-				Message:     fmt.Sprintf("开始同步仓库: %s -> %s", repoTag.sourceRepo, repoTag.targetRepo),
-				Timestamp:   time.Now(),
-			})
+			for _, target := range targets {
+				s.store.CreateExecutionLog(&models.ExecutionLog{
+					ExecutionID: execution.ID,
+					Level:       models.LogLevelInfo,
+					Message:     fmt.Sprintf("%s开始同步仓库: %s -> %s", target.prefix, repoTag.sourceRepo, target.target.RepoPath(repoTag.repoName)),
+					Timestamp:   time.Now(),
+				})
+			}
 		}
 
 		s.store.CreateExecutionLog(&models.ExecutionLog{
@@ -471,230 +908,174 @@ func (s *Scheduler) runTask(ctx context.Context, task *models.SyncTask, executio
 			Timestamp:   time.Now(),
 		})
 
-		// Track failed blobs for this tag
-		tagFailedBlobs := 0
+		image := s.syncTag(ctx, execution, retry, sourceClient, targets, repoTag.repoName, repoTag.sourceRepo, repoTag.tag, repoTag.manifest)
+		if ctx.Err() != nil {
+			// 被取消的 tag 保持待同步状态，恢复执行时重新同步
+			return ctx.Err()
+		}
+		if err := s.store.SaveExecutionImageResult(image); err != nil {
+			s.logExecution(execution.ID, models.LogLevelWarn, "保存 %s:%s 的同步结果失败: %v", repoTag.repoName, repoTag.tag, err)
+		}
+	}
 
-		// Handle multi-arch manifest list
-		if repoTag.manifest.IsManifestList() {
-			s.store.CreateExecutionLog(&models.ExecutionLog{
-				ExecutionID: execution.ID,
-				Level:       models.LogLevelInfo,
-				Message:     fmt.Sprintf("检测到多架构镜像 (manifest list)，包含 %d 个平台", len(repoTag.manifest.Manifests)),
-				Timestamp:   time.Now(),
-			})
+	targetsErr := s.finishTargets(execution, targets)
 
-			// Sync each sub-manifest and its blobs
-			for _, subManifestEntry := range repoTag.manifest.Manifests {
-				platform := fmt.Sprintf("%s/%s", subManifestEntry.Platform.OS, subManifestEntry.Platform.Architecture)
-				s.store.CreateExecutionLog(&models.ExecutionLog{
-					ExecutionID: execution.ID,
-					Level:       models.LogLevelInfo,
-					Message:     fmt.Sprintf("同步平台 %s 的 manifest", platform),
-					Timestamp:   time.Now(),
-				})
+	s.store.CreateExecutionLog(&models.ExecutionLog{
+		ExecutionID: execution.ID,
+		Level:       models.LogLevelInfo,
+		Message:     fmt.Sprintf("全部完成！共同步 %d 个 blob，跳过 %d 个，失败 %d 个", execution.SyncedBlobs, execution.SkippedBlobs, execution.FailedBlobs),
+		Timestamp:   time.Now(),
+	})
+	if s.blobCache != nil {
+		s.logExecution(execution.ID, models.LogLevelInfo, "blob 缓存命中 %d 个，未命中 %d 个", execution.CacheHits, execution.CacheMisses)
+	}
 
-				// Fetch the sub-manifest to get its blobs
-				subManifest, err := sourceClient.GetManifest(ctx, repoTag.sourceRepo, subManifestEntry.Digest)
-				if err != nil {
-					s.store.CreateExecutionLog(&models.ExecutionLog{
-						ExecutionID: execution.ID,
-						Level:       models.LogLevelError,
-						Message:     fmt.Sprintf("获取子 manifest 失败 (%s): %v", platform, err),
-						Timestamp:   time.Now(),
-					})
-					execution.FailedBlobs++
-					tagFailedBlobs++
-					continue
-				}
-
-				// Sync blobs from sub-manifest (config + layers)
-				subBlobs := subManifest.GetAllBlobs()
-				subPlatformFailed := 0
-
-				for _, blob := range subBlobs {
-					exists, _, err := targetClient.BlobExists(ctx, repoTag.targetRepo, blob.Digest)
-					if err != nil {
-						s.store.CreateExecutionLog(&models.ExecutionLog{
-							ExecutionID: execution.ID,
-							Level:       models.LogLevelError,
-							Message:     fmt.Sprintf("检查 blob 失败 (%s, %s): %v", platform, blob.Digest[:12], err),
-							Timestamp:   time.Now(),
-						})
-						execution.FailedBlobs++
-						tagFailedBlobs++
-						subPlatformFailed++
-						continue
-					}
-
-					if exists {
-						execution.SkippedBlobs++
-						execution.SyncedBlobs++
-					} else {
-						err = registry.CopyBlob(ctx, sourceClient, targetClient, repoTag.sourceRepo, repoTag.targetRepo, blob.Digest, blob.Size)
-						if err != nil {
-							s.store.CreateExecutionLog(&models.ExecutionLog{
-								ExecutionID: execution.ID,
-								Level:       models.LogLevelError,
-								Message:     fmt.Sprintf("复制 blob 失败 (%s, %s): %v", platform, blob.Digest[:12], err),
-								Timestamp:   time.Now(),
-							})
-							execution.FailedBlobs++
-							tagFailedBlobs++
-							subPlatformFailed++
-						} else {
-							execution.SyncedBlobs++
-							execution.SyncedSize += blob.Size
-						}
-					}
-					s.store.UpdateExecution(execution)
-
-					// Broadcast progress
-					s.hub.BroadcastProgress(execution.ID, map[string]interface{}{
-						"total_blobs":  execution.TotalBlobs,
-						"synced_blobs": execution.SyncedBlobs,
-						"progress":     execution.Progress(),
-					})
-				}
-
-				// Only upload sub-manifest if all its blobs succeeded
-				if subPlatformFailed == 0 {
-					// Upload sub-manifest to target (use digest as reference)
-					_, err = targetClient.PutManifest(ctx, repoTag.targetRepo, subManifestEntry.Digest, subManifest)
-					if err != nil {
-						s.store.CreateExecutionLog(&models.ExecutionLog{
-							ExecutionID: execution.ID,
-							Level:       models.LogLevelError,
-							Message:     fmt.Sprintf("上传子 manifest 失败 (%s): %v", platform, err),
-							Timestamp:   time.Now(),
-						})
-						tagFailedBlobs++
-					} else {
-						s.store.CreateExecutionLog(&models.ExecutionLog{
-							ExecutionID: execution.ID,
-							Level:       models.LogLevelInfo,
-							Message:     fmt.Sprintf("平台 %s manifest 同步完成", platform),
-							Timestamp:   time.Now(),
-						})
-					}
-				} else {
-					s.store.CreateExecutionLog(&models.ExecutionLog{
-						ExecutionID: execution.ID,
-						Level:       models.LogLevelError,
-						Message:     fmt.Sprintf("平台 %s 有 %d 个 blob 失败，跳过子 manifest 上传", platform, subPlatformFailed),
-						Timestamp:   time.Now(),
-					})
-				}
-			}
-		} else {
-			// Handle single-arch manifest
-			blobs := repoTag.manifest.GetAllBlobs()
+	if len(deferred) > 0 {
+		if err := s.deferTags(task, execution, quota, deferred); err != nil {
+			return err
+		}
+	}
 
-			s.store.CreateExecutionLog(&models.ExecutionLog{
-				ExecutionID: execution.ID,
-				Level:       models.LogLevelInfo,
-				Message:     fmt.Sprintf("tag %s 有 %d 个 blob", repoTag.tag, len(blobs)),
-				Timestamp:   time.Now(),
-			})
+	return targetsErr
+}
 
-			// Sync blobs
-			for _, blob := range blobs {
-				// Check if exists
-				exists, _, err := targetClient.BlobExists(ctx, repoTag.targetRepo, blob.Digest)
-				if err != nil {
-					s.store.CreateExecutionLog(&models.ExecutionLog{
-						ExecutionID: execution.ID,
-						Level:       models.LogLevelError,
-						Message:     fmt.Sprintf("检查 blob 失败 (%s): %v", blob.Digest[:12], err),
-						Timestamp:   time.Now(),
-					})
-					execution.FailedBlobs++
-					tagFailedBlobs++
-					continue
-				}
-
-				if exists {
-					execution.SkippedBlobs++
-					execution.SyncedBlobs++
-				} else {
-					// Copy blob
-					err = registry.CopyBlob(ctx, sourceClient, targetClient, repoTag.sourceRepo, repoTag.targetRepo, blob.Digest, blob.Size)
-					if err != nil {
-						s.store.CreateExecutionLog(&models.ExecutionLog{
-							ExecutionID: execution.ID,
-							Level:       models.LogLevelError,
-							Message:     fmt.Sprintf("复制 blob 失败 (%s): %v", blob.Digest[:12], err),
-							Timestamp:   time.Now(),
-						})
-						execution.FailedBlobs++
-						tagFailedBlobs++
-					} else {
-						execution.SyncedBlobs++
-						execution.SyncedSize += blob.Size
-					}
-				}
-				s.store.UpdateExecution(execution)
-
-				// Broadcast progress
-				s.hub.BroadcastProgress(execution.ID, map[string]interface{}{
-					"total_blobs":  execution.TotalBlobs,
-					"synced_blobs": execution.SyncedBlobs,
-					"progress":     execution.Progress(),
-				})
-			}
-		}
+// ensureTargetProject checks whether the target project exists and creates it if needed
+func (s *Scheduler) ensureTargetProject(ctx context.Context, execution *models.Execution, targetClient *registry.Client, project string) error {
+	s.store.CreateExecutionLog(&models.ExecutionLog{
+		ExecutionID: execution.ID,
+		Level:       models.LogLevelInfo,
+		Message:     fmt.Sprintf("检查目标项目 %s 是否存在...", project),
+		Timestamp:   time.Now(),
+	})
 
-		// Only upload manifest if all blobs succeeded
-		if tagFailedBlobs > 0 {
-			s.store.CreateExecutionLog(&models.ExecutionLog{
-				ExecutionID: execution.ID,
-				Level:       models.LogLevelError,
-				Message:     fmt.Sprintf("tag %s 有 %d 个 blob 失败，跳过 manifest 上传", repoTag.tag, tagFailedBlobs),
-				Timestamp:   time.Now(),
-			})
-			continue
-		}
+	exists, err := targetClient.ProjectExists(ctx, project)
+	if err != nil {
+		// 项目检查失败，记录警告但继续（可能不是 Harbor）
+		s.store.CreateExecutionLog(&models.ExecutionLog{
+			ExecutionID: execution.ID,
+			Level:       models.LogLevelInfo,
+			Message:     fmt.Sprintf("无法检查项目存在性（可能不是 Harbor）: %v", err),
+			Timestamp:   time.Now(),
+		})
+	} else if !exists {
+		s.store.CreateExecutionLog(&models.ExecutionLog{
+			ExecutionID: execution.ID,
+			Level:       models.LogLevelInfo,
+			Message:     fmt.Sprintf("目标项目 %s 不存在，正在创建...", project),
+			Timestamp:   time.Now(),
+		})
 
-		// Upload manifest
-		_, err = targetClient.PutManifest(ctx, repoTag.targetRepo, repoTag.tag, repoTag.manifest)
-		if err != nil {
+		if err := targetClient.CreateProject(ctx, project, true); err != nil {
+			errMsg := fmt.Sprintf("创建目标项目失败: %v", err)
 			s.store.CreateExecutionLog(&models.ExecutionLog{
 				ExecutionID: execution.ID,
 				Level:       models.LogLevelError,
-				Message:     fmt.Sprintf("上传 manifest 失败 (%s): %v", repoTag.tag, err),
+				Message:     errMsg,
 				Timestamp:   time.Now(),
 			})
-			continue
+			return errors.New(errMsg)
 		}
 
 		s.store.CreateExecutionLog(&models.ExecutionLog{
 			ExecutionID: execution.ID,
 			Level:       models.LogLevelInfo,
-			Message:     fmt.Sprintf("tag %s 同步完成", repoTag.tag),
+			Message:     fmt.Sprintf("成功创建目标项目 %s", project),
+			Timestamp:   time.Now(),
+		})
+	} else {
+		s.store.CreateExecutionLog(&models.ExecutionLog{
+			ExecutionID: execution.ID,
+			Level:       models.LogLevelInfo,
+			Message:     fmt.Sprintf("目标项目 %s 已存在", project),
 			Timestamp:   time.Now(),
 		})
 	}
 
+	return nil
+}
+
+// countCacheUse records blob cache hits and misses of a blob copy
+func (s *Scheduler) countCacheUse(execution *models.Execution, result registry.CopyResult) {
+	if result.CacheHit {
+		execution.CacheHits++
+	}
+	if result.Cached {
+		execution.CacheMisses++
+	}
+}
+
+// logExecution writes an execution log entry
+func (s *Scheduler) logExecution(executionID uint, level models.LogLevel, format string, args ...interface{}) {
 	s.store.CreateExecutionLog(&models.ExecutionLog{
-		ExecutionID: execution.ID,
-		Level:       models.LogLevelInfo,
-		Message:     fmt.Sprintf("全部完成！共同步 %d 个 blob，跳过 %d 个，失败 %d 个", execution.SyncedBlobs, execution.SkippedBlobs, execution.FailedBlobs),
+		ExecutionID: executionID,
+		Level:       level,
+		Message:     fmt.Sprintf(format, args...),
 		Timestamp:   time.Now(),
 	})
+}
+
+// CancelTask cancels the running and queued executions of a task. by names
+// who canceled them and is recorded in the executions, which end as canceled.
+func (s *Scheduler) CancelTask(taskID uint, by string) error {
+	if !s.IsLeader() {
+		return ErrNotLeader
+	}
 
+	running := s.cancelRunning(taskID, by)
+	queued := s.cancelPending(taskID, 0, by)
+	if !running && queued == 0 {
+		return fmt.Errorf("task %d is not running", taskID)
+	}
+
+	log.Printf("Cancelled task %d", taskID)
 	return nil
 }
 
-// CancelTask cancels a running task
-func (s *Scheduler) CancelTask(taskID uint) error {
-	cancel, exists := s.running[taskID]
-	if !exists {
-		return fmt.Errorf("task %d is not running", taskID)
+// cancelRunning cancels the running execution of a task and returns false if
+// the task is not running. Workers are asked to cancel executions they run.
+func (s *Scheduler) cancelRunning(taskID uint, by string) bool {
+	if !s.remote {
+		return s.running.cancel(taskID, by)
 	}
 
-	cancel()
-	delete(s.running, taskID)
+	requested, err := s.store.RequestCancel(taskID, 0, by)
+	if err != nil {
+		log.Printf("Failed to request cancel of task %d: %v", taskID, err)
+		return false
+	}
+	if requested > 0 {
+		log.Printf("Requested cancel of task %d", taskID)
+	}
+	return requested > 0
+}
 
-	log.Printf("Cancelled task %d", taskID)
+// CancelExecution cancels a running or queued execution, see CancelTask
+func (s *Scheduler) CancelExecution(executionID uint, by string) error {
+	if !s.IsLeader() {
+		return ErrNotLeader
+	}
+
+	if s.remote {
+		requested, err := s.store.RequestCancel(0, executionID, by)
+		if err != nil {
+			return fmt.Errorf("failed to request cancel: %w", err)
+		}
+		if requested > 0 {
+			log.Printf("Requested cancel of execution %d", executionID)
+			return nil
+		}
+	}
+
+	taskID, ok := s.running.cancelExecution(executionID, by)
+	if !ok {
+		if s.cancelPending(0, executionID, by) > 0 {
+			log.Printf("Cancelled queued execution %d", executionID)
+			return nil
+		}
+		return fmt.Errorf("execution %d is not running", executionID)
+	}
+
+	log.Printf("Cancelled execution %d of task %d", executionID, taskID)
 	return nil
 }
 
@@ -705,8 +1086,9 @@ func (s *Scheduler) sendNotification(task *models.SyncTask, status string, durat
 		return
 	}
 
-	// Check notification condition
-	if task.NotificationCondition == "failed" && status != string(models.StatusFailed) {
+	// Check notification condition, a timeout is a failure
+	failed := status == string(models.StatusFailed) || status == string(models.StatusTimedOut)
+	if task.NotificationCondition == "failed" && !failed {
 		log.Printf("Skipping notification for task %s: status is %s but condition is 'failed'", task.Name, status)
 		return
 	}
@@ -733,9 +1115,12 @@ func (s *Scheduler) sendNotification(task *models.SyncTask, status string, durat
 		"failed_blobs":  execution.FailedBlobs,
 	}
 
-	if status == string(models.StatusFailed) {
+	if failed {
 		stats["error"] = execution.ErrorMessage
 	}
+	if status == string(models.StatusCanceled) {
+		stats["canceled_by"] = execution.CanceledBy
+	}
 
 	// Send to each channel
 	for _, channelID := range channelIDs {
@@ -0,0 +1,288 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"registry-sync/internal/db/models"
+)
+
+// relayInterval is how often API servers relay the progress of executions
+// run by workers to their WebSocket clients
+const relayInterval = 2 * time.Second
+
+// WorkerStatus is the state of a worker process
+type WorkerStatus struct {
+	ID            string     `json:"id"`
+	Executions    []uint     `json:"executions"` // executions this worker is running
+	LastHeartbeat *time.Time `json:"last_heartbeat,omitempty"`
+}
+
+// EnableWorkers makes the scheduler queue all executions for worker
+// processes instead of running them itself, see EnableWorker. It must be
+// called before Start.
+func (s *Scheduler) EnableWorkers() {
+	s.remote = true
+}
+
+// EnableWorker makes the scheduler a worker named id that runs executions
+// queued by API servers, see RunWorker. Executions are claimed with a lease
+// of the given duration that the worker renews while it runs them. It must
+// be called before RunWorker.
+func (s *Scheduler) EnableWorker(id string, lease time.Duration) {
+	s.remote = true
+	s.workerID = id
+	s.lease = lease
+	s.wake = make(chan struct{}, 1)
+}
+
+// RunWorker claims and runs queued executions until ctx is canceled. The
+// queue is polled every poll interval and whenever an execution finishes;
+// leases are renewed every third of their duration. On return, running
+// executions are stopped and re-queued for other workers.
+func (s *Scheduler) RunWorker(ctx context.Context, poll time.Duration) {
+	log.Printf("Worker %s started", s.workerID)
+	s.heartbeatMu.Lock()
+	s.lastHeartbeat = time.Now()
+	s.heartbeatMu.Unlock()
+
+	pollTicker := time.NewTicker(poll)
+	defer pollTicker.Stop()
+	heartbeatTicker := time.NewTicker(s.lease / 3)
+	defer heartbeatTicker.Stop()
+
+	s.claim()
+	for {
+		select {
+		case <-ctx.Done():
+			s.Stop()
+
+			// Give the executions a moment to be re-queued, expired leases
+			// cover those that do not make it
+			deadline := time.Now().Add(5 * time.Second)
+			for s.running.count() > 0 && time.Now().Before(deadline) {
+				time.Sleep(100 * time.Millisecond)
+			}
+			log.Printf("Worker %s stopped", s.workerID)
+			return
+		case <-heartbeatTicker.C:
+			s.heartbeat()
+		case <-pollTicker.C:
+			s.requeueExpired()
+			s.cancelRequested()
+			s.claim()
+		case <-s.wake:
+			s.claim()
+		}
+	}
+}
+
+// WorkerStatus returns the state of the worker
+func (s *Scheduler) WorkerStatus() WorkerStatus {
+	status := WorkerStatus{ID: s.workerID, Executions: s.running.executions()}
+
+	s.heartbeatMu.Lock()
+	defer s.heartbeatMu.Unlock()
+	if !s.lastHeartbeat.IsZero() {
+		last := s.lastHeartbeat
+		status.LastHeartbeat = &last
+	}
+	return status
+}
+
+// wakeWorker makes the worker check the queue without waiting for the next
+// poll
+func (s *Scheduler) wakeWorker() {
+	if s.wake == nil {
+		return
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// claim starts queued executions until the queue is empty or the maximum of
+// running executions is reached
+func (s *Scheduler) claim() {
+	for !s.stopping.Load() && !s.running.full() {
+		execution, err := s.store.ClaimExecution(s.workerID, s.lease)
+		if err != nil {
+			log.Printf("Failed to claim execution: %v", err)
+			return
+		}
+		if execution == nil {
+			return
+		}
+
+		// The previous execution of the task may still be finishing here
+		entry, err := s.running.tryStart(execution.TaskID)
+		if err != nil {
+			if err := s.store.RequeueExecution(execution.ID, s.workerID); err != nil {
+				log.Printf("Failed to release execution %d: %v", execution.ID, err)
+			}
+			return
+		}
+
+		task, err := s.store.GetTask(execution.TaskID)
+		if err != nil {
+			s.running.finish(execution.TaskID, entry)
+
+			endTime := time.Now()
+			execution.Status = models.StatusFailed
+			execution.EndTime = &endTime
+			execution.ErrorMessage = "failed to load task: " + err.Error()
+			s.store.UpdateExecution(execution)
+			continue
+		}
+
+		log.Printf("Worker %s claimed execution %d for task %s", s.workerID, execution.ID, task.Name)
+		s.logExecution(execution.ID, models.LogLevelInfo, "由 worker %s 执行", s.workerID)
+
+		s.start(context.Background(), entry, task, execution)
+	}
+}
+
+// heartbeat renews the leases of the running executions. Executions the
+// worker no longer holds are stopped without recording a result, as they are
+// continued elsewhere; so are all executions once no lease could be renewed
+// for a whole lease duration.
+func (s *Scheduler) heartbeat() {
+	failed := false
+	for _, executionID := range s.running.executions() {
+		held, err := s.store.RenewExecutionLease(executionID, s.workerID, s.lease)
+		if err != nil {
+			log.Printf("Failed to renew lease of execution %d: %v", executionID, err)
+			failed = true
+			continue
+		}
+		if !held {
+			log.Printf("Worker %s lost execution %d, it was re-queued", s.workerID, executionID)
+			s.running.abandon(executionID)
+		}
+	}
+
+	s.heartbeatMu.Lock()
+	defer s.heartbeatMu.Unlock()
+	if !failed {
+		s.lastHeartbeat = time.Now()
+		return
+	}
+	if time.Since(s.lastHeartbeat) > s.lease {
+		for _, executionID := range s.running.executions() {
+			log.Printf("Lease of execution %d expired, stopping it", executionID)
+			s.running.abandon(executionID)
+		}
+	}
+}
+
+// cancelRequested cancels the running executions that API servers asked
+// this worker to cancel
+func (s *Scheduler) cancelRequested() {
+	requested, err := s.store.ListCancelRequests(s.workerID)
+	if err != nil {
+		log.Printf("Failed to load cancel requests: %v", err)
+		return
+	}
+	for _, execution := range requested {
+		if taskID, ok := s.running.cancelExecution(execution.ID, execution.CancelRequest); ok {
+			log.Printf("Cancelled execution %d of task %d", execution.ID, taskID)
+		}
+	}
+}
+
+// requeueExpired puts the executions of workers that stopped renewing their
+// lease back into the queue
+func (s *Scheduler) requeueExpired() {
+	requeued, err := s.store.RequeueExpiredExecutions()
+	if err != nil {
+		log.Printf("Failed to re-queue expired executions: %v", err)
+	}
+	for _, execution := range requeued {
+		log.Printf("Lease of worker %s on execution %d expired, re-queued", execution.Worker, execution.ID)
+		s.logExecution(execution.ID, models.LogLevelWarn, "worker %s 的租约已过期，执行重新排队，由其他 worker 继续未完成的 tag", execution.Worker)
+	}
+}
+
+// coordinate re-queues the executions of failed workers and relays the
+// progress and logs of executions run by workers to the WebSocket clients of
+// this server, until the scheduler stops
+func (s *Scheduler) coordinate() {
+	ticker := time.NewTicker(relayInterval)
+	defer ticker.Stop()
+
+	lastLogs := make(map[uint]uint) // execution_id -> last relayed log
+	for range ticker.C {
+		if s.stopping.Load() {
+			return
+		}
+		if s.IsLeader() {
+			s.requeueExpired()
+		}
+		s.relay(lastLogs)
+	}
+}
+
+// relay broadcasts the new logs and the progress of executions run by
+// workers, and the final progress of those that ended since the last call
+func (s *Scheduler) relay(lastLogs map[uint]uint) {
+	executions, err := s.store.ListWorkerExecutions()
+	if err != nil {
+		log.Printf("Failed to load worker executions: %v", err)
+		return
+	}
+
+	running := make(map[uint]bool, len(executions))
+	for i := range executions {
+		execution := &executions[i]
+		running[execution.ID] = true
+		s.relayLogs(execution.ID, lastLogs)
+
+		progress := map[string]interface{}{
+			"worker":       execution.Worker,
+			"total_blobs":  execution.TotalBlobs,
+			"synced_blobs": execution.SyncedBlobs,
+			"progress":     execution.Progress(),
+		}
+		if len(execution.TargetResults) > 1 {
+			progress["target_results"] = execution.TargetResults
+		}
+		s.hub.BroadcastProgress(execution.ID, progress)
+	}
+
+	for executionID := range lastLogs {
+		if running[executionID] {
+			continue
+		}
+		s.relayLogs(executionID, lastLogs)
+		delete(lastLogs, executionID)
+
+		execution, err := s.store.GetExecution(executionID)
+		if err != nil {
+			continue
+		}
+		s.hub.BroadcastProgress(execution.ID, map[string]interface{}{
+			"status":       execution.Status,
+			"worker":       execution.Worker,
+			"total_blobs":  execution.TotalBlobs,
+			"synced_blobs": execution.SyncedBlobs,
+			"progress":     execution.Progress(),
+		})
+	}
+}
+
+// relayLogs broadcasts the logs of an execution written since the last call
+func (s *Scheduler) relayLogs(executionID uint, lastLogs map[uint]uint) {
+	last := lastLogs[executionID]
+	logs, err := s.store.ListExecutionLogsSince(executionID, last)
+	if err != nil {
+		log.Printf("Failed to load logs of execution %d: %v", executionID, err)
+		return
+	}
+	for _, entry := range logs {
+		s.hub.BroadcastLog(executionID, string(entry.Level), entry.Message)
+		last = entry.ID
+	}
+	lastLogs[executionID] = last
+}
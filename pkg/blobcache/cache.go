@@ -0,0 +1,339 @@
+package blobcache
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// FetchFunc downloads a blob that is not in the cache
+type FetchFunc func() (io.ReadCloser, int64, error)
+
+// Cache is an on-disk content-addressable blob store with a size bound and LRU
+// eviction. Blobs are verified against their digest before they are stored, and
+// concurrent requests for the same digest share a single download.
+type Cache struct {
+	dir     string
+	maxSize int64
+
+	mu       sync.Mutex
+	entries  map[string]*list.Element // digest -> element in lru
+	lru      *list.List               // front = most recently used
+	size     int64
+	inflight map[string]*fetchCall
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// entry is a cached blob
+type entry struct {
+	digest string
+	size   int64
+}
+
+// fetchCall is a download in progress that other requests can wait for
+type fetchCall struct {
+	done chan struct{}
+	err  error
+}
+
+// Stats contains cache counters
+type Stats struct {
+	Entries int   `json:"entries"`
+	Size    int64 `json:"size"`
+	MaxSize int64 `json:"max_size"`
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+}
+
+// New opens a cache directory, indexing blobs left by previous runs.
+// maxSize is the maximum total size of cached blobs in bytes.
+func New(dir string, maxSize int64) (*Cache, error) {
+	if maxSize <= 0 {
+		return nil, fmt.Errorf("cache size must be positive")
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, "sha256"), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	c := &Cache{
+		dir:      dir,
+		maxSize:  maxSize,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+		inflight: make(map[string]*fetchCall),
+	}
+
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// load indexes existing blobs, using modification times as recency
+func (c *Cache) load() error {
+	files, err := os.ReadDir(filepath.Join(c.dir, "sha256"))
+	if err != nil {
+		return fmt.Errorf("failed to read cache directory: %w", err)
+	}
+
+	type existing struct {
+		entry
+		modTime time.Time
+	}
+	var blobs []existing
+
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		// Leftovers of interrupted downloads
+		if strings.HasPrefix(file.Name(), ".tmp-") {
+			os.Remove(filepath.Join(c.dir, "sha256", file.Name()))
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		blobs = append(blobs, existing{
+			entry:   entry{digest: "sha256:" + file.Name(), size: info.Size()},
+			modTime: info.ModTime(),
+		})
+	}
+
+	sort.Slice(blobs, func(i, j int) bool {
+		return blobs[i].modTime.After(blobs[j].modTime)
+	})
+	for _, blob := range blobs {
+		c.entries[blob.digest] = c.lru.PushBack(&entry{digest: blob.digest, size: blob.size})
+		c.size += blob.size
+	}
+
+	c.mu.Lock()
+	c.evict("")
+	c.mu.Unlock()
+
+	return nil
+}
+
+// Open returns a blob from the cache, downloading it with fetch on a miss.
+// hit reports whether the blob was served without calling fetch.
+// Blobs with an unsupported digest algorithm or larger than the cache are
+// passed through without being stored.
+func (c *Cache) Open(ctx context.Context, digest string, fetch FetchFunc) (rc io.ReadCloser, size int64, hit bool, err error) {
+	if !strings.HasPrefix(digest, "sha256:") {
+		rc, size, err = fetch()
+		return rc, size, false, err
+	}
+
+	for {
+		c.mu.Lock()
+
+		if elem, ok := c.entries[digest]; ok {
+			c.lru.MoveToFront(elem)
+			c.mu.Unlock()
+
+			f, err := os.Open(c.path(digest))
+			if err == nil {
+				now := time.Now()
+				os.Chtimes(f.Name(), now, now)
+				c.hits.Add(1)
+				return f, elem.Value.(*entry).size, true, nil
+			}
+
+			// Removed behind our back, forget it and download again
+			c.mu.Lock()
+			c.remove(digest)
+			c.mu.Unlock()
+			continue
+		}
+
+		if call, ok := c.inflight[digest]; ok {
+			c.mu.Unlock()
+
+			select {
+			case <-call.done:
+			case <-ctx.Done():
+				return nil, 0, false, ctx.Err()
+			}
+			if call.err == nil {
+				continue
+			}
+			// The other download failed or was not cached, fetch directly
+			rc, size, err = fetch()
+			c.misses.Add(1)
+			return rc, size, false, err
+		}
+
+		call := &fetchCall{done: make(chan struct{})}
+		c.inflight[digest] = call
+		c.mu.Unlock()
+
+		var stored bool
+		rc, size, stored, err = c.fill(digest, fetch)
+		if err == nil && stored {
+			rc, size, err = c.openStored(digest)
+		}
+		call.err = err
+		if err == nil && !stored {
+			call.err = errNotCached
+		}
+
+		c.mu.Lock()
+		delete(c.inflight, digest)
+		c.mu.Unlock()
+		close(call.done)
+
+		c.misses.Add(1)
+		return rc, size, false, err
+	}
+}
+
+// errNotCached tells waiting requests that a download was passed through
+var errNotCached = errors.New("blob not cached")
+
+// fill downloads a blob into the cache and reports whether it was stored. A blob
+// that is too large for the cache is returned as a self-deleting temporary file.
+func (c *Cache) fill(digest string, fetch FetchFunc) (io.ReadCloser, int64, bool, error) {
+	reader, _, err := fetch()
+	if err != nil {
+		return nil, 0, false, err
+	}
+	defer reader.Close()
+
+	tmp, err := os.CreateTemp(filepath.Join(c.dir, "sha256"), ".tmp-*")
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	h := sha256.New()
+	written, err := io.Copy(io.MultiWriter(tmp, h), reader)
+	if err == nil {
+		err = verify(h, digest)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, 0, false, err
+	}
+
+	if written > c.maxSize {
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return nil, 0, false, err
+		}
+		return &tempFile{File: tmp}, written, false, nil
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return nil, 0, false, err
+	}
+	if err := os.Rename(tmp.Name(), c.path(digest)); err != nil {
+		os.Remove(tmp.Name())
+		return nil, 0, false, err
+	}
+
+	c.mu.Lock()
+	c.entries[digest] = c.lru.PushFront(&entry{digest: digest, size: written})
+	c.size += written
+	c.evict(digest)
+	c.mu.Unlock()
+
+	return nil, written, true, nil
+}
+
+// openStored opens a blob that was just stored
+func (c *Cache) openStored(digest string) (io.ReadCloser, int64, error) {
+	f, err := os.Open(c.path(digest))
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, info.Size(), nil
+}
+
+// evict removes least recently used blobs until the cache fits its size bound.
+// keep is never evicted. The caller must hold c.mu.
+func (c *Cache) evict(keep string) {
+	for elem := c.lru.Back(); elem != nil && c.size > c.maxSize; {
+		prev := elem.Prev()
+		if e := elem.Value.(*entry); e.digest != keep {
+			c.remove(e.digest)
+		}
+		elem = prev
+	}
+}
+
+// remove deletes a blob. Readers that already opened it keep working.
+// The caller must hold c.mu.
+func (c *Cache) remove(digest string) {
+	elem, ok := c.entries[digest]
+	if !ok {
+		return
+	}
+	c.lru.Remove(elem)
+	delete(c.entries, digest)
+	c.size -= elem.Value.(*entry).size
+	os.Remove(c.path(digest))
+}
+
+// Stats returns the cache counters
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return Stats{
+		Entries: len(c.entries),
+		Size:    c.size,
+		MaxSize: c.maxSize,
+		Hits:    c.hits.Load(),
+		Misses:  c.misses.Load(),
+	}
+}
+
+// path returns the file of a cached blob
+func (c *Cache) path(digest string) string {
+	return filepath.Join(c.dir, "sha256", strings.TrimPrefix(digest, "sha256:"))
+}
+
+// verify checks a computed hash against a digest
+func verify(h hash.Hash, digest string) error {
+	actual := "sha256:" + hex.EncodeToString(h.Sum(nil))
+	if actual != digest {
+		return fmt.Errorf("digest mismatch: expected %s, got %s", digest, actual)
+	}
+	return nil
+}
+
+// tempFile is a blob passed through the cache that is deleted when closed
+type tempFile struct {
+	*os.File
+}
+
+func (f *tempFile) Close() error {
+	err := f.File.Close()
+	os.Remove(f.File.Name())
+	return err
+}
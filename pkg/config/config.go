@@ -8,6 +8,8 @@ import (
 	"time"
 
 	"gopkg.in/yaml.v3"
+
+	"registry-sync/pkg/ratelimit"
 )
 
 // Config represents the root configuration
@@ -20,18 +22,56 @@ type Config struct {
 
 // GlobalConfig contains global settings
 type GlobalConfig struct {
-	Concurrency int           `yaml:"concurrency"`
-	Retry       RetryConfig   `yaml:"retry"`
-	Timeout     time.Duration `yaml:"timeout"`
+	Concurrency  int           `yaml:"concurrency"`
+	Retry        RetryConfig   `yaml:"retry"`
+	Timeout      time.Duration `yaml:"timeout"`       // Maximum duration of a sync rule, 0 = unlimited
+	StallTimeout time.Duration `yaml:"stall_timeout"` // Abort and retry blob transfers during which no data flowed for this long, 0 disables
+	Bandwidth    string        `yaml:"bandwidth"`     // Byte rate limit for all blob transfers, see ratelimit.ParseBandwidthSchedule
 }
 
-// RetryConfig contains retry settings
+// RetryConfig contains retry settings. The inline policy applies to all
+// operations; the per-operation policies override it field by field.
 type RetryConfig struct {
+	RetryPolicy  `yaml:",inline"`
+	Budget       int         `yaml:"budget"` // Maximum number of retries per sync rule, 0 = unlimited
+	Manifest     RetryPolicy `yaml:"manifest"`
+	BlobDownload RetryPolicy `yaml:"blob_download"`
+	BlobUpload   RetryPolicy `yaml:"blob_upload"`
+	Catalog      RetryPolicy `yaml:"catalog"` // Listing tags and repositories
+}
+
+// RetryPolicy contains the retry settings of an operation
+type RetryPolicy struct {
 	MaxAttempts     int           `yaml:"max_attempts"`
 	InitialInterval time.Duration `yaml:"initial_interval"`
 	MaxInterval     time.Duration `yaml:"max_interval"`
 }
 
+// Merge returns the policy with unset fields taken from defaults
+func (p RetryPolicy) Merge(defaults RetryPolicy) RetryPolicy {
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = defaults.MaxAttempts
+	}
+	if p.InitialInterval == 0 {
+		p.InitialInterval = defaults.InitialInterval
+	}
+	if p.MaxInterval == 0 {
+		p.MaxInterval = defaults.MaxInterval
+	}
+	return p
+}
+
+// validate checks that a retry policy is usable
+func (p RetryPolicy) validate() error {
+	if p.MaxAttempts < 0 || p.InitialInterval < 0 || p.MaxInterval < 0 {
+		return fmt.Errorf("retry settings must not be negative")
+	}
+	if p.InitialInterval > 0 && p.MaxInterval > 0 && p.InitialInterval > p.MaxInterval {
+		return fmt.Errorf("initial_interval %v exceeds max_interval %v", p.InitialInterval, p.MaxInterval)
+	}
+	return nil
+}
+
 // Registry represents a container registry
 type Registry struct {
 	URL       string        `yaml:"url"`
@@ -39,6 +79,7 @@ type Registry struct {
 	Password  string        `yaml:"password"`
 	Insecure  bool          `yaml:"insecure"`
 	RateLimit RateLimitInfo `yaml:"ratelimit,omitempty"`
+	Bandwidth string        `yaml:"bandwidth,omitempty"` // Byte rate limit for blob transfers from and to this registry
 }
 
 // RateLimitInfo contains rate limiting settings
@@ -48,24 +89,48 @@ type RateLimitInfo struct {
 
 // SyncRule represents a single sync task
 type SyncRule struct {
-	Name          string         `yaml:"name"`
-	Source        SourceConfig   `yaml:"source"`
-	Target        TargetConfig   `yaml:"target"`
-	Tags          TagFilter      `yaml:"tags"`
-	Architectures []string       `yaml:"architectures"`
-	Enabled       bool           `yaml:"enabled"`
+	Name          string        `yaml:"name"`
+	Source        SourceConfig  `yaml:"source"`
+	Target        TargetConfig  `yaml:"target"`
+	Tags          TagFilter     `yaml:"tags"`
+	Architectures []string      `yaml:"architectures"`
+	Bandwidth     string        `yaml:"bandwidth"` // Byte rate limit for the blob downloads of this rule (uploads for oci-layout sources)
+	Timeout       time.Duration `yaml:"timeout"`   // Maximum duration of this rule, overrides the global timeout
+	Enabled       bool          `yaml:"enabled"`
 }
 
 // SourceConfig represents source registry configuration
 type SourceConfig struct {
+	Type       string `yaml:"type"` // "registry" (default) or "oci-layout"
 	Registry   string `yaml:"registry"`
 	Repository string `yaml:"repository"`
+	Path       string `yaml:"path"`    // Layout directory, OCI tarball or docker save archive for oci-layout sources
+	Mapping    string `yaml:"mapping"` // Optional YAML file mapping bundle references to target references
+}
+
+// IsOCILayout reports whether the source reads from an OCI image layout
+func (s SourceConfig) IsOCILayout() bool {
+	return s.Type == TypeOCILayout
 }
 
 // TargetConfig represents target registry configuration
 type TargetConfig struct {
+	Type       string `yaml:"type"` // "registry" (default) or "oci-layout"
 	Registry   string `yaml:"registry"`
 	Repository string `yaml:"repository"`
+	Path       string `yaml:"path"`        // Layout directory or .tar/.tar.zst file for oci-layout targets
+	KnownBlobs string `yaml:"known_blobs"` // Optional known blobs manifest; listed blobs are left out of the bundle
+}
+
+// Endpoint types for sync sources and targets
+const (
+	TypeRegistry  = "registry"
+	TypeOCILayout = "oci-layout"
+)
+
+// IsOCILayout reports whether the target writes to an OCI image layout
+func (t TargetConfig) IsOCILayout() bool {
+	return t.Type == TypeOCILayout
 }
 
 // TagFilter contains tag filtering rules
@@ -103,9 +168,6 @@ func LoadConfig(path string) (*Config, error) {
 	if config.Global.Retry.MaxInterval == 0 {
 		config.Global.Retry.MaxInterval = 30 * time.Second
 	}
-	if config.Global.Timeout == 0 {
-		config.Global.Timeout = 10 * time.Minute
-	}
 
 	// Validate
 	if err := config.Validate(); err != nil {
@@ -121,27 +183,82 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("no registries defined")
 	}
 
+	if _, err := ratelimit.ParseBandwidthSchedule(c.Global.Bandwidth); err != nil {
+		return fmt.Errorf("global: %w", err)
+	}
+	if c.Global.Timeout < 0 || c.Global.StallTimeout < 0 {
+		return fmt.Errorf("global: timeouts must not be negative")
+	}
+
+	retry := c.Global.Retry
+	if retry.Budget < 0 {
+		return fmt.Errorf("global: retry budget must not be negative")
+	}
+	for name, policy := range map[string]RetryPolicy{
+		"retry":               retry.RetryPolicy,
+		"retry.manifest":      retry.Manifest.Merge(retry.RetryPolicy),
+		"retry.blob_download": retry.BlobDownload.Merge(retry.RetryPolicy),
+		"retry.blob_upload":   retry.BlobUpload.Merge(retry.RetryPolicy),
+		"retry.catalog":       retry.Catalog.Merge(retry.RetryPolicy),
+	} {
+		if err := policy.validate(); err != nil {
+			return fmt.Errorf("global: %s: %w", name, err)
+		}
+	}
+
 	for name, reg := range c.Registries {
 		if reg.URL == "" {
 			return fmt.Errorf("registry %s: URL is required", name)
 		}
+		if _, err := ratelimit.ParseBandwidthSchedule(reg.Bandwidth); err != nil {
+			return fmt.Errorf("registry %s: %w", name, err)
+		}
 	}
 
 	for i, rule := range c.SyncRules {
 		if rule.Name == "" {
 			return fmt.Errorf("sync rule %d: name is required", i)
 		}
-		if _, ok := c.Registries[rule.Source.Registry]; !ok {
-			return fmt.Errorf("sync rule %s: source registry %s not found", rule.Name, rule.Source.Registry)
+		if _, err := ratelimit.ParseBandwidthSchedule(rule.Bandwidth); err != nil {
+			return fmt.Errorf("sync rule %s: %w", rule.Name, err)
 		}
-		if _, ok := c.Registries[rule.Target.Registry]; !ok {
-			return fmt.Errorf("sync rule %s: target registry %s not found", rule.Name, rule.Target.Registry)
+		if rule.Timeout < 0 {
+			return fmt.Errorf("sync rule %s: timeout must not be negative", rule.Name)
 		}
-		if rule.Source.Repository == "" {
-			return fmt.Errorf("sync rule %s: source repository is required", rule.Name)
+
+		switch rule.Source.Type {
+		case "", TypeRegistry:
+			if _, ok := c.Registries[rule.Source.Registry]; !ok {
+				return fmt.Errorf("sync rule %s: source registry %s not found", rule.Name, rule.Source.Registry)
+			}
+			if rule.Source.Repository == "" {
+				return fmt.Errorf("sync rule %s: source repository is required", rule.Name)
+			}
+		case TypeOCILayout:
+			if rule.Source.Path == "" {
+				return fmt.Errorf("sync rule %s: source path is required for oci-layout sources", rule.Name)
+			}
+			if rule.Target.IsOCILayout() {
+				return fmt.Errorf("sync rule %s: oci-layout sources require a registry target", rule.Name)
+			}
+		default:
+			return fmt.Errorf("sync rule %s: unknown source type %s", rule.Name, rule.Source.Type)
 		}
-		if rule.Target.Repository == "" {
-			return fmt.Errorf("sync rule %s: target repository is required", rule.Name)
+
+		switch rule.Target.Type {
+		case "", TypeRegistry:
+			if _, ok := c.Registries[rule.Target.Registry]; !ok {
+				return fmt.Errorf("sync rule %s: target registry %s not found", rule.Name, rule.Target.Registry)
+			}
+			if rule.Target.Repository == "" {
+				return fmt.Errorf("sync rule %s: target repository is required", rule.Name)
+			}
+		case TypeOCILayout:
+			if rule.Target.Path == "" {
+				return fmt.Errorf("sync rule %s: target path is required for oci-layout targets", rule.Name)
+			}
+		default:
+			return fmt.Errorf("sync rule %s: unknown target type %s", rule.Name, rule.Target.Type)
 		}
 
 		// Validate regex patterns
@@ -43,6 +43,10 @@ func (n *Notifier) SendTaskNotification(taskName string, status string, duration
 		title = "Registry Sync - 任务执行成功"
 	case "failed":
 		title = "Registry Sync - 任务执行失败"
+	case "canceled":
+		title = "Registry Sync - 任务已取消"
+	case "timed_out":
+		title = "Registry Sync - 任务执行超时"
 	default:
 		title = "Registry Sync - 任务通知"
 	}
@@ -67,6 +71,10 @@ func (n *Notifier) formatTaskNotification(taskName string, status string, durati
 		statusColor = "<font color=\"info\">成功</font>"
 	case "failed":
 		statusColor = "<font color=\"warning\">失败</font>"
+	case "canceled":
+		statusColor = "<font color=\"comment\">已取消</font>"
+	case "timed_out":
+		statusColor = "<font color=\"warning\">超时</font>"
 	default:
 		statusColor = status
 	}
@@ -103,6 +111,10 @@ func (n *Notifier) formatTaskNotification(taskName string, status string, durati
 		}
 	}
 
+	if canceledBy, ok := stats["canceled_by"].(string); ok && canceledBy != "" {
+		content += fmt.Sprintf("> \n> **取消人**：%s\n", canceledBy)
+	}
+
 	// Add error message if failed
 	if status == "failed" {
 		if errMsg, ok := stats["error"].(string); ok && errMsg != "" {
@@ -0,0 +1,61 @@
+package ocilayout
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// KnownBlobs is the set of blobs the receiving side of an air gap already has.
+// Exports skip these blobs so that bundles only carry new content.
+type KnownBlobs map[string]bool
+
+// knownBlobsFile is the on-disk format of a known blobs manifest
+type knownBlobsFile struct {
+	Blobs []string `json:"blobs"`
+}
+
+// LoadKnownBlobs loads a known blobs manifest
+func LoadKnownBlobs(path string) (KnownBlobs, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read known blobs: %w", err)
+	}
+
+	var file knownBlobsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse known blobs: %w", err)
+	}
+
+	known := make(KnownBlobs, len(file.Blobs))
+	for _, digest := range file.Blobs {
+		known[digest] = true
+	}
+	return known, nil
+}
+
+// Save writes the known blobs manifest
+func (k KnownBlobs) Save(path string) error {
+	file := knownBlobsFile{Blobs: make([]string, 0, len(k))}
+	for digest := range k {
+		file.Blobs = append(file.Blobs, digest)
+	}
+	sort.Strings(file.Blobs)
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// MissingBlobsError reports blobs that are neither in the bundle nor in the target registry
+type MissingBlobsError struct {
+	Digests []string
+}
+
+func (e *MissingBlobsError) Error() string {
+	return fmt.Sprintf("%d blobs missing from bundle and target: %s", len(e.Digests), strings.Join(e.Digests, ", "))
+}
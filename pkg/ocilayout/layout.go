@@ -0,0 +1,118 @@
+package ocilayout
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"path"
+	"strings"
+
+	"registry-sync/pkg/registry"
+)
+
+// OCI image layout file names
+const (
+	LayoutFile    = "oci-layout"
+	IndexFile     = "index.json"
+	BlobsDir      = "blobs"
+	LayoutVersion = "1.0.0"
+)
+
+// AnnotationRefName is the annotation holding the image reference in index.json
+const AnnotationRefName = "org.opencontainers.image.ref.name"
+
+// Layout represents the content of the oci-layout file
+type Layout struct {
+	Version string `json:"imageLayoutVersion"`
+}
+
+// Index represents the top-level index.json of an image layout
+type Index struct {
+	SchemaVersion int                   `json:"schemaVersion"`
+	MediaType     string                `json:"mediaType,omitempty"`
+	Manifests     []registry.Descriptor `json:"manifests"`
+}
+
+// IsTarball reports whether a bundle path refers to a tar archive rather than a directory
+func IsTarball(p string) bool {
+	return strings.HasSuffix(p, ".tar") || IsZstd(p)
+}
+
+// IsZstd reports whether a bundle path refers to a zstd-compressed tar archive
+func IsZstd(p string) bool {
+	return strings.HasSuffix(p, ".tar.zst") || strings.HasSuffix(p, ".tar.zstd")
+}
+
+// BlobPath returns the layout-relative path of a blob
+func BlobPath(digest string) (string, error) {
+	algorithm, encoded, err := splitDigest(digest)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(BlobsDir, algorithm, encoded), nil
+}
+
+// RefName builds the ref name annotation value for a repository and tag
+func RefName(repository, tag string) string {
+	if repository == "" {
+		return tag
+	}
+	return repository + ":" + tag
+}
+
+// ParseRefName splits a ref name annotation into repository and tag.
+// A bare tag (as written by most tools) yields an empty repository.
+func ParseRefName(ref string) (repository, tag string) {
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		return ref[:i], ref[i+1:]
+	}
+	if strings.Contains(ref, "/") {
+		return ref, "latest"
+	}
+	return "", ref
+}
+
+// splitDigest splits a digest into algorithm and encoded parts
+func splitDigest(digest string) (string, string, error) {
+	parts := strings.SplitN(digest, ":", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid digest: %s", digest)
+	}
+	if strings.ContainsAny(parts[1], "/\\.") {
+		return "", "", fmt.Errorf("invalid digest: %s", digest)
+	}
+	return parts[0], parts[1], nil
+}
+
+// digestVerifier hashes content and checks it against an expected digest
+type digestVerifier struct {
+	expected string
+	hash     hash.Hash
+}
+
+// newDigestVerifier creates a verifier for the given digest
+func newDigestVerifier(digest string) (*digestVerifier, error) {
+	algorithm, _, err := splitDigest(digest)
+	if err != nil {
+		return nil, err
+	}
+	if algorithm != "sha256" {
+		return nil, fmt.Errorf("unsupported digest algorithm: %s", algorithm)
+	}
+	return &digestVerifier{expected: digest, hash: sha256.New()}, nil
+}
+
+// Write implements io.Writer
+func (v *digestVerifier) Write(p []byte) (int, error) {
+	return v.hash.Write(p)
+}
+
+// Verify returns an error if the written content does not match the expected digest
+func (v *digestVerifier) Verify() error {
+	actual := "sha256:" + hex.EncodeToString(v.hash.Sum(nil))
+	if actual != v.expected {
+		return fmt.Errorf("digest mismatch: expected %s, got %s", v.expected, actual)
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package ocilayout
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"registry-sync/pkg/registry"
+)
+
+// Mapping maps bundle references to target references ("repo:tag" or "repo").
+// Keys are ref names as recorded in the bundle or manifest digests.
+type Mapping map[string]string
+
+// LoadMapping loads a YAML mapping file
+func LoadMapping(path string) (Mapping, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mapping file: %w", err)
+	}
+
+	var mapping Mapping
+	if err := yaml.Unmarshal(data, &mapping); err != nil {
+		return nil, fmt.Errorf("failed to parse mapping file: %w", err)
+	}
+
+	return mapping, nil
+}
+
+// Resolve returns the target repository and tag for an image if it is mapped
+func (m Mapping) Resolve(img Image) (repository, tag string, ok bool) {
+	target, ok := m[img.RefName]
+	if !ok {
+		target, ok = m[img.Descriptor.Digest]
+	}
+	if !ok {
+		return "", "", false
+	}
+
+	if i := strings.LastIndex(target, ":"); i > strings.LastIndex(target, "/") {
+		return target[:i], target[i+1:], true
+	}
+	// A target without a tag keeps the original tag
+	return target, img.Tag, true
+}
+
+// PushOptions controls how an image is pushed from a bundle
+type PushOptions struct {
+	// Architectures limits which platforms of a multi-arch image are pushed
+	Architectures []string
+	// OnBlob is called for every blob after it was checked or uploaded
+	OnBlob func(blob registry.Descriptor, existed bool)
+}
+
+// Push uploads an image and every blob it references to a registry.
+// Before any manifest is pushed, every referenced blob must be present either in
+// the bundle or in the target; otherwise a *MissingBlobsError is returned.
+func (r *Reader) Push(ctx context.Context, target *registry.Client, img Image, repository, tag string, opts PushOptions) error {
+	manifest, children, err := r.resolve(img, opts.Architectures)
+	if err != nil {
+		return err
+	}
+
+	present, err := r.checkBlobs(ctx, target, repository, children)
+	if err != nil {
+		return err
+	}
+
+	if manifest.IsManifestList() {
+		for _, child := range children {
+			if err := r.pushManifest(ctx, target, repository, child.entry.Digest, child.manifest, present, opts); err != nil {
+				return fmt.Errorf("failed to push %s/%s: %w", child.entry.Platform.OS, child.entry.Platform.Architecture, err)
+			}
+		}
+
+		if _, err := target.PutManifest(ctx, repository, tag, manifest); err != nil {
+			return fmt.Errorf("failed to upload manifest list: %w", err)
+		}
+		return nil
+	}
+
+	return r.pushManifest(ctx, target, repository, tag, manifest, present, opts)
+}
+
+// platformManifest is an image manifest selected from a multi-arch image
+type platformManifest struct {
+	entry    registry.ManifestEntry
+	manifest *registry.Manifest
+}
+
+// resolve reads an image's manifest and, for multi-arch images, the manifests
+// of the selected platforms. A single-arch image is its own only child.
+func (r *Reader) resolve(img Image, architectures []string) (*registry.Manifest, []platformManifest, error) {
+	manifest, err := r.ReadManifest(img.Descriptor)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !manifest.IsManifestList() {
+		return manifest, []platformManifest{{manifest: manifest}}, nil
+	}
+
+	var children []platformManifest
+	for _, entry := range registry.FilterManifestsByArch(manifest.Manifests, architectures) {
+		child, err := r.ReadManifest(registry.Descriptor{MediaType: entry.MediaType, Digest: entry.Digest})
+		if err != nil {
+			return nil, nil, err
+		}
+		children = append(children, platformManifest{entry: entry, manifest: child})
+	}
+
+	return manifest, children, nil
+}
+
+// checkBlobs returns the blobs that already exist in the target and fails if a
+// blob is neither there nor in the bundle, as happens with incremental bundles
+// imported into a registry that lacks their base content
+func (r *Reader) checkBlobs(ctx context.Context, target *registry.Client, repository string, children []platformManifest) (map[string]bool, error) {
+	present := make(map[string]bool)
+	var missing []string
+
+	for _, blob := range uniqueBlobs(children) {
+		exists, _, err := target.BlobExists(ctx, repository, blob.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check blob existence: %w", err)
+		}
+		if exists {
+			present[blob.Digest] = true
+		} else if !r.HasBlob(blob.Digest) {
+			missing = append(missing, blob.Digest)
+		}
+	}
+
+	if len(missing) > 0 {
+		return nil, &MissingBlobsError{Digests: missing}
+	}
+
+	return present, nil
+}
+
+// pushManifest uploads the blobs of a single image manifest, then the manifest itself
+func (r *Reader) pushManifest(ctx context.Context, target *registry.Client, repository, reference string, manifest *registry.Manifest, present map[string]bool, opts PushOptions) error {
+	for _, blob := range manifest.GetAllBlobs() {
+		exists := present[blob.Digest]
+		if !exists {
+			if err := r.pushBlob(ctx, target, repository, blob); err != nil {
+				return err
+			}
+			// Platforms of a multi-arch image often share blobs
+			present[blob.Digest] = true
+		}
+
+		if opts.OnBlob != nil {
+			opts.OnBlob(blob, exists)
+		}
+	}
+
+	if _, err := target.PutManifest(ctx, repository, reference, manifest); err != nil {
+		return fmt.Errorf("failed to upload manifest: %w", err)
+	}
+
+	return nil
+}
+
+// pushBlob uploads a single blob from the bundle
+func (r *Reader) pushBlob(ctx context.Context, target *registry.Client, repository string, blob registry.Descriptor) error {
+	reader, size, err := r.OpenBlob(blob.Digest)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	if err := target.PutBlob(ctx, repository, blob.Digest, reader, size); err != nil {
+		return fmt.Errorf("failed to upload blob %s: %w", blob.Digest, err)
+	}
+
+	return nil
+}
+
+// Blobs returns the unique blobs referenced by an image, across the
+// selected platforms of a multi-arch image
+func (r *Reader) Blobs(img Image, architectures []string) ([]registry.Descriptor, error) {
+	_, children, err := r.resolve(img, architectures)
+	if err != nil {
+		return nil, err
+	}
+	return uniqueBlobs(children), nil
+}
+
+// uniqueBlobs returns the blobs referenced by a set of manifests, without duplicates
+func uniqueBlobs(children []platformManifest) []registry.Descriptor {
+	seen := make(map[string]bool)
+	var blobs []registry.Descriptor
+	for _, child := range children {
+		for _, blob := range child.manifest.GetAllBlobs() {
+			if !seen[blob.Digest] {
+				seen[blob.Digest] = true
+				blobs = append(blobs, blob)
+			}
+		}
+	}
+	return blobs
+}
@@ -0,0 +1,438 @@
+package ocilayout
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+
+	"registry-sync/pkg/registry"
+)
+
+// Docker image media types used when converting `docker save` archives
+const (
+	mediaTypeDockerConfig    = "application/vnd.docker.container.image.v1+json"
+	mediaTypeDockerLayer     = "application/vnd.docker.image.rootfs.diff.tar"
+	mediaTypeDockerLayerGzip = "application/vnd.docker.image.rootfs.diff.tar.gzip"
+)
+
+// Image is a tagged image found in a bundle
+type Image struct {
+	RefName    string // Original reference as recorded in the bundle
+	Repository string // Empty when the bundle only records a tag
+	Tag        string
+	Descriptor registry.Descriptor
+}
+
+// Reader reads images from an OCI image layout directory, an OCI layout
+// tarball or a `docker save` archive
+type Reader struct {
+	root      string
+	tempDir   string
+	images    []Image
+	blobs     map[string]string // digest -> file, for docker save archives
+	manifests map[string][]byte // digest -> manifest synthesized from docker save metadata
+}
+
+// dockerSaveEntry is an entry of manifest.json in a `docker save` archive
+type dockerSaveEntry struct {
+	Config   string   `json:"Config"`
+	RepoTags []string `json:"RepoTags"`
+	Layers   []string `json:"Layers"`
+}
+
+// Open opens a bundle. Archives (.tar, .tar.gz, .tar.zst) are extracted to a
+// temporary directory that is removed by Close.
+func Open(path string) (*Reader, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bundle: %w", err)
+	}
+
+	r := &Reader{
+		root:      path,
+		blobs:     make(map[string]string),
+		manifests: make(map[string][]byte),
+	}
+
+	if !info.IsDir() {
+		tempDir, err := os.MkdirTemp("", "registry-sync-import-*")
+		if err != nil {
+			return nil, err
+		}
+		r.root = tempDir
+		r.tempDir = tempDir
+
+		if err := extractArchive(path, tempDir); err != nil {
+			r.Close()
+			return nil, fmt.Errorf("failed to extract bundle: %w", err)
+		}
+	}
+
+	if err := r.load(); err != nil {
+		r.Close()
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Close releases temporary files
+func (r *Reader) Close() error {
+	if r.tempDir != "" {
+		return os.RemoveAll(r.tempDir)
+	}
+	return nil
+}
+
+// Images returns all tagged images in the bundle
+func (r *Reader) Images() []Image {
+	return r.images
+}
+
+// load detects the bundle format and collects its images
+func (r *Reader) load() error {
+	data, err := os.ReadFile(filepath.Join(r.root, IndexFile))
+	if err == nil {
+		var index Index
+		if err := json.Unmarshal(data, &index); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", IndexFile, err)
+		}
+
+		for _, desc := range index.Manifests {
+			refName := desc.Annotations[AnnotationRefName]
+			if refName == "" {
+				continue
+			}
+			repository, tag := ParseRefName(refName)
+			r.images = append(r.images, Image{
+				RefName:    refName,
+				Repository: repository,
+				Tag:        tag,
+				Descriptor: desc,
+			})
+		}
+
+		if len(r.images) > 0 {
+			return nil
+		}
+	}
+
+	// Legacy `docker save` format
+	data, err = os.ReadFile(filepath.Join(r.root, "manifest.json"))
+	if err != nil {
+		return fmt.Errorf("no images found: bundle has neither tagged %s entries nor manifest.json", IndexFile)
+	}
+
+	var entries []dockerSaveEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("failed to parse manifest.json: %w", err)
+	}
+
+	for _, entry := range entries {
+		desc, err := r.convertDockerSaveEntry(entry)
+		if err != nil {
+			return err
+		}
+
+		for _, repoTag := range entry.RepoTags {
+			repository, tag := ParseRefName(repoTag)
+			r.images = append(r.images, Image{
+				RefName:    repoTag,
+				Repository: stripRegistryHost(repository),
+				Tag:        tag,
+				Descriptor: desc,
+			})
+		}
+	}
+
+	if len(r.images) == 0 {
+		return fmt.Errorf("no tagged images found in bundle")
+	}
+
+	return nil
+}
+
+// convertDockerSaveEntry builds a Docker v2 manifest for a `docker save` image
+func (r *Reader) convertDockerSaveEntry(entry dockerSaveEntry) (registry.Descriptor, error) {
+	config, err := r.describeFile(entry.Config, mediaTypeDockerConfig)
+	if err != nil {
+		return registry.Descriptor{}, err
+	}
+
+	manifest := registry.Manifest{
+		SchemaVersion: 2,
+		MediaType:     registry.MediaTypeDockerManifest,
+		Config:        config,
+	}
+
+	for _, layer := range entry.Layers {
+		mediaType := mediaTypeDockerLayer
+		if isGzipFile(filepath.Join(r.root, layer)) {
+			mediaType = mediaTypeDockerLayerGzip
+		}
+
+		desc, err := r.describeFile(layer, mediaType)
+		if err != nil {
+			return registry.Descriptor{}, err
+		}
+		manifest.Layers = append(manifest.Layers, desc)
+	}
+
+	raw, err := json.Marshal(manifest)
+	if err != nil {
+		return registry.Descriptor{}, err
+	}
+	manifest.Raw = raw
+
+	digest := manifest.Digest()
+	r.manifests[digest] = raw
+
+	return registry.Descriptor{
+		MediaType: manifest.MediaType,
+		Digest:    digest,
+		Size:      int64(len(raw)),
+	}, nil
+}
+
+// describeFile hashes a file of a docker save archive and registers it as a blob
+func (r *Reader) describeFile(name, mediaType string) (registry.Descriptor, error) {
+	file := filepath.Join(r.root, filepath.FromSlash(name))
+
+	f, err := os.Open(file)
+	if err != nil {
+		return registry.Descriptor{}, fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return registry.Descriptor{}, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+
+	digest := "sha256:" + hex.EncodeToString(h.Sum(nil))
+	r.blobs[digest] = file
+
+	return registry.Descriptor{
+		MediaType: mediaType,
+		Digest:    digest,
+		Size:      size,
+	}, nil
+}
+
+// ReadManifest reads and parses a manifest referenced by a descriptor
+func (r *Reader) ReadManifest(desc registry.Descriptor) (*registry.Manifest, error) {
+	data, ok := r.manifests[desc.Digest]
+	if !ok {
+		file, err := r.blobFile(desc.Digest)
+		if err != nil {
+			return nil, err
+		}
+		data, err = os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("manifest %s not found in bundle: %w", desc.Digest, err)
+		}
+	}
+
+	var manifest registry.Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %w", desc.Digest, err)
+	}
+	manifest.Raw = data
+	if manifest.MediaType == "" {
+		manifest.MediaType = desc.MediaType
+	}
+
+	return &manifest, nil
+}
+
+// HasBlob reports whether the bundle contains a blob
+func (r *Reader) HasBlob(digest string) bool {
+	file, err := r.blobFile(digest)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(file)
+	return err == nil
+}
+
+// OpenBlob opens a blob for reading
+func (r *Reader) OpenBlob(digest string) (io.ReadCloser, int64, error) {
+	file, err := r.blobFile(digest)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, 0, fmt.Errorf("blob %s not found in bundle: %w", digest, err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+
+	return f, info.Size(), nil
+}
+
+// blobFile returns the file holding a blob
+func (r *Reader) blobFile(digest string) (string, error) {
+	if file, ok := r.blobs[digest]; ok {
+		return file, nil
+	}
+
+	name, err := BlobPath(digest)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(r.root, filepath.FromSlash(name)), nil
+}
+
+// stripRegistryHost removes a leading registry host (docker.io/, localhost:5000/, ...)
+func stripRegistryHost(repository string) string {
+	parts := strings.SplitN(repository, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		return parts[1]
+	}
+	return repository
+}
+
+// isGzipFile reports whether a file starts with the gzip magic bytes
+func isGzipFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	magic := make([]byte, 2)
+	if _, err := io.ReadFull(f, magic); err != nil {
+		return false
+	}
+	return magic[0] == 0x1f && magic[1] == 0x8b
+}
+
+// extractArchive extracts a (possibly gzip or zstd compressed) tar archive.
+// No symlinks are created: a symlink entry is extracted as a copy of the
+// file it links to, so later entries can not be written through a link to
+// outside dest.
+func extractArchive(path, dest string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	magic, _ := br.Peek(4)
+
+	var in io.Reader = br
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		in = zr
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer gr.Close()
+		in = gr
+	}
+
+	tr := tar.NewReader(in)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name, err := archivePath(hdr.Name)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, name)
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := extractFile(target, tr); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			// docker save links duplicate layers to their first occurrence,
+			// which precedes the link in the archive
+			linked, err := archivePath(filepath.Join(filepath.Dir(name), filepath.FromSlash(hdr.Linkname)))
+			if err != nil || filepath.IsAbs(hdr.Linkname) {
+				return fmt.Errorf("invalid link in archive: %s -> %s", hdr.Name, hdr.Linkname)
+			}
+			info, err := os.Lstat(filepath.Join(dest, linked))
+			if err != nil || !info.Mode().IsRegular() {
+				return fmt.Errorf("invalid link in archive: %s -> %s: not an extracted file", hdr.Name, hdr.Linkname)
+			}
+			src, err := os.Open(filepath.Join(dest, linked))
+			if err != nil {
+				return err
+			}
+			err = extractFile(target, src)
+			src.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// archivePath cleans the path of an archive entry and rejects paths that
+// leave the extraction directory
+func archivePath(name string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid path in archive: %s", name)
+	}
+	return clean, nil
+}
+
+// extractFile writes the content of an archive entry to target. An existing
+// target is replaced, never written through.
+func extractFile(target string, content io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	if info, err := os.Lstat(target); err == nil && !info.Mode().IsRegular() {
+		return fmt.Errorf("invalid path in archive: %s is not a regular file", target)
+	}
+
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, content); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,376 @@
+package ocilayout
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	"registry-sync/pkg/registry"
+)
+
+// Writer writes images into an OCI image layout directory or tarball.
+// Blobs are deduplicated across all images written to the same Writer.
+type Writer struct {
+	path  string
+	sink  sink
+	blobs map[string]bool
+	known KnownBlobs // blobs the receiving side already has, left out of the bundle
+	index Index
+	mu    sync.Mutex
+}
+
+// sink stores layout files in a directory or an archive
+type sink interface {
+	// writeBlob stores verified blob content under its layout path
+	writeBlob(name string, content io.Reader, verifier *digestVerifier) error
+	// writeFile stores a small metadata file
+	writeFile(name string, data []byte) error
+	close() error
+}
+
+// NewWriter creates a layout writer for the given path.
+// Paths ending in .tar or .tar.zst produce an archive, anything else a directory.
+// An existing layout directory is extended rather than replaced.
+func NewWriter(path string) (*Writer, error) {
+	w := &Writer{
+		path:  path,
+		blobs: make(map[string]bool),
+		known: make(KnownBlobs),
+		index: Index{
+			SchemaVersion: 2,
+			MediaType:     registry.MediaTypeOCIIndex,
+		},
+	}
+
+	if IsTarball(path) {
+		s, err := newTarSink(path)
+		if err != nil {
+			return nil, err
+		}
+		w.sink = s
+		return w, nil
+	}
+
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create layout directory: %w", err)
+	}
+	if err := w.loadExisting(); err != nil {
+		return nil, err
+	}
+	w.sink = &dirSink{root: path}
+
+	return w, nil
+}
+
+// loadExisting loads index.json and known blobs from an existing layout directory
+func (w *Writer) loadExisting() error {
+	data, err := os.ReadFile(filepath.Join(w.path, IndexFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read existing index: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &w.index); err != nil {
+		return fmt.Errorf("failed to parse existing index: %w", err)
+	}
+
+	algorithms, err := os.ReadDir(filepath.Join(w.path, BlobsDir))
+	if err != nil {
+		return nil
+	}
+	for _, algorithm := range algorithms {
+		entries, err := os.ReadDir(filepath.Join(w.path, BlobsDir, algorithm.Name()))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			w.blobs[algorithm.Name()+":"+entry.Name()] = true
+		}
+	}
+
+	return nil
+}
+
+// Path returns the layout path
+func (w *Writer) Path() string {
+	return w.path
+}
+
+// AddKnownBlobs marks blobs as already present on the receiving side.
+// Manifests are always written, even when they are known.
+func (w *Writer) AddKnownBlobs(known KnownBlobs) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for digest := range known {
+		w.known[digest] = true
+	}
+}
+
+// HasBlob reports whether a blob has already been written or is known to the receiving side
+func (w *Writer) HasBlob(digest string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.blobs[digest] || w.known[digest]
+}
+
+// IsKnown reports whether a blob is left out because the receiving side already has it
+func (w *Writer) IsKnown(digest string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.known[digest] && !w.blobs[digest]
+}
+
+// WriteBlob writes a blob, verifying its digest. Blobs already present are skipped.
+func (w *Writer) WriteBlob(digest string, content io.Reader) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.blobs[digest] {
+		return nil
+	}
+
+	name, err := BlobPath(digest)
+	if err != nil {
+		return err
+	}
+
+	verifier, err := newDigestVerifier(digest)
+	if err != nil {
+		return err
+	}
+
+	if err := w.sink.writeBlob(name, content, verifier); err != nil {
+		return fmt.Errorf("failed to write blob %s: %w", digest, err)
+	}
+
+	w.blobs[digest] = true
+	return nil
+}
+
+// WriteManifest writes a manifest as a blob and returns its descriptor
+func (w *Writer) WriteManifest(manifest *registry.Manifest) (registry.Descriptor, error) {
+	desc := registry.Descriptor{
+		MediaType: manifest.ContentType(),
+		Digest:    manifest.Digest(),
+		Size:      int64(len(manifest.Raw)),
+	}
+
+	if err := w.WriteBlob(desc.Digest, bytes.NewReader(manifest.Raw)); err != nil {
+		return registry.Descriptor{}, err
+	}
+
+	return desc, nil
+}
+
+// AddRef records a manifest in index.json under the given ref name,
+// replacing any existing entry with the same name
+func (w *Writer) AddRef(desc registry.Descriptor, refName string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	desc.Annotations = map[string]string{AnnotationRefName: refName}
+
+	for i, existing := range w.index.Manifests {
+		if existing.Annotations[AnnotationRefName] == refName {
+			w.index.Manifests[i] = desc
+			return
+		}
+	}
+	w.index.Manifests = append(w.index.Manifests, desc)
+}
+
+// Close writes oci-layout and index.json and finalizes the bundle
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	layout, err := json.Marshal(Layout{Version: LayoutVersion})
+	if err != nil {
+		return err
+	}
+	if err := w.sink.writeFile(LayoutFile, layout); err != nil {
+		return fmt.Errorf("failed to write %s: %w", LayoutFile, err)
+	}
+
+	if w.index.Manifests == nil {
+		w.index.Manifests = []registry.Descriptor{}
+	}
+	index, err := json.MarshalIndent(w.index, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := w.sink.writeFile(IndexFile, index); err != nil {
+		return fmt.Errorf("failed to write %s: %w", IndexFile, err)
+	}
+
+	return w.sink.close()
+}
+
+// dirSink writes a layout into a directory
+type dirSink struct {
+	root string
+}
+
+func (s *dirSink) writeBlob(name string, content io.Reader, verifier *digestVerifier) error {
+	target := filepath.Join(s.root, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file so that a failed download never leaves a partial blob
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(io.MultiWriter(tmp, verifier), content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := verifier.Verify(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), target)
+}
+
+func (s *dirSink) writeFile(name string, data []byte) error {
+	return os.WriteFile(filepath.Join(s.root, name), data, 0644)
+}
+
+func (s *dirSink) close() error {
+	return nil
+}
+
+// tarSink writes a layout into a (optionally zstd-compressed) tar archive
+type tarSink struct {
+	file *os.File
+	zw   *zstd.Encoder
+	tw   *tar.Writer
+	dirs map[string]bool
+}
+
+func newTarSink(path string) (*tarSink, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create output directory: %w", err)
+		}
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create bundle: %w", err)
+	}
+
+	s := &tarSink{file: file, dirs: make(map[string]bool)}
+
+	var out io.Writer = file
+	if IsZstd(path) {
+		zw, err := zstd.NewWriter(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		s.zw = zw
+		out = zw
+	}
+	s.tw = tar.NewWriter(out)
+
+	return s, nil
+}
+
+// writeBlob spools the blob to a temporary file first: tar entries need their
+// size up front, and a failed or corrupt download must not end up in the archive
+func (s *tarSink) writeBlob(name string, content io.Reader, verifier *digestVerifier) error {
+	tmp, err := os.CreateTemp("", "registry-sync-blob-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+
+	size, err := io.Copy(io.MultiWriter(tmp, verifier), content)
+	if err != nil {
+		return err
+	}
+	if err := verifier.Verify(); err != nil {
+		return err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	if err := s.ensureDirs(filepath.ToSlash(filepath.Dir(name))); err != nil {
+		return err
+	}
+	if err := s.tw.WriteHeader(s.header(name, size)); err != nil {
+		return err
+	}
+	_, err = io.Copy(s.tw, tmp)
+	return err
+}
+
+func (s *tarSink) writeFile(name string, data []byte) error {
+	if err := s.tw.WriteHeader(s.header(name, int64(len(data)))); err != nil {
+		return err
+	}
+	_, err := s.tw.Write(data)
+	return err
+}
+
+// ensureDirs writes directory entries for a path and its parents
+func (s *tarSink) ensureDirs(dir string) error {
+	if dir == "." || dir == "" || s.dirs[dir] {
+		return nil
+	}
+	if err := s.ensureDirs(filepath.ToSlash(filepath.Dir(dir))); err != nil {
+		return err
+	}
+	s.dirs[dir] = true
+	return s.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     dir + "/",
+		Mode:     0755,
+		ModTime:  time.Now(),
+	})
+}
+
+func (s *tarSink) header(name string, size int64) *tar.Header {
+	return &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0644,
+		ModTime:  time.Now(),
+	}
+}
+
+func (s *tarSink) close() error {
+	if err := s.tw.Close(); err != nil {
+		s.file.Close()
+		return err
+	}
+	if s.zw != nil {
+		if err := s.zw.Close(); err != nil {
+			s.file.Close()
+			return err
+		}
+	}
+	return s.file.Close()
+}
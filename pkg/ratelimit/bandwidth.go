@@ -0,0 +1,322 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Byte size units accepted in bandwidth limits
+var byteUnits = []struct {
+	suffix string
+	size   float64
+}{
+	{"gib", 1 << 30}, {"gb", 1 << 30}, {"g", 1 << 30},
+	{"mib", 1 << 20}, {"mb", 1 << 20}, {"m", 1 << 20},
+	{"kib", 1 << 10}, {"kb", 1 << 10}, {"k", 1 << 10},
+	{"b", 1},
+}
+
+// BandwidthWindow limits bandwidth during a daily time window
+type BandwidthWindow struct {
+	Start       time.Duration // offset from midnight, local time
+	End         time.Duration // exclusive; a window ending before it starts wraps past midnight
+	BytesPerSec int64         // 0 = unlimited
+}
+
+// contains reports whether the time of day falls into the window
+func (w BandwidthWindow) contains(offset time.Duration) bool {
+	if w.Start <= w.End {
+		return offset >= w.Start && offset < w.End
+	}
+	return offset >= w.Start || offset < w.End
+}
+
+// BandwidthSchedule is a bandwidth limit that can change over the day.
+// The first window containing the current time applies; outside all
+// windows the default limit applies.
+type BandwidthSchedule struct {
+	Default int64 // bytes per second, 0 = unlimited
+	Windows []BandwidthWindow
+}
+
+// ParseBandwidthSchedule parses a comma separated bandwidth schedule.
+// Each entry is either a default limit ("50MB") or a daily window
+// ("08:00-20:00=20MB"). Limits are bytes per second with an optional unit
+// (B, KB, MB, GB; 1024 based) and an optional "/s" suffix; "0" or
+// "unlimited" disables limiting. Examples:
+//
+//	20MB                      always 20 MB/s
+//	08:00-20:00=20MB          20 MB/s during business hours, unlimited at night
+//	100MB,08:00-20:00=20MB    20 MB/s during business hours, 100 MB/s at night
+//
+// An empty string returns a nil schedule.
+func ParseBandwidthSchedule(spec string) (*BandwidthSchedule, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+
+	schedule := &BandwidthSchedule{}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		window, limit, ok := strings.Cut(entry, "=")
+		if !ok {
+			bytesPerSec, err := ParseBandwidth(entry)
+			if err != nil {
+				return nil, err
+			}
+			schedule.Default = bytesPerSec
+			continue
+		}
+
+		startStr, endStr, ok := strings.Cut(window, "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid bandwidth window %q: expected HH:MM-HH:MM", window)
+		}
+		start, err := parseTimeOfDay(startStr)
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseTimeOfDay(endStr)
+		if err != nil {
+			return nil, err
+		}
+		if start == end {
+			return nil, fmt.Errorf("invalid bandwidth window %q: start equals end", window)
+		}
+		bytesPerSec, err := ParseBandwidth(limit)
+		if err != nil {
+			return nil, err
+		}
+
+		schedule.Windows = append(schedule.Windows, BandwidthWindow{Start: start, End: end, BytesPerSec: bytesPerSec})
+	}
+
+	return schedule, nil
+}
+
+// ParseBandwidth parses a bandwidth limit such as "20MB", "512KB/s" or "unlimited" into bytes per second
+func ParseBandwidth(s string) (int64, error) {
+	value := strings.ToLower(strings.TrimSpace(s))
+	value = strings.TrimSuffix(value, "/s")
+	if value == "" || value == "unlimited" {
+		return 0, nil
+	}
+
+	multiplier := 1.0
+	for _, unit := range byteUnits {
+		if strings.HasSuffix(value, unit.suffix) {
+			multiplier = unit.size
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || !(n >= 0) || math.IsInf(n, 0) {
+		return 0, fmt.Errorf("invalid bandwidth limit %q", s)
+	}
+	return int64(n * multiplier), nil
+}
+
+// parseTimeOfDay parses "HH:MM" into an offset from midnight
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q: expected HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// FormatBandwidth formats bytes per second for display
+func FormatBandwidth(bytesPerSec int64) string {
+	switch {
+	case bytesPerSec <= 0:
+		return "unlimited"
+	case bytesPerSec >= 1<<30:
+		return fmt.Sprintf("%.1fGB/s", float64(bytesPerSec)/(1<<30))
+	case bytesPerSec >= 1<<20:
+		return fmt.Sprintf("%.1fMB/s", float64(bytesPerSec)/(1<<20))
+	case bytesPerSec >= 1<<10:
+		return fmt.Sprintf("%.1fKB/s", float64(bytesPerSec)/(1<<10))
+	default:
+		return fmt.Sprintf("%dB/s", bytesPerSec)
+	}
+}
+
+// RateAt returns the limit in bytes per second at the given time, 0 = unlimited
+func (s *BandwidthSchedule) RateAt(t time.Time) int64 {
+	if s == nil {
+		return 0
+	}
+
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	offset := t.Sub(midnight)
+	for _, w := range s.Windows {
+		if w.contains(offset) {
+			return w.BytesPerSec
+		}
+	}
+	return s.Default
+}
+
+// BandwidthLimiter limits the byte rate of blob streams. The limit follows
+// its schedule and is re-evaluated as data flows, so a long transfer picks
+// up a window change without being restarted.
+type BandwidthLimiter struct {
+	schedule *BandwidthSchedule
+
+	mu      sync.Mutex
+	limiter *rate.Limiter // nil while unlimited
+	current int64
+}
+
+// NewBandwidthLimiter creates a bandwidth limiter following the schedule.
+// A nil schedule never limits.
+func NewBandwidthLimiter(schedule *BandwidthSchedule) *BandwidthLimiter {
+	return &BandwidthLimiter{schedule: schedule}
+}
+
+// refresh applies the limit of the schedule at now and returns the token
+// bucket, nil if currently unlimited
+func (b *BandwidthLimiter) refresh(now time.Time) *rate.Limiter {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	bytesPerSec := b.schedule.RateAt(now)
+	if bytesPerSec == b.current {
+		return b.limiter
+	}
+	b.current = bytesPerSec
+
+	if bytesPerSec <= 0 {
+		b.limiter = nil
+		return nil
+	}
+
+	// Allow bursts of one second worth of data; larger reads are split
+	if b.limiter == nil {
+		b.limiter = rate.NewLimiter(rate.Limit(bytesPerSec), int(bytesPerSec))
+	} else {
+		b.limiter.SetLimitAt(now, rate.Limit(bytesPerSec))
+		b.limiter.SetBurstAt(now, int(bytesPerSec))
+	}
+	return b.limiter
+}
+
+// WaitN blocks until n bytes may be transferred
+func (b *BandwidthLimiter) WaitN(ctx context.Context, n int) error {
+	for n > 0 {
+		limiter := b.refresh(time.Now())
+		if limiter == nil {
+			return nil
+		}
+
+		chunk := n
+		if burst := limiter.Burst(); chunk > burst {
+			chunk = burst
+		}
+		if err := limiter.WaitN(ctx, chunk); err != nil {
+			return err
+		}
+		n -= chunk
+	}
+	return nil
+}
+
+// Rate returns the current limit in bytes per second, 0 = unlimited
+func (b *BandwidthLimiter) Rate() int64 {
+	return b.schedule.RateAt(time.Now())
+}
+
+// limitedReader charges every read against a set of bandwidth limiters
+type limitedReader struct {
+	ctx      context.Context
+	r        io.Reader
+	limiters []*BandwidthLimiter
+}
+
+// NewReader wraps r so that reads are limited by all given limiters.
+// Nil limiters are ignored; r is returned as is if none remain.
+func NewReader(ctx context.Context, r io.Reader, limiters ...*BandwidthLimiter) io.Reader {
+	active := activeLimiters(limiters)
+	if len(active) == 0 {
+		return r
+	}
+	return &limitedReader{ctx: ctx, r: r, limiters: active}
+}
+
+// Read implements io.Reader
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	if n > 0 {
+		for _, limiter := range l.limiters {
+			if waitErr := limiter.WaitN(l.ctx, n); waitErr != nil {
+				return n, waitErr
+			}
+		}
+	}
+	return n, err
+}
+
+// NewReadCloser is NewReader for an io.ReadCloser, e.g. a response body
+func NewReadCloser(ctx context.Context, rc io.ReadCloser, limiters ...*BandwidthLimiter) io.ReadCloser {
+	active := activeLimiters(limiters)
+	if len(active) == 0 {
+		return rc
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{&limitedReader{ctx: ctx, r: rc, limiters: active}, rc}
+}
+
+// limitedWriter charges every write against a set of bandwidth limiters
+type limitedWriter struct {
+	ctx      context.Context
+	w        io.Writer
+	limiters []*BandwidthLimiter
+}
+
+// NewWriter wraps w so that writes are limited by all given limiters.
+// Nil limiters are ignored; w is returned as is if none remain.
+func NewWriter(ctx context.Context, w io.Writer, limiters ...*BandwidthLimiter) io.Writer {
+	active := activeLimiters(limiters)
+	if len(active) == 0 {
+		return w
+	}
+	return &limitedWriter{ctx: ctx, w: w, limiters: active}
+}
+
+// Write implements io.Writer
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	for _, limiter := range l.limiters {
+		if err := limiter.WaitN(l.ctx, len(p)); err != nil {
+			return 0, err
+		}
+	}
+	return l.w.Write(p)
+}
+
+// activeLimiters drops nil limiters and limiters without a schedule
+func activeLimiters(limiters []*BandwidthLimiter) []*BandwidthLimiter {
+	var active []*BandwidthLimiter
+	for _, limiter := range limiters {
+		if limiter != nil && limiter.schedule != nil {
+			active = append(active, limiter)
+		}
+	}
+	return active
+}
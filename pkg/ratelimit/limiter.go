@@ -2,15 +2,40 @@ package ratelimit
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"golang.org/x/time/rate"
 )
 
-// Limiter provides rate limiting functionality
+// Adaptive rate limiting parameters
+const (
+	// unlimitedStartQPS is the rate an unlimited limiter falls back to when it is first throttled
+	unlimitedStartQPS = 20
+	// minQPS is the lowest rate the limiter decreases to
+	minQPS = 0.1
+	// decreaseFactor is applied to the rate on every throttle signal
+	decreaseFactor = 0.5
+	// decreaseCooldown prevents concurrent throttled requests from cutting the rate repeatedly
+	decreaseCooldown = time.Second
+	// recoveryInterval is how long the limiter must go unthrottled before adding one QPS
+	recoveryInterval = 5 * time.Second
+	// MaxPause caps how long a single throttle signal may pause requests
+	MaxPause = 5 * time.Minute
+)
+
+// Limiter provides rate limiting functionality.
+// It adapts to throttling by the server: Throttle pauses requests and halves
+// the rate, Success adds one QPS per recovery interval until the configured
+// rate is reached again (AIMD).
 type Limiter struct {
-	limiter *rate.Limiter
-	enabled bool
+	mu         sync.Mutex
+	limiter    *rate.Limiter // replaced and enabled while adapting, read with bucket
+	enabled    bool
+	ceiling    float64   // configured rate, 0 = unlimited
+	current    float64   // effective rate while adapting, 0 = not adapting
+	pauseUntil time.Time // no requests before this time
+	lastAdjust time.Time
 }
 
 // NewLimiter creates a new rate limiter
@@ -23,55 +48,209 @@ func NewLimiter(qps int) *Limiter {
 	return &Limiter{
 		limiter: rate.NewLimiter(rate.Limit(qps), qps),
 		enabled: true,
+		ceiling: float64(qps),
 	}
 }
 
 // Wait blocks until the limiter permits an event
 func (l *Limiter) Wait(ctx context.Context) error {
-	if !l.enabled {
+	l.mu.Lock()
+	wait := time.Until(l.pauseUntil)
+	l.mu.Unlock()
+
+	// Paused by a throttle signal
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+
+	enabled, limiter := l.bucket()
+	if !enabled {
 		return nil
 	}
-	return l.limiter.Wait(ctx)
+	return limiter.Wait(ctx)
+}
+
+// bucket returns whether the limiter is enabled and its token bucket. The
+// bucket synchronizes itself, only the fields need the lock.
+func (l *Limiter) bucket() (bool, *rate.Limiter) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.enabled, l.limiter
 }
 
 // Allow reports whether an event may happen now
 func (l *Limiter) Allow() bool {
-	if !l.enabled {
+	l.mu.Lock()
+	paused := time.Now().Before(l.pauseUntil)
+	l.mu.Unlock()
+
+	if paused {
+		return false
+	}
+	enabled, limiter := l.bucket()
+	if !enabled {
 		return true
 	}
-	return l.limiter.Allow()
+	return limiter.Allow()
 }
 
 // Reserve returns a Reservation that indicates how long the caller must wait
 func (l *Limiter) Reserve() *rate.Reservation {
-	if !l.enabled {
+	enabled, limiter := l.bucket()
+	if !enabled {
 		return nil
 	}
-	return l.limiter.Reserve()
+	return limiter.Reserve()
 }
 
 // SetQPS updates the rate limit
 func (l *Limiter) SetQPS(qps int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.current = 0
 	if qps <= 0 {
+		l.ceiling = 0
 		l.enabled = false
 		return
 	}
 
-	if l.limiter == nil {
-		l.limiter = rate.NewLimiter(rate.Limit(qps), qps)
-	} else {
-		l.limiter.SetLimit(rate.Limit(qps))
-		l.limiter.SetBurst(qps)
-	}
-	l.enabled = true
+	l.ceiling = float64(qps)
+	l.apply(l.ceiling)
 }
 
 // GetQPS returns the current QPS limit
 func (l *Limiter) GetQPS() int {
-	if !l.enabled {
+	enabled, limiter := l.bucket()
+	if !enabled {
 		return 0
 	}
-	return int(l.limiter.Limit())
+	return int(limiter.Limit())
+}
+
+// Throttle handles a throttling response: requests are paused for wait
+// (capped at MaxPause) and the rate is multiplicatively decreased
+func (l *Limiter) Throttle(wait time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if wait > MaxPause {
+		wait = MaxPause
+	}
+	if until := now.Add(wait); until.After(l.pauseUntil) {
+		l.pauseUntil = until
+	}
+
+	if now.Sub(l.lastAdjust) < decreaseCooldown {
+		return
+	}
+
+	qps := l.current
+	if qps == 0 {
+		qps = l.ceiling
+		if qps == 0 {
+			qps = unlimitedStartQPS
+		}
+	}
+	qps *= decreaseFactor
+	if qps < minQPS {
+		qps = minQPS
+	}
+
+	l.current = qps
+	l.lastAdjust = now
+	l.apply(qps)
+}
+
+// Pause pauses requests until the given time without changing the rate,
+// e.g. when the server reports that no requests remain in the current window
+func (l *Limiter) Pause(until time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if limit := time.Now().Add(MaxPause); until.After(limit) {
+		until = limit
+	}
+	if until.After(l.pauseUntil) {
+		l.pauseUntil = until
+	}
+}
+
+// Success records a request that was not throttled, additively recovering
+// the rate once per recovery interval
+func (l *Limiter) Success() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.current == 0 {
+		return
+	}
+
+	now := time.Now()
+	if now.Sub(l.lastAdjust) < recoveryInterval {
+		return
+	}
+	l.lastAdjust = now
+
+	l.current++
+	ceiling := l.ceiling
+	if ceiling == 0 {
+		ceiling = unlimitedStartQPS
+	}
+	if l.current < ceiling {
+		l.apply(l.current)
+		return
+	}
+
+	// Fully recovered
+	l.current = 0
+	if l.ceiling == 0 {
+		l.enabled = false
+		return
+	}
+	l.apply(l.ceiling)
+}
+
+// Rate returns the effective rate in requests per second, 0 means unlimited
+func (l *Limiter) Rate() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.current > 0 {
+		return l.current
+	}
+	return l.ceiling
+}
+
+// PausedUntil returns the time until which requests are paused
+func (l *Limiter) PausedUntil() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.pauseUntil
+}
+
+// apply sets the token bucket to a rate. The caller must hold l.mu.
+func (l *Limiter) apply(qps float64) {
+	burst := int(qps)
+	if burst < 1 {
+		burst = 1
+	}
+
+	if l.limiter == nil {
+		l.limiter = rate.NewLimiter(rate.Limit(qps), burst)
+	} else {
+		l.limiter.SetLimit(rate.Limit(qps))
+		l.limiter.SetBurst(burst)
+	}
+	l.enabled = true
 }
 
 // MultiLimiter combines multiple rate limiters
@@ -96,9 +275,9 @@ func (m *MultiLimiter) Wait(ctx context.Context) error {
 
 // WaitN blocks until all limiters permit N events
 func (m *MultiLimiter) WaitN(ctx context.Context, n int) error {
-	for _, limiter := range m.limiters {
-		if limiter.enabled {
-			if err := limiter.limiter.WaitN(ctx, n); err != nil {
+	for _, l := range m.limiters {
+		if enabled, limiter := l.bucket(); enabled {
+			if err := limiter.WaitN(ctx, n); err != nil {
 				return err
 			}
 		}
@@ -8,6 +8,9 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+
+	"registry-sync/pkg/ratelimit"
 )
 
 // BlobExists checks if a blob exists in the registry
@@ -32,22 +35,24 @@ func (c *Client) BlobExists(ctx context.Context, repository, digest string) (boo
 		return false, 0, nil
 	}
 
-	return false, 0, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	return false, 0, newError("check blob", resp)
 }
 
 // GetBlob downloads a blob from the registry
 func (c *Client) GetBlob(ctx context.Context, repository, digest string) (io.ReadCloser, int64, error) {
 	path := fmt.Sprintf("/v2/%s/blobs/%s", repository, digest)
 
+	ctx, watch := watchStall(ctx, c.StallTimeout)
 	resp, err := c.doRequest(ctx, "GET", path, nil, nil)
 	if err != nil {
+		err = watch.err(err)
+		watch.stop()
 		return nil, 0, err
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		resp.Body.Close()
-		body, _ := io.ReadAll(resp.Body)
-		return nil, 0, fmt.Errorf("failed to get blob: %d %s", resp.StatusCode, string(body))
+		watch.stop()
+		return nil, 0, newError("get blob", resp)
 	}
 
 	size := int64(0)
@@ -55,7 +60,11 @@ func (c *Client) GetBlob(ctx context.Context, repository, digest string) (io.Rea
 		size, _ = strconv.ParseInt(contentLength, 10, 64)
 	}
 
-	return resp.Body, size, nil
+	body := resp.Body
+	if watch != nil {
+		body = watch.downloadReader(body)
+	}
+	return ratelimit.NewReadCloser(ctx, body, c.Bandwidth...), size, nil
 }
 
 // PutBlob uploads a blob to the registry
@@ -67,7 +76,14 @@ func (c *Client) PutBlob(ctx context.Context, repository, digest string, content
 	}
 
 	// Step 2: Upload content (returns new Location)
-	newUploadURL, err := c.uploadContent(ctx, uploadURL, content, size)
+	uploadCtx, watch := watchStall(ctx, c.StallTimeout)
+	content = ratelimit.NewReader(uploadCtx, content, c.Bandwidth...)
+	if watch != nil {
+		content = watch.uploadReader(content)
+	}
+	newUploadURL, err := c.uploadContent(uploadCtx, uploadURL, content, size)
+	err = watch.err(err)
+	watch.stop()
 	if err != nil {
 		return fmt.Errorf("failed to upload content: %w", err)
 	}
@@ -101,8 +117,7 @@ func (c *Client) initiateUpload(ctx context.Context, repository, digest string)
 	}
 
 	if resp.StatusCode != http.StatusAccepted {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("failed to initiate upload: %d %s", resp.StatusCode, string(body))
+		return "", newError("initiate upload", resp)
 	}
 
 	location := resp.Header.Get("Location")
@@ -132,19 +147,16 @@ func (c *Client) uploadContent(ctx context.Context, uploadURL string, content io
 	}
 
 	// Add authentication
-	if c.Username != "" && c.Password != "" {
-		req.SetBasicAuth(c.Username, c.Password)
-	}
+	c.setAuth(req, tokenKey(req.URL.Path))
 
-	resp, err := c.HTTPClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return "", err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusAccepted {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("failed to upload content: %d %s", resp.StatusCode, string(body))
+		return "", newError("upload content", resp)
 	}
 
 	// Get the new Location for completing the upload
@@ -181,19 +193,16 @@ func (c *Client) completeUpload(ctx context.Context, uploadURL, digest string) e
 	req.Header.Set("Content-Length", "0")
 
 	// Add authentication
-	if c.Username != "" && c.Password != "" {
-		req.SetBasicAuth(c.Username, c.Password)
-	}
+	c.setAuth(req, tokenKey(req.URL.Path))
 
-	resp, err := c.HTTPClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusCreated {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed to complete upload: %d %s", resp.StatusCode, string(body))
+		return newError("complete upload", resp)
 	}
 
 	return nil
@@ -219,39 +228,94 @@ func (c *Client) MountBlob(ctx context.Context, fromRepo, toRepo, digest string)
 		return false, nil
 	}
 
-	body, _ := io.ReadAll(resp.Body)
-	return false, fmt.Errorf("failed to mount blob: %d %s", resp.StatusCode, string(body))
+	return false, newError("mount blob", resp)
+}
+
+// CopyResult describes how CopyBlob brought a blob into the target
+type CopyResult struct {
+	Existed  bool // Already present in the target
+	Mounted  bool // Mounted from another repository of the target
+	CacheHit bool // Uploaded from the source's blob cache without downloading
+	Cached   bool // Downloaded through the source's blob cache (a cache miss)
 }
 
-// CopyBlob copies a blob from source to target
-func CopyBlob(ctx context.Context, source *Client, target *Client, sourceRepo, targetRepo, digest string, size int64) error {
+// CopyBlob copies a blob from source to target.
+// If the source has a BlobCache, the blob is read through it.
+func CopyBlob(ctx context.Context, source *Client, target *Client, sourceRepo, targetRepo, digest string, size int64) (CopyResult, error) {
+	var result CopyResult
+
 	// Check if blob already exists in target
 	exists, _, err := target.BlobExists(ctx, targetRepo, digest)
 	if err != nil {
-		return fmt.Errorf("failed to check blob existence: %w", err)
+		return result, fmt.Errorf("failed to check blob existence: %w", err)
 	}
 
 	if exists {
-		return nil // Already exists, skip
+		result.Existed = true
+		return result, nil // Already exists, skip
 	}
 
 	// Try to mount blob (if target supports cross-repo mount)
 	mounted, err := target.MountBlob(ctx, targetRepo, targetRepo, digest)
 	if err == nil && mounted {
-		return nil // Successfully mounted
+		result.Mounted = true
+		return result, nil // Successfully mounted
 	}
 
 	// Download from source
-	reader, _, err := source.GetBlob(ctx, sourceRepo, digest)
+	var reader io.ReadCloser
+	if source.BlobCache != nil {
+		var hit bool
+		reader, _, hit, err = source.BlobCache.Open(ctx, digest, func() (io.ReadCloser, int64, error) {
+			return source.GetBlob(ctx, sourceRepo, digest)
+		})
+		result.CacheHit = hit
+		result.Cached = !hit
+	} else {
+		reader, _, err = source.GetBlob(ctx, sourceRepo, digest)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to download blob: %w", err)
+		return result, &DownloadError{Err: err}
 	}
 	defer reader.Close()
 
-	// Upload to target
-	if err := target.PutBlob(ctx, targetRepo, digest, reader, size); err != nil {
-		return fmt.Errorf("failed to upload blob: %w", err)
+	// Upload to target, the upload fails as well when the download does
+	src := &sourceReader{r: reader}
+	if err := target.PutBlob(ctx, targetRepo, digest, src, size); err != nil {
+		if readErr := src.readErr(); readErr != nil {
+			return result, &DownloadError{Err: readErr}
+		}
+		return result, fmt.Errorf("failed to upload blob: %w", err)
 	}
 
-	return nil
+	return result, nil
+}
+
+// sourceReader records the error of reading a blob from the source, so a
+// copy whose download failed is told apart from a failed upload. The
+// transport may read it from another goroutine.
+type sourceReader struct {
+	r io.Reader
+
+	mu  sync.Mutex
+	err error
+}
+
+// Read implements io.Reader
+func (r *sourceReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil && err != io.EOF {
+		r.mu.Lock()
+		r.err = err
+		r.mu.Unlock()
+	}
+	return n, err
+}
+
+// readErr returns the error of the failed read, nil if reading did not fail
+func (r *sourceReader) readErr() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.err
 }
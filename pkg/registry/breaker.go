@@ -0,0 +1,174 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Default circuit breaker settings
+const (
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = 30 * time.Second
+)
+
+// Circuit breaker states
+const (
+	BreakerClosed   = "closed"    // Requests pass through
+	BreakerOpen     = "open"      // Requests fail fast until the cool-down has passed
+	BreakerHalfOpen = "half-open" // A single probe request decides whether to close again
+)
+
+// CircuitOpenError is returned without contacting the registry while its
+// circuit breaker is open. It is not retryable: retrying before RetryAt
+// fails the same way.
+type CircuitOpenError struct {
+	URL       string
+	RetryAt   time.Time
+	LastError string
+}
+
+// Error implements error
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit breaker open for %s until %s (last error: %s)",
+		e.URL, e.RetryAt.Format(time.RFC3339), e.LastError)
+}
+
+// IsCircuitOpen reports whether err was caused by an open circuit breaker
+func IsCircuitOpen(err error) bool {
+	var openErr *CircuitOpenError
+	return errors.As(err, &openErr)
+}
+
+// BreakerState is a snapshot of a circuit breaker
+type BreakerState struct {
+	State     string     `json:"state"`
+	Failures  int        `json:"failures"` // Consecutive failures
+	OpenedAt  *time.Time `json:"opened_at,omitempty"`
+	RetryAt   *time.Time `json:"retry_at,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+}
+
+// breaker is the circuit breaker of a registry endpoint. It is shared by all
+// copies of a client, so every execution using the endpoint sees the same state.
+type breaker struct {
+	mu        sync.Mutex
+	url       string
+	threshold int           // Consecutive failures that open the breaker, 0 = disabled
+	cooldown  time.Duration // How long the breaker stays open before a probe
+
+	failures  int
+	openedAt  time.Time
+	probing   bool // A half-open probe is in flight
+	lastError string
+}
+
+func newBreaker(url string) *breaker {
+	return &breaker{url: url, threshold: DefaultBreakerThreshold, cooldown: DefaultBreakerCooldown}
+}
+
+// state returns the current state, caller must hold mu
+func (b *breaker) state() string {
+	switch {
+	case b.threshold <= 0 || b.failures < b.threshold:
+		return BreakerClosed
+	case time.Since(b.openedAt) < b.cooldown:
+		return BreakerOpen
+	default:
+		return BreakerHalfOpen
+	}
+}
+
+// allow reports whether a request may be sent. Once the cool-down has passed
+// one request is let through as a probe; the others keep failing fast until
+// the probe has finished.
+func (b *breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state() {
+	case BreakerClosed:
+		return nil
+	case BreakerHalfOpen:
+		if !b.probing {
+			b.probing = true
+			return nil
+		}
+	}
+
+	return &CircuitOpenError{URL: b.url, RetryAt: b.openedAt.Add(b.cooldown), LastError: b.lastError}
+}
+
+// record feeds the outcome of a request into the breaker. Transport errors
+// and 5xx responses count as failures; anything else, including client
+// errors and throttling, shows the endpoint is up.
+func (b *breaker) record(resp *http.Response, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+
+	switch {
+	case err != nil && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)):
+		// Canceled by the caller, says nothing about the endpoint
+		return
+	case err != nil:
+		b.lastError = err.Error()
+	case resp.StatusCode == http.StatusServiceUnavailable && resp.Header.Get("Retry-After") != "":
+		// Throttling, handled by the rate limiter
+		b.failures = 0
+		return
+	case resp.StatusCode >= http.StatusInternalServerError:
+		b.lastError = resp.Status
+	default:
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.threshold > 0 && b.failures >= b.threshold {
+		// Opening, or a failed probe: start a new cool-down
+		b.openedAt = time.Now()
+	}
+}
+
+// snapshot returns the current state of the breaker
+func (b *breaker) snapshot() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := BreakerState{State: b.state(), Failures: b.failures, LastError: b.lastError}
+	if s.State != BreakerClosed {
+		openedAt, retryAt := b.openedAt, b.openedAt.Add(b.cooldown)
+		s.OpenedAt, s.RetryAt = &openedAt, &retryAt
+	}
+	return s
+}
+
+// SetBreaker configures the circuit breaker of the client: after threshold
+// consecutive failures requests fail fast with CircuitOpenError for cooldown.
+// A threshold of 0 disables the breaker. The setting applies to all copies
+// of the client.
+func (c *Client) SetBreaker(threshold int, cooldown time.Duration) {
+	c.breaker.mu.Lock()
+	defer c.breaker.mu.Unlock()
+	c.breaker.threshold = threshold
+	c.breaker.cooldown = cooldown
+}
+
+// Breaker returns the current state of the client's circuit breaker
+func (c *Client) Breaker() BreakerState {
+	return c.breaker.snapshot()
+}
+
+// do sends a prepared request through the circuit breaker
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	if err := c.breaker.allow(); err != nil {
+		return nil, err
+	}
+	resp, err := c.HTTPClient.Do(req)
+	c.breaker.record(resp, err)
+	return resp, err
+}
@@ -8,20 +8,29 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
+	"registry-sync/pkg/blobcache"
 	"registry-sync/pkg/ratelimit"
 )
 
 // Client represents a Docker Registry V2 API client
 type Client struct {
-	BaseURL    string
-	HTTPClient *http.Client
-	Username   string
-	Password   string
-	Token      string
-	Limiter    *ratelimit.Limiter
+	BaseURL      string
+	HTTPClient   *http.Client
+	Username     string
+	Password     string
+	Token        string
+	Limiter      *ratelimit.Limiter
+	BlobCache    *blobcache.Cache              // Optional cache that blob downloads by CopyBlob read through
+	Bandwidth    []*ratelimit.BandwidthLimiter // Byte rate limits applied to blob downloads and uploads
+	StallTimeout time.Duration                 // Abort blob transfers during which no data flowed for this long, 0 disables
+
+	tokens  *tokenCache // shared with copies made by WithBandwidth
+	quota   *quotaState // shared with copies made by WithBandwidth
+	breaker *breaker    // shared with copies made by WithBandwidth
 }
 
 // NewClient creates a new registry client
@@ -36,11 +45,15 @@ func NewClient(baseURL, username, password string, insecure bool, qps int) *Clie
 		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
 	}
 
+	baseURL = strings.TrimRight(baseURL, "/")
 	return &Client{
-		BaseURL:    strings.TrimRight(baseURL, "/"),
-		Username:   username,
-		Password:   password,
-		Limiter:    ratelimit.NewLimiter(qps),
+		BaseURL:  baseURL,
+		Username: username,
+		Password: password,
+		Limiter:  ratelimit.NewLimiter(qps),
+		tokens:   newTokenCache(),
+		quota:    &quotaState{},
+		breaker:  newBreaker(baseURL),
 		HTTPClient: &http.Client{
 			Transport: transport,
 			Timeout:   300 * time.Second, // 增加到5分钟，处理慢速Registry
@@ -48,6 +61,16 @@ func NewClient(baseURL, username, password string, insecure bool, qps int) *Clie
 	}
 }
 
+// WithBandwidth returns a copy of the client whose blob transfers are
+// additionally limited by the given limiters. The copy shares the rate
+// limiter, connections, tokens and circuit breaker of c, so it can be
+// handed to a single execution of a shared client.
+func (c *Client) WithBandwidth(limiters ...*ratelimit.BandwidthLimiter) *Client {
+	clone := *c
+	clone.Bandwidth = append(append([]*ratelimit.BandwidthLimiter{}, c.Bandwidth...), limiters...)
+	return &clone
+}
+
 // PingCheck checks if the registry is accessible
 func (c *Client) PingCheck(ctx context.Context) error {
 	req, err := http.NewRequestWithContext(ctx, "GET", c.BaseURL+"/v2/", nil)
@@ -65,13 +88,104 @@ func (c *Client) PingCheck(ctx context.Context) error {
 		return nil
 	}
 
-	return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	return newError("ping registry", resp)
 }
 
-// doRequest performs an HTTP request with authentication and rate limiting
+// maxThrottleRetries is how often a throttled request without body is replayed
+const maxThrottleRetries = 3
+
+// defaultThrottleWait is the back-off when a throttling response carries no hint
+const defaultThrottleWait = time.Second
+
+// doRequest performs an HTTP request with authentication and rate limiting.
+// Throttling responses (429, 503) pause and slow down the client's limiter.
+// Requests without a body are replayed after the advertised wait; requests
+// with a body cannot be replayed and return the throttling response.
 func (c *Client) doRequest(ctx context.Context, method, path string, body io.Reader, headers map[string]string) (*http.Response, error) {
-	// Apply rate limiting
-	if err := c.Limiter.Wait(ctx); err != nil {
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(ctx, method, path, body, headers)
+		if err != nil {
+			return nil, err
+		}
+
+		if !c.observeRateLimit(resp) || body != nil || attempt >= maxThrottleRetries {
+			return resp, nil
+		}
+		resp.Body.Close()
+	}
+}
+
+// observeRateLimit feeds the rate limiting signals of a response into the
+// limiter and the pull quota, and reports whether the request was throttled
+func (c *Client) observeRateLimit(resp *http.Response) bool {
+	c.quota.record(resp.Header)
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		wait, ok := retryAfter(resp.Header)
+		if !ok {
+			wait = defaultThrottleWait
+		}
+		c.Limiter.Throttle(wait)
+		return true
+	}
+
+	c.Limiter.Success()
+
+	// The server says the current window is used up, wait for the next one
+	if remaining, ok := headerInt(resp.Header, "RateLimit-Remaining"); ok && remaining == 0 {
+		if reset, ok := headerInt(resp.Header, "RateLimit-Reset"); ok && reset > 0 {
+			c.Limiter.Pause(time.Now().Add(time.Duration(reset) * time.Second))
+		}
+	}
+
+	return false
+}
+
+// retryAfter returns the wait advertised by Retry-After (seconds or HTTP date)
+// or RateLimit-Reset (seconds)
+func retryAfter(header http.Header) (time.Duration, bool) {
+	if value := header.Get("Retry-After"); value != "" {
+		if seconds, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second, true
+		}
+		if date, err := http.ParseTime(value); err == nil {
+			return time.Until(date), true
+		}
+	}
+
+	if reset, ok := headerInt(header, "RateLimit-Reset"); ok && reset >= 0 {
+		return time.Duration(reset) * time.Second, true
+	}
+
+	return 0, false
+}
+
+// headerInt parses the leading integer of a header such as "RateLimit-Remaining: 76;w=21600"
+func headerInt(header http.Header, name string) (int, bool) {
+	value := header.Get(name)
+	if value == "" {
+		return 0, false
+	}
+	if i := strings.IndexAny(value, ";,"); i >= 0 {
+		value = value[:i]
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+// send performs a single HTTP request with authentication and rate limiting
+func (c *Client) send(ctx context.Context, method, path string, body io.Reader, headers map[string]string) (*http.Response, error) {
+	// Apply rate limiting, waiting for a token or a throttle pause to end is
+	// not a stalled transfer
+	watch := stallWatchFrom(ctx)
+	watch.pause()
+	err := c.Limiter.Wait(ctx)
+	watch.resume()
+	if err != nil {
 		return nil, err
 	}
 
@@ -86,13 +200,12 @@ func (c *Client) doRequest(ctx context.Context, method, path string, body io.Rea
 		req.Header.Set(k, v)
 	}
 
-	// Add basic auth if available
-	if c.Username != "" && c.Password != "" {
-		req.SetBasicAuth(c.Username, c.Password)
-	}
+	// Use a cached bearer token, fall back to basic auth if available
+	key := tokenKey(path)
+	c.setAuth(req, key)
 
 	// Try with auth
-	resp, err := c.HTTPClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -110,14 +223,15 @@ func (c *Client) doRequest(ctx context.Context, method, path string, body io.Rea
 				req.Header.Set(k, v)
 			}
 			req.SetBasicAuth(c.Username, c.Password)
-			return c.HTTPClient.Do(req)
+			return c.do(req)
 		}
 
 		// Try bearer token auth
-		token, err := c.getBearerToken(ctx, authHeader, path)
+		token, ttl, err := c.getBearerToken(ctx, authHeader, path)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get bearer token: %w", err)
 		}
+		c.tokens.put(key, token, ttl)
 
 		// Retry with token
 		req, _ = http.NewRequestWithContext(ctx, method, fullURL, body)
@@ -125,27 +239,37 @@ func (c *Client) doRequest(ctx context.Context, method, path string, body io.Rea
 			req.Header.Set(k, v)
 		}
 		req.Header.Set("Authorization", "Bearer "+token)
-		return c.HTTPClient.Do(req)
+		return c.do(req)
 	}
 
 	return resp, nil
 }
 
-// getBearerToken obtains a bearer token from the auth server
-func (c *Client) getBearerToken(ctx context.Context, authHeader, requestPath string) (string, error) {
+// setAuth authorizes a request with the cached bearer token of key,
+// falling back to basic auth if credentials are configured
+func (c *Client) setAuth(req *http.Request, key string) {
+	if token, ok := c.tokens.get(key); ok {
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else if c.Username != "" && c.Password != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+}
+
+// getBearerToken obtains a bearer token and its lifetime from the auth server
+func (c *Client) getBearerToken(ctx context.Context, authHeader, requestPath string) (string, time.Duration, error) {
 	// Parse WWW-Authenticate header
 	// Format: Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/nginx:pull"
 	params := parseAuthHeader(authHeader)
 
 	realm := params["realm"]
 	if realm == "" {
-		return "", fmt.Errorf("no realm in WWW-Authenticate header")
+		return "", 0, fmt.Errorf("no realm in WWW-Authenticate header")
 	}
 
 	// Build token request URL
 	tokenURL, err := url.Parse(realm)
 	if err != nil {
-		return "", err
+		return "", 0, err
 	}
 
 	q := tokenURL.Query()
@@ -160,7 +284,7 @@ func (c *Client) getBearerToken(ctx context.Context, authHeader, requestPath str
 	// Request token
 	req, err := http.NewRequestWithContext(ctx, "GET", tokenURL.String(), nil)
 	if err != nil {
-		return "", err
+		return "", 0, err
 	}
 
 	if c.Username != "" && c.Password != "" {
@@ -169,28 +293,29 @@ func (c *Client) getBearerToken(ctx context.Context, authHeader, requestPath str
 
 	resp, err := c.HTTPClient.Do(req)
 	if err != nil {
-		return "", err
+		return "", 0, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("token request failed: %d %s", resp.StatusCode, string(body))
+		return "", 0, newError("get token", resp)
 	}
 
 	var tokenResp struct {
 		Token       string `json:"token"`
 		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
-		return "", err
+		return "", 0, err
 	}
 
+	ttl := time.Duration(tokenResp.ExpiresIn) * time.Second
 	if tokenResp.Token != "" {
-		return tokenResp.Token, nil
+		return tokenResp.Token, ttl, nil
 	}
-	return tokenResp.AccessToken, nil
+	return tokenResp.AccessToken, ttl, nil
 }
 
 // parseAuthHeader parses WWW-Authenticate header
@@ -219,10 +344,10 @@ func parseAuthHeader(header string) map[string]string {
 // GetManifestMediaType returns the appropriate media type for manifest requests
 func GetManifestMediaType() []string {
 	return []string{
-		"application/vnd.docker.distribution.manifest.v2+json",
-		"application/vnd.docker.distribution.manifest.list.v2+json",
-		"application/vnd.oci.image.manifest.v1+json",
-		"application/vnd.oci.image.index.v1+json",
+		MediaTypeDockerManifest,
+		MediaTypeDockerManifestList,
+		MediaTypeOCIManifest,
+		MediaTypeOCIIndex,
 	}
 }
 
@@ -240,9 +365,9 @@ type HarborProject struct {
 
 // HarborRepository represents a Harbor repository
 type HarborRepository struct {
-	Name         string `json:"name"`
-	ProjectID    int    `json:"project_id"`
-	ArtifactCount int   `json:"artifact_count"`
+	Name          string `json:"name"`
+	ProjectID     int    `json:"project_id"`
+	ArtifactCount int    `json:"artifact_count"`
 }
 
 // ListProjects lists all projects from Harbor
@@ -280,14 +405,13 @@ func (c *Client) listHarborProjects(ctx context.Context) ([]string, error) {
 			req.SetBasicAuth(c.Username, c.Password)
 		}
 
-		resp, err := c.HTTPClient.Do(req)
+		resp, err := c.do(req)
 		if err != nil {
 			return nil, err
 		}
 
 		if resp.StatusCode != http.StatusOK {
-			resp.Body.Close()
-			return nil, fmt.Errorf("harbor API returned status %d", resp.StatusCode)
+			return nil, newError("list harbor projects", resp)
 		}
 
 		var harborProjects []HarborProject
@@ -322,7 +446,7 @@ func (c *Client) listProjectsFromCatalog(ctx context.Context) ([]string, error)
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to list catalog: status %d", resp.StatusCode)
+		return nil, newError("list catalog", resp)
 	}
 
 	var catalog struct {
@@ -381,14 +505,13 @@ func (c *Client) listHarborRepositories(ctx context.Context, project string) ([]
 			req.SetBasicAuth(c.Username, c.Password)
 		}
 
-		resp, err := c.HTTPClient.Do(req)
+		resp, err := c.do(req)
 		if err != nil {
 			return nil, err
 		}
 
 		if resp.StatusCode != http.StatusOK {
-			resp.Body.Close()
-			return nil, fmt.Errorf("harbor API returned status %d", resp.StatusCode)
+			return nil, newError("list harbor repositories", resp)
 		}
 
 		var harborRepos []HarborRepository
@@ -429,7 +552,7 @@ func (c *Client) listRepositoriesFromCatalog(ctx context.Context, project string
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to list catalog: status %d", resp.StatusCode)
+		return nil, newError("list catalog", resp)
 	}
 
 	var catalog struct {
@@ -488,7 +611,7 @@ func (c *Client) createHarborProject(ctx context.Context, projectName string, pu
 		req.SetBasicAuth(c.Username, c.Password)
 	}
 
-	resp, err := c.HTTPClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return err
 	}
@@ -503,9 +626,7 @@ func (c *Client) createHarborProject(ctx context.Context, projectName string, pu
 		return nil
 	}
 
-	// Read error response
-	bodyBytes, _ = io.ReadAll(resp.Body)
-	return fmt.Errorf("failed to create project (status %d): %s", resp.StatusCode, string(bodyBytes))
+	return newError("create project", resp)
 }
 
 // ProjectExists checks if a project exists in Harbor
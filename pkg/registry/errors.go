@@ -0,0 +1,232 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+)
+
+// OCI distribution error codes
+const (
+	ErrorCodeBlobUnknown         = "BLOB_UNKNOWN"
+	ErrorCodeBlobUploadInvalid   = "BLOB_UPLOAD_INVALID"
+	ErrorCodeBlobUploadUnknown   = "BLOB_UPLOAD_UNKNOWN"
+	ErrorCodeDigestInvalid       = "DIGEST_INVALID"
+	ErrorCodeManifestBlobUnknown = "MANIFEST_BLOB_UNKNOWN"
+	ErrorCodeManifestInvalid     = "MANIFEST_INVALID"
+	ErrorCodeManifestUnknown     = "MANIFEST_UNKNOWN"
+	ErrorCodeNameInvalid         = "NAME_INVALID"
+	ErrorCodeNameUnknown         = "NAME_UNKNOWN"
+	ErrorCodeSizeInvalid         = "SIZE_INVALID"
+	ErrorCodeUnauthorized        = "UNAUTHORIZED"
+	ErrorCodeDenied              = "DENIED"
+	ErrorCodeUnsupported         = "UNSUPPORTED"
+	ErrorCodeTooManyRequests     = "TOOMANYREQUESTS"
+)
+
+// maxErrorBody limits how much of an error response body is read
+const maxErrorBody = 64 * 1024
+
+// ErrorDetail is one entry of an OCI error response body
+type ErrorDetail struct {
+	Code    string          `json:"code"`
+	Message string          `json:"message"`
+	Detail  json.RawMessage `json:"detail,omitempty"`
+}
+
+// Error is an unexpected response from a registry
+type Error struct {
+	Op         string        // What the client was doing, e.g. "get blob"
+	Method     string        // HTTP method of the request
+	URL        string        // Request URL
+	StatusCode int           // HTTP status of the response
+	Errors     []ErrorDetail // OCI errors from the response body
+	Body       string        // Response body if it was not an OCI error
+}
+
+// newError builds an Error from a response, consuming and closing its body
+func newError(op string, resp *http.Response) *Error {
+	defer resp.Body.Close()
+
+	e := &Error{Op: op, StatusCode: resp.StatusCode}
+	if resp.Request != nil {
+		e.Method = resp.Request.Method
+		e.URL = resp.Request.URL.String()
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	var parsed struct {
+		Errors []ErrorDetail `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &parsed); err == nil && len(parsed.Errors) > 0 {
+		e.Errors = parsed.Errors
+	} else {
+		e.Body = strings.TrimSpace(string(body))
+	}
+	return e
+}
+
+// Error implements error
+func (e *Error) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "failed to %s", e.Op)
+	if e.Method != "" {
+		fmt.Fprintf(&b, " (%s %s)", e.Method, e.URL)
+	}
+	fmt.Fprintf(&b, ": %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	for _, detail := range e.Errors {
+		fmt.Fprintf(&b, ": %s", detail.Code)
+		if detail.Message != "" {
+			fmt.Fprintf(&b, " %s", detail.Message)
+		}
+	}
+	if len(e.Errors) == 0 && e.Body != "" {
+		fmt.Fprintf(&b, ": %s", e.Body)
+	}
+	return b.String()
+}
+
+// HasCode reports whether the response carried the given OCI error code
+func (e *Error) HasCode(code string) bool {
+	for _, detail := range e.Errors {
+		if detail.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Retryable reports whether repeating the request may succeed: the registry
+// is throttling or temporarily failing. Client errors such as unknown blobs,
+// denied access or invalid manifests are permanent.
+func (e *Error) Retryable() bool {
+	switch e.StatusCode {
+	case http.StatusRequestTimeout,
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return e.HasCode(ErrorCodeTooManyRequests)
+}
+
+// DownloadError is a blob copy that failed while reading from the source,
+// as opposed to checking or writing the target
+type DownloadError struct {
+	Err error
+}
+
+// Error implements error
+func (e *DownloadError) Error() string {
+	return "failed to download blob: " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *DownloadError) Unwrap() error {
+	return e.Err
+}
+
+// IsDownloadError reports whether a blob copy failed on the source side
+func IsDownloadError(err error) bool {
+	var downloadErr *DownloadError
+	return errors.As(err, &downloadErr)
+}
+
+// IsStatus reports whether err is a registry Error with the given HTTP status
+func IsStatus(err error, statusCode int) bool {
+	var regErr *Error
+	return errors.As(err, &regErr) && regErr.StatusCode == statusCode
+}
+
+// IsCode reports whether err is a registry Error carrying the given OCI error code
+func IsCode(err error, code string) bool {
+	var regErr *Error
+	return errors.As(err, &regErr) && regErr.HasCode(code)
+}
+
+// IsRetryable reports whether an operation that failed with err may succeed
+// when repeated: retryable registry errors and transient network failures,
+// including stalled blob transfers. Cancellation is never retryable.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, ErrStalled) {
+		return true
+	}
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var regErr *Error
+	if errors.As(err, &regErr) {
+		return regErr.Retryable()
+	}
+
+	// Connection dropped while reading a body
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	if errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ETIMEDOUT) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.Temporary()
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return netErr.Timeout()
+	}
+
+	return false
+}
+
+// ErrorCode classifies err with a short code suitable for storing and
+// filtering: the first OCI error code of a registry response, HTTP_<status>
+// if the response had none, or a generic code for failures without a response
+func ErrorCode(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	var regErr *Error
+	if errors.As(err, &regErr) {
+		if len(regErr.Errors) > 0 && regErr.Errors[0].Code != "" {
+			return regErr.Errors[0].Code
+		}
+		return fmt.Sprintf("HTTP_%d", regErr.StatusCode)
+	}
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "CANCELED"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "TIMEOUT"
+	case errors.Is(err, ErrStalled):
+		return "STALLED"
+	case IsCircuitOpen(err):
+		return "CIRCUIT_OPEN"
+	case IsDownloadError(err):
+		return "DOWNLOAD_FAILED"
+	case IsRetryable(err):
+		return "NETWORK"
+	}
+	return "UNKNOWN"
+}
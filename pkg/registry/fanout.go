@@ -0,0 +1,160 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// BlobTarget is a destination of CopyBlobToTargets
+type BlobTarget struct {
+	Client     *Client
+	Repository string
+}
+
+// errUploadEnded is reported to the tee when an upload stopped reading
+var errUploadEnded = errors.New("upload ended")
+
+// CopyBlobToTargets copies a blob to several targets, downloading it from the
+// source at most once. The download is streamed to all targets that need the
+// blob concurrently. A failing target is dropped from the stream without
+// affecting the others; results and errors are returned per target.
+func CopyBlobToTargets(ctx context.Context, source *Client, sourceRepo, digest string, size int64, targets []BlobTarget) ([]CopyResult, []error) {
+	results := make([]CopyResult, len(targets))
+	errs := make([]error, len(targets))
+
+	// Check existence and try mounts on every target first
+	var pending []int
+	for i, target := range targets {
+		exists, _, err := target.Client.BlobExists(ctx, target.Repository, digest)
+		if err != nil {
+			errs[i] = fmt.Errorf("failed to check blob existence: %w", err)
+			continue
+		}
+		if exists {
+			results[i].Existed = true
+			continue
+		}
+
+		mounted, err := target.Client.MountBlob(ctx, target.Repository, target.Repository, digest)
+		if err == nil && mounted {
+			results[i].Mounted = true
+			continue
+		}
+
+		pending = append(pending, i)
+	}
+
+	if len(pending) == 0 {
+		return results, errs
+	}
+
+	// Download from source once
+	var reader io.ReadCloser
+	var err error
+	var hit bool
+	if source.BlobCache != nil {
+		reader, _, hit, err = source.BlobCache.Open(ctx, digest, func() (io.ReadCloser, int64, error) {
+			return source.GetBlob(ctx, sourceRepo, digest)
+		})
+	} else {
+		reader, _, err = source.GetBlob(ctx, sourceRepo, digest)
+	}
+	if err != nil {
+		for _, i := range pending {
+			errs[i] = &DownloadError{Err: err}
+		}
+		return results, errs
+	}
+	defer reader.Close()
+
+	// One pipe per target, each consumed by its own upload
+	writers := make(map[int]*io.PipeWriter, len(pending))
+	var wg sync.WaitGroup
+	for _, i := range pending {
+		results[i].CacheHit = source.BlobCache != nil && hit
+		results[i].Cached = source.BlobCache != nil && !hit
+
+		pr, pw := io.Pipe()
+		writers[i] = pw
+
+		wg.Add(1)
+		go func(i int, pr *io.PipeReader) {
+			defer wg.Done()
+			target := targets[i]
+			if err := target.Client.PutBlob(ctx, target.Repository, digest, pr, size); err != nil {
+				errs[i] = fmt.Errorf("failed to upload blob: %w", err)
+				pr.CloseWithError(err)
+				return
+			}
+			pr.CloseWithError(errUploadEnded)
+		}(i, pr)
+	}
+
+	readErr := tee(reader, writers)
+
+	for _, pw := range writers {
+		if readErr != nil {
+			pw.CloseWithError(readErr)
+		} else {
+			pw.Close()
+		}
+	}
+	wg.Wait()
+
+	// The uploads still in the stream failed because the download did,
+	// whatever error they report; dropped targets keep their upload error
+	if readErr != nil {
+		for i := range writers {
+			errs[i] = &DownloadError{Err: readErr}
+		}
+		for _, i := range pending {
+			if errs[i] == nil {
+				errs[i] = &DownloadError{Err: readErr}
+			}
+		}
+	}
+
+	return results, errs
+}
+
+// tee copies src to every writer, writing each chunk to all writers in parallel.
+// Writers that fail are removed from the map; the copy continues for the rest.
+func tee(src io.Reader, writers map[int]*io.PipeWriter) error {
+	buf := make([]byte, 256*1024)
+	for len(writers) > 0 {
+		n, err := src.Read(buf)
+		if n > 0 {
+			chunk := buf[:n]
+
+			var mu sync.Mutex
+			var wg sync.WaitGroup
+			var failed []int
+			for i, w := range writers {
+				wg.Add(1)
+				go func(i int, w *io.PipeWriter) {
+					defer wg.Done()
+					if _, err := w.Write(chunk); err != nil {
+						mu.Lock()
+						failed = append(failed, i)
+						mu.Unlock()
+					}
+				}(i, w)
+			}
+			wg.Wait()
+
+			for _, i := range failed {
+				delete(writers, i)
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -2,6 +2,8 @@ package registry
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -9,23 +11,32 @@ import (
 	"strings"
 )
 
+// Manifest media types
+const (
+	MediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	MediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	MediaTypeOCIManifest        = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeOCIIndex           = "application/vnd.oci.image.index.v1+json"
+)
+
 // Manifest represents a Docker manifest
 type Manifest struct {
-	SchemaVersion int               `json:"schemaVersion"`
-	MediaType     string            `json:"mediaType"`
-	Config        Descriptor        `json:"config"`
-	Layers        []Descriptor      `json:"layers"`
-	Manifests     []ManifestEntry   `json:"manifests,omitempty"` // For manifest lists
-	Raw           []byte            `json:"-"`
-	ContentDigest string            `json:"-"`
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType"`
+	Config        Descriptor      `json:"config"`
+	Layers        []Descriptor    `json:"layers"`
+	Manifests     []ManifestEntry `json:"manifests,omitempty"` // For manifest lists
+	Raw           []byte          `json:"-"`
+	ContentDigest string          `json:"-"`
 }
 
 // Descriptor represents a content descriptor
 type Descriptor struct {
-	MediaType string `json:"mediaType"`
-	Size      int64  `json:"size"`
-	Digest    string `json:"digest"`
-	Platform  *Platform `json:"platform,omitempty"`
+	MediaType   string            `json:"mediaType"`
+	Size        int64             `json:"size"`
+	Digest      string            `json:"digest"`
+	Platform    *Platform         `json:"platform,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
 }
 
 // Platform represents a platform specification
@@ -39,10 +50,10 @@ type Platform struct {
 
 // ManifestEntry represents an entry in a manifest list
 type ManifestEntry struct {
-	MediaType string    `json:"mediaType"`
-	Size      int64     `json:"size"`
-	Digest    string    `json:"digest"`
-	Platform  Platform  `json:"platform"`
+	MediaType string   `json:"mediaType"`
+	Size      int64    `json:"size"`
+	Digest    string   `json:"digest"`
+	Platform  Platform `json:"platform"`
 }
 
 // GetManifest retrieves a manifest from the registry
@@ -60,8 +71,7 @@ func (c *Client) GetManifest(ctx context.Context, repository, reference string)
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("failed to get manifest: %d %s", resp.StatusCode, string(body))
+		return nil, newError("get manifest", resp)
 	}
 
 	data, err := io.ReadAll(resp.Body)
@@ -85,7 +95,7 @@ func (c *Client) PutManifest(ctx context.Context, repository, reference string,
 	path := fmt.Sprintf("/v2/%s/manifests/%s", repository, reference)
 
 	headers := map[string]string{
-		"Content-Type": manifest.MediaType,
+		"Content-Type": manifest.ContentType(),
 	}
 
 	resp, err := c.doRequest(ctx, "PUT", path, strings.NewReader(string(manifest.Raw)), headers)
@@ -95,8 +105,7 @@ func (c *Client) PutManifest(ctx context.Context, repository, reference string,
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("failed to put manifest: %d %s", resp.StatusCode, string(body))
+		return "", newError("put manifest", resp)
 	}
 
 	digest := resp.Header.Get("Docker-Content-Digest")
@@ -130,15 +139,36 @@ func (c *Client) HeadManifest(ctx context.Context, repository, reference string)
 		return false, "", nil
 	}
 
-	return false, "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	return false, "", newError("check manifest", resp)
 }
 
 // IsManifestList checks if a manifest is a manifest list
 func (m *Manifest) IsManifestList() bool {
+	if m.MediaType == "" {
+		// OCI manifests may omit mediaType; an index is recognized by its entries
+		return len(m.Manifests) > 0
+	}
 	return strings.Contains(m.MediaType, "manifest.list") ||
 		strings.Contains(m.MediaType, "image.index")
 }
 
+// Digest returns the sha256 digest of the raw manifest bytes
+func (m *Manifest) Digest() string {
+	sum := sha256.Sum256(m.Raw)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// ContentType returns the media type to use when storing the manifest
+func (m *Manifest) ContentType() string {
+	if m.MediaType != "" {
+		return m.MediaType
+	}
+	if len(m.Manifests) > 0 {
+		return MediaTypeOCIIndex
+	}
+	return MediaTypeOCIManifest
+}
+
 // GetAllBlobs returns all blobs referenced in the manifest
 func (m *Manifest) GetAllBlobs() []Descriptor {
 	var blobs []Descriptor
@@ -186,8 +216,7 @@ func (c *Client) ListTags(ctx context.Context, repository string) ([]string, err
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("failed to list tags: %d %s", resp.StatusCode, string(body))
+		return nil, newError("list tags", resp)
 	}
 
 	var result struct {
@@ -0,0 +1,99 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// quotaProbePath is Docker's documented image for checking the pull quota;
+// HEAD requests for it report the quota without counting as a pull
+const quotaProbePath = "/v2/ratelimitpreview/test/manifests/latest"
+
+// PullQuota is the pull quota a registry reports on manifest responses
+// (Docker Hub's ratelimit-limit and ratelimit-remaining headers)
+type PullQuota struct {
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	Window    int       `json:"window"`           // Length of the quota window in seconds, 0 = unknown
+	Source    string    `json:"source,omitempty"` // What the quota is counted against, e.g. the client IP
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// WindowDuration returns the quota window, or fallback if the registry did not report one
+func (q PullQuota) WindowDuration(fallback time.Duration) time.Duration {
+	if q.Window <= 0 {
+		return fallback
+	}
+	return time.Duration(q.Window) * time.Second
+}
+
+// quotaState holds the last quota reported to a client. It is shared by all
+// copies of the client, so every execution sees the same quota.
+type quotaState struct {
+	mu    sync.Mutex
+	quota PullQuota
+	known bool
+}
+
+// record updates the quota from response headers, if present
+func (s *quotaState) record(header http.Header) {
+	limit, ok := headerInt(header, "RateLimit-Limit")
+	if !ok {
+		return
+	}
+	remaining, ok := headerInt(header, "RateLimit-Remaining")
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.quota = PullQuota{
+		Limit:     limit,
+		Remaining: remaining,
+		Window:    headerWindow(header.Get("RateLimit-Limit")),
+		Source:    header.Get("Docker-RateLimit-Source"),
+		UpdatedAt: time.Now(),
+	}
+	s.known = true
+}
+
+// headerWindow parses the window parameter of a header such as "100;w=21600"
+func headerWindow(value string) int {
+	for _, param := range strings.Split(value, ";")[1:] {
+		if w, ok := strings.CutPrefix(strings.TrimSpace(param), "w="); ok {
+			if n, err := strconv.Atoi(w); err == nil {
+				return n
+			}
+		}
+	}
+	return 0
+}
+
+// PullQuota returns the pull quota last reported by the registry.
+// The second result is false if the registry has not reported a quota.
+func (c *Client) PullQuota() (PullQuota, bool) {
+	c.quota.mu.Lock()
+	defer c.quota.mu.Unlock()
+	return c.quota.quota, c.quota.known
+}
+
+// CheckPullQuota asks the registry for the current pull quota without using
+// up a pull. Registries without a pull quota report false.
+func (c *Client) CheckPullQuota(ctx context.Context) (PullQuota, bool, error) {
+	resp, err := c.doRequest(ctx, "HEAD", quotaProbePath, nil, map[string]string{
+		"Accept": buildAcceptHeader(),
+	})
+	if err != nil {
+		return PullQuota{}, false, fmt.Errorf("failed to check pull quota: %w", err)
+	}
+	resp.Body.Close()
+
+	quota, known := c.PullQuota()
+	return quota, known, nil
+}
@@ -0,0 +1,145 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// ErrStalled is returned for blob transfers during which no data flowed for
+// the client's stall timeout
+var ErrStalled = errors.New("blob transfer stalled")
+
+// stallWatch cancels a blob transfer when the network did not move data for
+// a timeout. Only time spent waiting on the network counts: the watch is
+// paused while the transfer waits on bandwidth limits or the other end of a
+// copy. A nil stallWatch watches nothing.
+type stallWatch struct {
+	ctx     context.Context
+	cancel  context.CancelCauseFunc
+	timeout time.Duration
+
+	mu    sync.Mutex
+	timer *time.Timer
+}
+
+// stallWatchKey is the context key of the stallWatch of a transfer
+type stallWatchKey struct{}
+
+// watchStall returns a context for a transfer that is canceled with
+// ErrStalled once the watch ran for timeout without being reset. The watch
+// starts running, requests sent with the context pause it while they wait on
+// the rate limiter. A timeout of 0 disables the watch.
+func watchStall(ctx context.Context, timeout time.Duration) (context.Context, *stallWatch) {
+	if timeout <= 0 {
+		return ctx, nil
+	}
+
+	w := &stallWatch{timeout: timeout}
+	w.ctx, w.cancel = context.WithCancelCause(ctx)
+	w.timer = time.AfterFunc(timeout, func() { w.cancel(ErrStalled) })
+	return context.WithValue(w.ctx, stallWatchKey{}, w), w
+}
+
+// stallWatchFrom returns the stallWatch of the transfer ctx belongs to, or
+// nil if it is not watched
+func stallWatchFrom(ctx context.Context) *stallWatch {
+	w, _ := ctx.Value(stallWatchKey{}).(*stallWatch)
+	return w
+}
+
+// resume restarts the watch with the full timeout
+func (w *stallWatch) resume() {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.timer.Reset(w.timeout)
+}
+
+// pause stops the watch until the next resume
+func (w *stallWatch) pause() {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.timer.Stop()
+}
+
+// stop ends the watch and releases its context
+func (w *stallWatch) stop() {
+	if w == nil {
+		return
+	}
+	w.pause()
+	w.cancel(nil)
+}
+
+// err replaces the error of a transfer that the watch canceled with
+// ErrStalled, so it is retried like other network failures
+func (w *stallWatch) err(err error) error {
+	if w == nil || err == nil || !errors.Is(context.Cause(w.ctx), ErrStalled) {
+		return err
+	}
+	return fmt.Errorf("%w: no data for %v", ErrStalled, w.timeout)
+}
+
+// downloadReader returns a reader of a response body that runs the watch
+// only while reading from it. Closing the reader ends the watch.
+func (w *stallWatch) downloadReader(body io.ReadCloser) io.ReadCloser {
+	w.pause()
+	return &downloadReader{body: body, watch: w}
+}
+
+// uploadReader returns a reader of a request body that runs the watch only
+// between reads, while the transport writes the data read to the network.
+// It is not a Closer: the transport closes request bodies before the
+// response arrives, which the watch still covers.
+func (w *stallWatch) uploadReader(content io.Reader) io.Reader {
+	return &uploadReader{content: content, watch: w}
+}
+
+// downloadReader runs a stallWatch while a download waits on the network
+type downloadReader struct {
+	body  io.ReadCloser
+	watch *stallWatch
+}
+
+// Read implements io.Reader
+func (r *downloadReader) Read(p []byte) (int, error) {
+	r.watch.resume()
+	defer r.watch.pause()
+
+	n, err := r.body.Read(p)
+	if err != nil && err != io.EOF {
+		err = r.watch.err(err)
+	}
+	return n, err
+}
+
+// Close implements io.Closer
+func (r *downloadReader) Close() error {
+	r.watch.stop()
+	return r.body.Close()
+}
+
+// uploadReader runs a stallWatch while an upload waits on the network
+type uploadReader struct {
+	content io.Reader
+	watch   *stallWatch
+}
+
+// Read implements io.Reader
+func (r *uploadReader) Read(p []byte) (int, error) {
+	r.watch.pause()
+	defer r.watch.resume()
+
+	return r.content.Read(p)
+}
@@ -0,0 +1,76 @@
+package registry
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultTokenTTL is assumed when the auth server does not report expires_in
+	defaultTokenTTL = 60 * time.Second
+	// tokenExpiryMargin renews tokens shortly before they expire
+	tokenExpiryMargin = 10 * time.Second
+)
+
+// tokenCache keeps bearer tokens per repository so that requests can be
+// authorized up front instead of being challenged every time. It is shared
+// by all copies of a client.
+type tokenCache struct {
+	mu     sync.Mutex
+	tokens map[string]cachedToken
+}
+
+type cachedToken struct {
+	token   string
+	expires time.Time
+}
+
+func newTokenCache() *tokenCache {
+	return &tokenCache{tokens: make(map[string]cachedToken)}
+}
+
+// get returns the cached token for a key if it has not expired
+func (t *tokenCache) get(key string) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	cached, ok := t.tokens[key]
+	if !ok {
+		return "", false
+	}
+	if time.Now().After(cached.expires) {
+		delete(t.tokens, key)
+		return "", false
+	}
+	return cached.token, true
+}
+
+// put caches a token for its lifetime minus a safety margin
+func (t *tokenCache) put(key, token string, ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = defaultTokenTTL
+	}
+	if ttl <= tokenExpiryMargin {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tokens[key] = cachedToken{token: token, expires: time.Now().Add(ttl - tokenExpiryMargin)}
+}
+
+// tokenKey returns the cache key of a request path: the repository name for
+// repository endpoints (tokens are scoped per repository), the path otherwise.
+// A push token replaces a pull token of the same repository, as it covers both.
+func tokenKey(path string) string {
+	path, _, _ = strings.Cut(path, "?")
+	if name, ok := strings.CutPrefix(path, "/v2/"); ok {
+		for _, endpoint := range []string{"/manifests/", "/blobs/", "/tags/"} {
+			if i := strings.LastIndex(name, endpoint); i > 0 {
+				return name[:i]
+			}
+		}
+	}
+	return path
+}
@@ -2,20 +2,29 @@ package sync
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"registry-sync/pkg/config"
 	"registry-sync/pkg/filter"
+	"registry-sync/pkg/ocilayout"
+	"registry-sync/pkg/ratelimit"
 	"registry-sync/pkg/registry"
 )
 
 // Engine is the main synchronization engine
 type Engine struct {
 	config       *config.Config
-	retryConfig  RetryConfig
+	retry        RetryPolicies // retry policies of the rule being synced, with its retry budget
 	dryRun       bool
 	progressFunc ProgressFunc
+	layouts      map[string]*ocilayout.Writer // bundle path -> writer, shared by rules exporting to the same path
+	imported     ocilayout.KnownBlobs         // blobs present in import targets, see KnownBlobs
+	source       *registry.Client             // clients of the rule being synced, for rate reporting
+	target       *registry.Client
+	clients      map[string]*registry.Client // registry name -> client, shared by all rules
+	global       *ratelimit.BandwidthLimiter // applies to every blob transfer
 }
 
 // ProgressFunc is called to report progress
@@ -23,30 +32,66 @@ type ProgressFunc func(info ProgressInfo)
 
 // ProgressInfo contains synchronization progress information
 type ProgressInfo struct {
-	TaskName      string
-	Repository    string
-	Tag           string
-	Phase         string // "manifest", "blob", "complete"
-	TotalBlobs    int
-	SyncedBlobs   int
-	TotalSize     int64
-	SyncedSize    int64
-	CurrentBlob   string
-	CurrentSize   int64
-	Error         error
+	TaskName    string
+	Repository  string
+	Tag         string
+	Phase       string // "manifest", "blob", "complete"
+	TotalBlobs  int
+	SyncedBlobs int
+	TotalSize   int64
+	SyncedSize  int64
+	CurrentBlob string
+	CurrentSize int64
+	SourceQPS   float64 // Effective request rate of the source client, 0 = unlimited
+	TargetQPS   float64 // Effective request rate of the target client, lowered while throttled
+	Error       error
 }
 
 // NewEngine creates a new synchronization engine
 func NewEngine(cfg *config.Config, dryRun bool) *Engine {
+	// Bandwidth schedules have been checked by config.Validate
+	global, _ := ratelimit.ParseBandwidthSchedule(cfg.Global.Bandwidth)
+
 	return &Engine{
-		config:  cfg,
-		dryRun:  dryRun,
-		retryConfig: RetryConfig{
-			MaxAttempts:     cfg.Global.Retry.MaxAttempts,
-			InitialInterval: cfg.Global.Retry.InitialInterval,
-			MaxInterval:     cfg.Global.Retry.MaxInterval,
-		},
+		config:   cfg,
+		dryRun:   dryRun,
+		layouts:  make(map[string]*ocilayout.Writer),
+		imported: make(ocilayout.KnownBlobs),
+		clients:  make(map[string]*registry.Client),
+		global:   ratelimit.NewBandwidthLimiter(global),
+		retry:    NewRetryPolicies(cfg.Global.Retry, nil),
+	}
+}
+
+// newClient returns a client for a configured registry. Rules using the same
+// registry share its rate limiter, connections and tokens. Blob transfers are
+// limited by the global and registry bandwidth limits and by the given
+// per-rule limiters.
+func (e *Engine) newClient(name string, reg config.Registry, limiters ...*ratelimit.BandwidthLimiter) *registry.Client {
+	client, ok := e.clients[name]
+	if !ok {
+		client = registry.NewClient(
+			config.NormalizeRegistryURL(reg.URL),
+			reg.Username,
+			reg.Password,
+			reg.Insecure,
+			reg.RateLimit.QPS,
+		)
+		schedule, _ := ratelimit.ParseBandwidthSchedule(reg.Bandwidth)
+		client.Bandwidth = []*ratelimit.BandwidthLimiter{e.global, ratelimit.NewBandwidthLimiter(schedule)}
+		client.StallTimeout = e.config.Global.StallTimeout
+		e.clients[name] = client
+	}
+	return client.WithBandwidth(limiters...)
+}
+
+// ruleBandwidth returns the bandwidth limiter of a rule, nil if it has none
+func ruleBandwidth(rule config.SyncRule) *ratelimit.BandwidthLimiter {
+	schedule, _ := ratelimit.ParseBandwidthSchedule(rule.Bandwidth)
+	if schedule == nil {
+		return nil
 	}
+	return ratelimit.NewBandwidthLimiter(schedule)
 }
 
 // SetProgressFunc sets the progress callback function
@@ -57,6 +102,12 @@ func (e *Engine) SetProgressFunc(fn ProgressFunc) {
 // reportProgress reports progress if callback is set
 func (e *Engine) reportProgress(info ProgressInfo) {
 	if e.progressFunc != nil {
+		if e.source != nil {
+			info.SourceQPS = e.source.Limiter.Rate()
+		}
+		if e.target != nil {
+			info.TargetQPS = e.target.Limiter.Rate()
+		}
 		e.progressFunc(info)
 	}
 }
@@ -75,57 +126,116 @@ func (e *Engine) SyncAll(ctx context.Context) error {
 
 		if err := e.SyncRule(ctx, rule); err != nil {
 			fmt.Printf("❌ Failed to sync %s: %v\n", rule.Name, err)
+			e.closeLayouts()
 			return err
 		}
 
 		fmt.Printf("✅ Successfully synced %s\n", rule.Name)
 	}
 
-	return nil
+	return e.closeLayouts()
+}
+
+// layoutWriter returns the bundle writer for a path, opening it on first use
+func (e *Engine) layoutWriter(path string) (*ocilayout.Writer, error) {
+	if w, ok := e.layouts[path]; ok {
+		return w, nil
+	}
+
+	w, err := ocilayout.NewWriter(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bundle %s: %w", path, err)
+	}
+	e.layouts[path] = w
+	return w, nil
+}
+
+// closeLayouts finalizes all open bundles
+func (e *Engine) closeLayouts() error {
+	var firstErr error
+	for path, w := range e.layouts {
+		if err := w.Close(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to finalize bundle %s: %w", path, err)
+		} else if err == nil {
+			fmt.Printf("📦 Bundle written: %s\n", path)
+		}
+		delete(e.layouts, path)
+	}
+	return firstErr
 }
 
-// SyncRule synchronizes a single sync rule
+// errRuleTimedOut stops sync rules that ran longer than their timeout
+var errRuleTimedOut = errors.New("sync rule timed out")
+
+// SyncRule synchronizes a single sync rule, stopping it after the rule's or
+// the global timeout
 func (e *Engine) SyncRule(ctx context.Context, rule config.SyncRule) error {
+	timeout := rule.Timeout
+	if timeout == 0 {
+		timeout = e.config.Global.Timeout
+	}
+	if timeout <= 0 {
+		return e.syncRule(ctx, rule)
+	}
+
+	ctx, cancel := context.WithTimeoutCause(ctx, timeout, errRuleTimedOut)
+	defer cancel()
+
+	err := e.syncRule(ctx, rule)
+	if err != nil && errors.Is(context.Cause(ctx), errRuleTimedOut) {
+		return fmt.Errorf("%w after %v: %v", errRuleTimedOut, timeout, err)
+	}
+	return err
+}
+
+// syncRule synchronizes a single sync rule
+func (e *Engine) syncRule(ctx context.Context, rule config.SyncRule) error {
+	// Every rule gets a fresh retry budget
+	e.retry = NewRetryPolicies(e.config.Global.Retry, nil)
+
+	if rule.Source.IsOCILayout() {
+		return e.importRule(ctx, rule)
+	}
+
 	// Get source and target registries
 	sourceReg, err := e.config.GetRegistry(rule.Source.Registry)
 	if err != nil {
 		return err
 	}
 
-	targetReg, err := e.config.GetRegistry(rule.Target.Registry)
-	if err != nil {
-		return err
+	// Create registry clients
+	sourceClient := e.newClient(rule.Source.Registry, sourceReg, ruleBandwidth(rule))
+
+	var targetClient *registry.Client
+	if !rule.Target.IsOCILayout() {
+		targetReg, err := e.config.GetRegistry(rule.Target.Registry)
+		if err != nil {
+			return err
+		}
+
+		targetClient = e.newClient(rule.Target.Registry, targetReg)
 	}
 
-	// Create registry clients
-	sourceClient := registry.NewClient(
-		config.NormalizeRegistryURL(sourceReg.URL),
-		sourceReg.Username,
-		sourceReg.Password,
-		sourceReg.Insecure,
-		sourceReg.RateLimit.QPS,
-	)
-
-	targetClient := registry.NewClient(
-		config.NormalizeRegistryURL(targetReg.URL),
-		targetReg.Username,
-		targetReg.Password,
-		targetReg.Insecure,
-		targetReg.RateLimit.QPS,
-	)
+	e.source, e.target = sourceClient, targetClient
 
 	// Test connectivity
 	if err := sourceClient.PingCheck(ctx); err != nil {
 		return fmt.Errorf("failed to connect to source registry: %w", err)
 	}
 
-	if err := targetClient.PingCheck(ctx); err != nil {
-		return fmt.Errorf("failed to connect to target registry: %w", err)
+	if targetClient != nil {
+		if err := targetClient.PingCheck(ctx); err != nil {
+			return fmt.Errorf("failed to connect to target registry: %w", err)
+		}
 	}
 
 	// List tags from source
 	fmt.Println("Fetching tags from source...")
-	tags, err := sourceClient.ListTags(ctx, rule.Source.Repository)
+	var tags []string
+	err = e.retry.Retry(ctx, OpCatalog, func() (err error) {
+		tags, err = sourceClient.ListTags(ctx, rule.Source.Repository)
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("failed to list tags: %w", err)
 	}
@@ -163,6 +273,10 @@ func (e *Engine) SyncRule(ctx context.Context, rule config.SyncRule) error {
 		return nil
 	}
 
+	if rule.Target.IsOCILayout() {
+		return e.exportTags(ctx, sourceClient, rule, filteredTags)
+	}
+
 	// Sync each tag
 	for i, tag := range filteredTags {
 		fmt.Printf("\n[%d/%d] Syncing tag: %s\n", i+1, len(filteredTags), tag)
@@ -185,7 +299,7 @@ func (e *Engine) SyncTag(ctx context.Context, source, target *registry.Client, r
 	})
 
 	// Get manifest from source
-	manifest, err := source.GetManifest(ctx, rule.Source.Repository, tag)
+	manifest, err := e.getManifest(ctx, source, rule.Source.Repository, tag)
 	if err != nil {
 		return fmt.Errorf("failed to get manifest: %w", err)
 	}
@@ -199,6 +313,24 @@ func (e *Engine) SyncTag(ctx context.Context, source, target *registry.Client, r
 	return e.SyncSingleManifest(ctx, source, target, rule, tag, manifest)
 }
 
+// getManifest fetches a manifest with the manifest retry policy
+func (e *Engine) getManifest(ctx context.Context, client *registry.Client, repository, reference string) (*registry.Manifest, error) {
+	var manifest *registry.Manifest
+	err := e.retry.Retry(ctx, OpManifest, func() (err error) {
+		manifest, err = client.GetManifest(ctx, repository, reference)
+		return err
+	})
+	return manifest, err
+}
+
+// putManifest uploads a manifest with the manifest retry policy
+func (e *Engine) putManifest(ctx context.Context, client *registry.Client, repository, reference string, manifest *registry.Manifest) error {
+	return e.retry.Retry(ctx, OpManifest, func() error {
+		_, err := client.PutManifest(ctx, repository, reference, manifest)
+		return err
+	})
+}
+
 // SyncManifestList synchronizes a manifest list (multi-arch)
 func (e *Engine) SyncManifestList(ctx context.Context, source, target *registry.Client, rule config.SyncRule, tag string, manifestList *registry.Manifest) error {
 	fmt.Println("  Detected manifest list (multi-arch)")
@@ -212,7 +344,7 @@ func (e *Engine) SyncManifestList(ctx context.Context, source, target *registry.
 		fmt.Printf("  Syncing architecture: %s/%s\n", entry.Platform.OS, entry.Platform.Architecture)
 
 		// Get the actual manifest for this architecture
-		archManifest, err := source.GetManifest(ctx, rule.Source.Repository, entry.Digest)
+		archManifest, err := e.getManifest(ctx, source, rule.Source.Repository, entry.Digest)
 		if err != nil {
 			return fmt.Errorf("failed to get manifest for %s: %w", entry.Digest, err)
 		}
@@ -225,7 +357,7 @@ func (e *Engine) SyncManifestList(ctx context.Context, source, target *registry.
 
 	// Upload the manifest list to target
 	fmt.Println("  Uploading manifest list...")
-	if _, err := target.PutManifest(ctx, rule.Target.Repository, tag, manifestList); err != nil {
+	if err := e.putManifest(ctx, target, rule.Target.Repository, tag, manifestList); err != nil {
 		return fmt.Errorf("failed to upload manifest list: %w", err)
 	}
 
@@ -254,13 +386,13 @@ func (e *Engine) SyncSingleManifest(ctx context.Context, source, target *registr
 	// Submit blob sync tasks
 	for _, blob := range blobs {
 		task := &BlobSyncTask{
-			Source:      source,
-			Target:      target,
-			SourceRepo:  rule.Source.Repository,
-			TargetRepo:  rule.Target.Repository,
-			Digest:      blob.Digest,
-			Size:        blob.Size,
-			RetryConfig: e.retryConfig,
+			Source:     source,
+			Target:     target,
+			SourceRepo: rule.Source.Repository,
+			TargetRepo: rule.Target.Repository,
+			Digest:     blob.Digest,
+			Size:       blob.Size,
+			Retry:      e.retry,
 			OnProgress: func(digest string, size int64) {
 				e.reportProgress(ProgressInfo{
 					TaskName:    rule.Name,
@@ -288,7 +420,7 @@ func (e *Engine) SyncSingleManifest(ctx context.Context, source, target *registr
 
 	// Upload manifest to target
 	fmt.Println("  Uploading manifest...")
-	if _, err := target.PutManifest(ctx, rule.Target.Repository, reference, manifest); err != nil {
+	if err := e.putManifest(ctx, target, rule.Target.Repository, reference, manifest); err != nil {
 		return fmt.Errorf("failed to upload manifest: %w", err)
 	}
 
@@ -304,14 +436,14 @@ func (e *Engine) SyncSingleManifest(ctx context.Context, source, target *registr
 
 // BlobSyncTask represents a blob synchronization task
 type BlobSyncTask struct {
-	Source      *registry.Client
-	Target      *registry.Client
-	SourceRepo  string
-	TargetRepo  string
-	Digest      string
-	Size        int64
-	RetryConfig RetryConfig
-	OnProgress  func(digest string, size int64)
+	Source     *registry.Client
+	Target     *registry.Client
+	SourceRepo string
+	TargetRepo string
+	Digest     string
+	Size       int64
+	Retry      RetryPolicies
+	OnProgress func(digest string, size int64)
 }
 
 // Execute executes the blob sync task
@@ -333,8 +465,9 @@ func (t *BlobSyncTask) Execute(ctx context.Context) error {
 	fmt.Printf("  ⬇️  Syncing blob: %s (%.2f MB)\n", t.Digest[:12], float64(t.Size)/(1024*1024))
 
 	// Copy blob with retry
-	err = RetryWithBackoff(ctx, t.RetryConfig, func() error {
-		return registry.CopyBlob(ctx, t.Source, t.Target, t.SourceRepo, t.TargetRepo, t.Digest, t.Size)
+	err = t.Retry.RetryBlobCopy(ctx, func() error {
+		_, err := registry.CopyBlob(ctx, t.Source, t.Target, t.SourceRepo, t.TargetRepo, t.Digest, t.Size)
+		return err
 	})
 
 	if err != nil {
@@ -0,0 +1,143 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+
+	"registry-sync/pkg/config"
+	"registry-sync/pkg/ocilayout"
+	"registry-sync/pkg/registry"
+)
+
+// exportTags writes the given tags into the rule's OCI layout bundle
+func (e *Engine) exportTags(ctx context.Context, source *registry.Client, rule config.SyncRule, tags []string) error {
+	w, err := e.layoutWriter(rule.Target.Path)
+	if err != nil {
+		return err
+	}
+
+	if rule.Target.KnownBlobs != "" {
+		known, err := ocilayout.LoadKnownBlobs(rule.Target.KnownBlobs)
+		if err != nil {
+			return err
+		}
+		w.AddKnownBlobs(known)
+		fmt.Printf("Loaded %d known blobs, they will not be exported\n", len(known))
+	}
+
+	for i, tag := range tags {
+		fmt.Printf("\n[%d/%d] Exporting tag: %s\n", i+1, len(tags), tag)
+
+		if err := e.ExportTag(ctx, source, w, rule, tag); err != nil {
+			return fmt.Errorf("failed to export tag %s: %w", tag, err)
+		}
+	}
+
+	return nil
+}
+
+// ExportTag writes a single tag into an OCI layout bundle
+func (e *Engine) ExportTag(ctx context.Context, source *registry.Client, w *ocilayout.Writer, rule config.SyncRule, tag string) error {
+	e.reportProgress(ProgressInfo{
+		TaskName:   rule.Name,
+		Repository: rule.Source.Repository,
+		Tag:        tag,
+		Phase:      "manifest",
+	})
+
+	manifest, err := e.getManifest(ctx, source, rule.Source.Repository, tag)
+	if err != nil {
+		return fmt.Errorf("failed to get manifest: %w", err)
+	}
+
+	if manifest.IsManifestList() {
+		fmt.Println("  Detected manifest list (multi-arch)")
+
+		entries := registry.FilterManifestsByArch(manifest.Manifests, rule.Architectures)
+		fmt.Printf("  Architectures to export: %d\n", len(entries))
+
+		for _, entry := range entries {
+			fmt.Printf("  Exporting architecture: %s/%s\n", entry.Platform.OS, entry.Platform.Architecture)
+
+			archManifest, err := e.getManifest(ctx, source, rule.Source.Repository, entry.Digest)
+			if err != nil {
+				return fmt.Errorf("failed to get manifest for %s: %w", entry.Digest, err)
+			}
+
+			if err := e.exportManifest(ctx, source, w, rule, entry.Digest, archManifest); err != nil {
+				return err
+			}
+		}
+	} else if err := e.exportManifest(ctx, source, w, rule, tag, manifest); err != nil {
+		return err
+	}
+
+	desc, err := w.WriteManifest(manifest)
+	if err != nil {
+		return err
+	}
+
+	repository := rule.Target.Repository
+	if repository == "" {
+		repository = rule.Source.Repository
+	}
+	w.AddRef(desc, ocilayout.RefName(repository, tag))
+
+	e.reportProgress(ProgressInfo{
+		TaskName:   rule.Name,
+		Repository: rule.Source.Repository,
+		Tag:        tag,
+		Phase:      "complete",
+	})
+
+	return nil
+}
+
+// exportManifest writes the blobs of a single image manifest, then the manifest itself
+func (e *Engine) exportManifest(ctx context.Context, source *registry.Client, w *ocilayout.Writer, rule config.SyncRule, reference string, manifest *registry.Manifest) error {
+	blobs := manifest.GetAllBlobs()
+	fmt.Printf("  Found %d blobs to export\n", len(blobs))
+
+	for i, blob := range blobs {
+		e.reportProgress(ProgressInfo{
+			TaskName:    rule.Name,
+			Repository:  rule.Source.Repository,
+			Tag:         reference,
+			Phase:       "blob",
+			TotalBlobs:  len(blobs),
+			SyncedBlobs: i,
+			CurrentBlob: blob.Digest,
+			CurrentSize: blob.Size,
+		})
+
+		if w.IsKnown(blob.Digest) {
+			fmt.Printf("  ⏩ Blob known to target, not exported: %s\n", blob.Digest[:12])
+			continue
+		}
+		if w.HasBlob(blob.Digest) {
+			fmt.Printf("  ⏩ Blob already in bundle: %s\n", blob.Digest[:12])
+			continue
+		}
+
+		fmt.Printf("  ⬇️  Exporting blob: %s (%.2f MB)\n", blob.Digest[:12], float64(blob.Size)/(1024*1024))
+
+		err := e.retry.Retry(ctx, OpBlobDownload, func() error {
+			reader, _, err := source.GetBlob(ctx, rule.Source.Repository, blob.Digest)
+			if err != nil {
+				return err
+			}
+			defer reader.Close()
+
+			return w.WriteBlob(blob.Digest, reader)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to export blob %s: %w", blob.Digest[:12], err)
+		}
+	}
+
+	if _, err := w.WriteManifest(manifest); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,211 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"registry-sync/pkg/config"
+	"registry-sync/pkg/filter"
+	"registry-sync/pkg/ocilayout"
+	"registry-sync/pkg/registry"
+)
+
+// importRule pushes the images of an OCI layout or docker save bundle to the rule's target registry
+func (e *Engine) importRule(ctx context.Context, rule config.SyncRule) error {
+	targetReg, err := e.config.GetRegistry(rule.Target.Registry)
+	if err != nil {
+		return err
+	}
+
+	targetClient := e.newClient(rule.Target.Registry, targetReg, ruleBandwidth(rule))
+
+	e.source, e.target = nil, targetClient
+
+	if err := targetClient.PingCheck(ctx); err != nil {
+		return fmt.Errorf("failed to connect to target registry: %w", err)
+	}
+
+	var mapping ocilayout.Mapping
+	if rule.Source.Mapping != "" {
+		if mapping, err = ocilayout.LoadMapping(rule.Source.Mapping); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Opening bundle %s...\n", rule.Source.Path)
+	reader, err := ocilayout.Open(rule.Source.Path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	images, err := selectBundleImages(reader.Images(), rule.Source.Repository, rule.Tags)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Found %d images in bundle, %d to import\n", len(reader.Images()), len(images))
+
+	if len(images) == 0 {
+		fmt.Println("No images to import")
+		return nil
+	}
+
+	if e.dryRun {
+		fmt.Println("\n[DRY RUN] Would import the following images:")
+		for _, img := range images {
+			fmt.Printf("  - %s\n", img.RefName)
+		}
+		return nil
+	}
+
+	for i, img := range images {
+		repository, tag, ok := mapping.Resolve(img)
+		if !ok {
+			repository, tag = rule.Target.Repository, img.Tag
+		}
+
+		fmt.Printf("\n[%d/%d] Importing %s -> %s:%s\n", i+1, len(images), img.RefName, repository, tag)
+		e.reportProgress(ProgressInfo{
+			TaskName:   rule.Name,
+			Repository: repository,
+			Tag:        tag,
+			Phase:      "manifest",
+		})
+
+		err := reader.Push(ctx, targetClient, img, repository, tag, ocilayout.PushOptions{
+			Architectures: rule.Architectures,
+			OnBlob: func(blob registry.Descriptor, existed bool) {
+				e.imported[blob.Digest] = true
+				if existed {
+					fmt.Printf("  ⏩ Blob already exists: %s\n", blob.Digest[:12])
+				} else {
+					fmt.Printf("  ✅ Blob uploaded: %s\n", blob.Digest[:12])
+				}
+				e.reportProgress(ProgressInfo{
+					TaskName:    rule.Name,
+					Repository:  repository,
+					Tag:         tag,
+					Phase:       "blob",
+					CurrentBlob: blob.Digest,
+					CurrentSize: blob.Size,
+				})
+			},
+		})
+		var missing *ocilayout.MissingBlobsError
+		if errors.As(err, &missing) {
+			fmt.Printf("  ❌ %d blobs are neither in the bundle nor in the target:\n", len(missing.Digests))
+			for _, digest := range missing.Digests {
+				fmt.Printf("     - %s\n", digest)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to import %s: %w", img.RefName, err)
+		}
+
+		e.reportProgress(ProgressInfo{
+			TaskName:   rule.Name,
+			Repository: repository,
+			Tag:        tag,
+			Phase:      "complete",
+		})
+	}
+
+	return nil
+}
+
+// KnownBlobs returns the blobs that imports of this engine found in or pushed to
+// their targets. Saved with KnownBlobs.Save it tells the exporting side which
+// blobs the next bundle can leave out.
+func (e *Engine) KnownBlobs() ocilayout.KnownBlobs {
+	return e.imported
+}
+
+// ScanKnownBlobs collects the blobs of every tag in the target repositories of
+// the enabled rules that sync into a registry
+func (e *Engine) ScanKnownBlobs(ctx context.Context) (ocilayout.KnownBlobs, error) {
+	known := make(ocilayout.KnownBlobs)
+
+	for _, rule := range e.config.GetEnabledRules() {
+		if rule.Target.IsOCILayout() || rule.Target.Repository == "" {
+			continue
+		}
+
+		targetReg, err := e.config.GetRegistry(rule.Target.Registry)
+		if err != nil {
+			return nil, err
+		}
+
+		client := e.newClient(rule.Target.Registry, targetReg)
+
+		fmt.Printf("Scanning %s/%s...\n", rule.Target.Registry, rule.Target.Repository)
+		tags, err := client.ListTags(ctx, rule.Target.Repository)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tags of %s: %w", rule.Target.Repository, err)
+		}
+
+		for _, tag := range tags {
+			if err := scanManifest(ctx, client, rule.Target.Repository, tag, known); err != nil {
+				return nil, fmt.Errorf("failed to scan %s:%s: %w", rule.Target.Repository, tag, err)
+			}
+		}
+	}
+
+	return known, nil
+}
+
+// scanManifest adds the blobs of a manifest, and of all platforms of a manifest list, to known
+func scanManifest(ctx context.Context, client *registry.Client, repository, reference string, known ocilayout.KnownBlobs) error {
+	manifest, err := client.GetManifest(ctx, repository, reference)
+	if err != nil {
+		return err
+	}
+
+	if manifest.IsManifestList() {
+		for _, entry := range manifest.Manifests {
+			if err := scanManifest(ctx, client, repository, entry.Digest, known); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, blob := range manifest.GetAllBlobs() {
+		known[blob.Digest] = true
+	}
+	return nil
+}
+
+// selectBundleImages applies the repository and tag filters to the images of a bundle.
+// Images that only record a tag always pass the repository filter.
+func selectBundleImages(images []ocilayout.Image, repository string, tags config.TagFilter) ([]ocilayout.Image, error) {
+	tagFilter, err := filter.NewFilter(tags.Include, tags.Exclude, tags.Latest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tag filter: %w", err)
+	}
+
+	var candidates []ocilayout.Image
+	var tagInfos []filter.TagInfo
+	for _, img := range images {
+		if repository != "" && img.Repository != "" && img.Repository != repository {
+			continue
+		}
+		candidates = append(candidates, img)
+		tagInfos = append(tagInfos, filter.TagInfo{Name: img.Tag, Updated: time.Now()})
+	}
+
+	allowed := make(map[string]bool)
+	for _, tag := range tagFilter.FilterTags(tagInfos) {
+		allowed[tag] = true
+	}
+
+	var selected []ocilayout.Image
+	for _, img := range candidates {
+		if allowed[img.Tag] {
+			selected = append(selected, img)
+		}
+	}
+
+	return selected, nil
+}
@@ -4,11 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"net"
+	"math/rand/v2"
 	"net/http"
-	"strings"
-	"syscall"
+	"sync/atomic"
 	"time"
+
+	"registry-sync/pkg/config"
+	"registry-sync/pkg/registry"
 )
 
 // RetryConfig contains retry configuration
@@ -16,6 +18,8 @@ type RetryConfig struct {
 	MaxAttempts     int
 	InitialInterval time.Duration
 	MaxInterval     time.Duration
+	Budget          *RetryBudget                                     // Optional cap on retries shared with other operations
+	OnRetry         func(attempt int, err error, wait time.Duration) // Optional, called before waiting for a retry
 }
 
 // DefaultRetryConfig returns the default retry configuration
@@ -27,138 +31,190 @@ func DefaultRetryConfig() RetryConfig {
 	}
 }
 
+// Backoff returns the wait before the retry following the given attempt:
+// a random duration up to the exponential backoff ("full jitter"), so that
+// workers failing at the same time do not retry in lockstep
+func (c RetryConfig) Backoff(attempt int) time.Duration {
+	ceiling := c.InitialInterval
+	for i := 1; i < attempt && ceiling < c.MaxInterval; i++ {
+		ceiling *= 2
+	}
+	if c.MaxInterval > 0 && ceiling > c.MaxInterval {
+		ceiling = c.MaxInterval
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int64N(int64(ceiling) + 1))
+}
+
+// ErrRetryBudgetExhausted is returned when an operation could be retried but
+// its execution has used up its retry budget
+var ErrRetryBudgetExhausted = errors.New("retry budget exhausted")
+
+// RetryBudget caps the total number of retries of an execution, so that a
+// failing registry cannot stretch an execution by retrying every operation.
+// A nil budget is unlimited.
+type RetryBudget struct {
+	limit int64
+	used  atomic.Int64
+}
+
+// NewRetryBudget creates a budget of limit retries, nil if limit is not positive
+func NewRetryBudget(limit int) *RetryBudget {
+	if limit <= 0 {
+		return nil
+	}
+	return &RetryBudget{limit: int64(limit)}
+}
+
+// Take uses up one retry and reports whether the budget allowed it
+func (b *RetryBudget) Take() bool {
+	if b == nil {
+		return true
+	}
+	return b.used.Add(1) <= b.limit
+}
+
+// Remaining returns the number of retries left, -1 if unlimited
+func (b *RetryBudget) Remaining() int {
+	if b == nil {
+		return -1
+	}
+	return int(max(b.limit-b.used.Load(), 0))
+}
+
+// Retried operations with their own retry policy
+const (
+	OpManifest     = "manifest"
+	OpBlobDownload = "blob_download"
+	OpBlobUpload   = "blob_upload"
+	OpCatalog      = "catalog"
+)
+
+// RetryPolicies holds the retry configuration of each operation
+type RetryPolicies map[string]RetryConfig
+
+// NewRetryPolicies builds the retry policies of an execution from the
+// configuration. All operations share a new budget and the OnRetry callback.
+func NewRetryPolicies(cfg config.RetryConfig, onRetry func(attempt int, err error, wait time.Duration)) RetryPolicies {
+	budget := NewRetryBudget(cfg.Budget)
+	policies := RetryPolicies{}
+	for op, policy := range map[string]config.RetryPolicy{
+		OpManifest:     cfg.Manifest,
+		OpBlobDownload: cfg.BlobDownload,
+		OpBlobUpload:   cfg.BlobUpload,
+		OpCatalog:      cfg.Catalog,
+	} {
+		policy = policy.Merge(cfg.RetryPolicy)
+		policies[op] = RetryConfig{
+			MaxAttempts:     policy.MaxAttempts,
+			InitialInterval: policy.InitialInterval,
+			MaxInterval:     policy.MaxInterval,
+			Budget:          budget,
+			OnRetry:         onRetry,
+		}
+	}
+	return policies
+}
+
+// For returns the retry configuration of an operation, the default
+// configuration if it has none
+func (p RetryPolicies) For(op string) RetryConfig {
+	if c, ok := p[op]; ok {
+		return c
+	}
+	return DefaultRetryConfig()
+}
+
+// Retry runs an operation with the retry policy of op
+func (p RetryPolicies) Retry(ctx context.Context, op string, fn RetryFunc) error {
+	return retry(ctx, func(error) RetryConfig { return p.For(op) }, fn)
+}
+
+// BlobCopy returns the retry configuration for a failed blob copy: the blob
+// download policy if reading the source failed, the blob upload policy otherwise
+func (p RetryPolicies) BlobCopy(err error) RetryConfig {
+	if registry.IsDownloadError(err) {
+		return p.For(OpBlobDownload)
+	}
+	return p.For(OpBlobUpload)
+}
+
+// RetryBlobCopy runs a blob copy, retrying each failure with the policy chosen by BlobCopy
+func (p RetryPolicies) RetryBlobCopy(ctx context.Context, fn RetryFunc) error {
+	return retry(ctx, p.BlobCopy, fn)
+}
+
 // RetryFunc is a function that can be retried
 type RetryFunc func() error
 
 // RetryWithBackoff executes a function with exponential backoff retry
 func RetryWithBackoff(ctx context.Context, config RetryConfig, fn RetryFunc) error {
-	var lastErr error
-	backoff := config.InitialInterval
+	return retry(ctx, func(error) RetryConfig { return config }, fn)
+}
 
-	for attempt := 1; attempt <= config.MaxAttempts; attempt++ {
+// retry executes a function with exponential backoff retry, taking the retry
+// configuration for each failure from policy
+func retry(ctx context.Context, policy func(err error) RetryConfig, fn RetryFunc) error {
+	for attempt := 1; ; attempt++ {
 		// Execute the function
 		err := fn()
 		if err == nil {
 			return nil // Success
 		}
 
-		lastErr = err
-
 		// Check if error is retryable
 		if !isRetryableError(err) {
 			return fmt.Errorf("non-retryable error: %w", err)
 		}
 
 		// Check if we should retry
+		config := policy(err)
 		if attempt >= config.MaxAttempts {
-			break
+			return fmt.Errorf("max retries (%d) exceeded: %w", config.MaxAttempts, err)
+		}
+		if !config.Budget.Take() {
+			return fmt.Errorf("%w after %d attempts: %w", ErrRetryBudgetExhausted, attempt, err)
 		}
 
-		// Log retry attempt (could be replaced with proper logging)
-		fmt.Printf("[RETRY] Attempt %d/%d failed: %v, retrying in %v\n",
-			attempt, config.MaxAttempts, err, backoff)
+		wait := config.Backoff(attempt)
+		if config.OnRetry != nil {
+			config.OnRetry(attempt, err, wait)
+		} else {
+			fmt.Printf("[RETRY] Attempt %d/%d failed: %v, retrying in %v\n",
+				attempt, config.MaxAttempts, err, wait)
+		}
 
 		// Wait with backoff
 		select {
-		case <-time.After(backoff):
+		case <-time.After(wait):
 			// Continue to next attempt
 		case <-ctx.Done():
 			return ctx.Err()
 		}
-
-		// Exponential backoff
-		backoff *= 2
-		if backoff > config.MaxInterval {
-			backoff = config.MaxInterval
-		}
 	}
-
-	return fmt.Errorf("max retries (%d) exceeded: %w", config.MaxAttempts, lastErr)
 }
 
-// isRetryableError checks if an error is retryable
+// isRetryableError checks if an error is retryable. Errors explicitly marked
+// with RetryableError are retried; everything else is classified by
+// registry.IsRetryable using the typed registry and network errors.
 func isRetryableError(err error) bool {
 	if err == nil {
 		return false
 	}
 
-	// Context errors are not retryable
-	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
-		return false
-	}
-
-	// Network errors are retryable
-	var netErr net.Error
-	if errors.As(err, &netErr) {
-		return netErr.Timeout() || netErr.Temporary()
-	}
-
-	// Connection errors are retryable
-	if errors.Is(err, syscall.ECONNREFUSED) ||
-		errors.Is(err, syscall.ECONNRESET) ||
-		errors.Is(err, syscall.ETIMEDOUT) {
-		return true
-	}
-
-	// DNS errors are retryable
-	var dnsErr *net.DNSError
-	if errors.As(err, &dnsErr) {
-		return dnsErr.Temporary()
-	}
-
-	// Check error message for common retryable patterns
-	errMsg := strings.ToLower(err.Error())
-	retryablePatterns := []string{
-		"timeout",
-		"temporary",
-		"connection reset",
-		"connection refused",
-		"too many requests",
-		"rate limit",
-		"service unavailable",
-		"bad gateway",
-		"gateway timeout",
-	}
-
-	for _, pattern := range retryablePatterns {
-		if strings.Contains(errMsg, pattern) {
-			return true
-		}
-	}
-
-	// Check HTTP status codes
-	if strings.Contains(errMsg, "status code") {
-		// Extract status code and check if retryable
-		if strings.Contains(errMsg, "429") || // Too Many Requests
-			strings.Contains(errMsg, "500") || // Internal Server Error
-			strings.Contains(errMsg, "502") || // Bad Gateway
-			strings.Contains(errMsg, "503") || // Service Unavailable
-			strings.Contains(errMsg, "504") { // Gateway Timeout
-			return true
-		}
-
-		// 4xx errors (except 429) are not retryable
-		if strings.Contains(errMsg, "400") ||
-			strings.Contains(errMsg, "401") ||
-			strings.Contains(errMsg, "403") ||
-			strings.Contains(errMsg, "404") {
-			return false
-		}
+	var retryable *RetryableError
+	if errors.As(err, &retryable) {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
 	}
 
-	// Default: don't retry
-	return false
+	return registry.IsRetryable(err)
 }
 
-// IsHTTPError checks if an error is an HTTP error with the given status code
+// IsHTTPError checks if an error is a registry error with the given status code
 func IsHTTPError(err error, statusCode int) bool {
-	if err == nil {
-		return false
-	}
-
-	errMsg := err.Error()
-	statusStr := fmt.Sprintf("%d", statusCode)
-	return strings.Contains(errMsg, statusStr)
+	return registry.IsStatus(err, statusCode)
 }
 
 // RetryableHTTPClient wraps an HTTP client with retry logic
@@ -192,7 +248,7 @@ func (r *RetryableHTTPClient) Do(req *http.Request) (*http.Response, error) {
 		// Check if status code is retryable
 		if resp.StatusCode >= 500 || resp.StatusCode == 429 {
 			resp.Body.Close()
-			return fmt.Errorf("retryable status code: %d", resp.StatusCode)
+			return &registry.Error{Op: "send request", Method: req.Method, URL: req.URL.String(), StatusCode: resp.StatusCode}
 		}
 
 		return nil
@@ -0,0 +1,128 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// PushEvent is a tag pushed to a registry
+type PushEvent struct {
+	Repository string // full repository path, e.g. library/nginx
+	Tag        string
+	Digest     string // empty if the payload does not carry it
+}
+
+// Ref returns the repository:tag reference of the event
+func (e PushEvent) Ref() string {
+	return e.Repository + ":" + e.Tag
+}
+
+// ErrUnknownPayload is returned for payloads in none of the supported formats
+var ErrUnknownPayload = errors.New("unknown webhook payload, expected a Harbor, distribution or Docker Hub notification")
+
+// Harbor event types of pushed artifacts: 2.x and 1.x
+const (
+	harborPushArtifact = "PUSH_ARTIFACT"
+	harborPushImage    = "pushImage"
+)
+
+// payload holds the fields of all supported formats, they do not overlap
+type payload struct {
+	// Harbor
+	Type      string `json:"type"`
+	EventData *struct {
+		Resources []struct {
+			Digest string `json:"digest"`
+			Tag    string `json:"tag"`
+		} `json:"resources"`
+		Repository struct {
+			Name         string `json:"name"`
+			Namespace    string `json:"namespace"`
+			RepoFullName string `json:"repo_full_name"`
+		} `json:"repository"`
+	} `json:"event_data"`
+
+	// CNCF distribution notification envelope
+	Events []struct {
+		Action string `json:"action"`
+		Target struct {
+			Digest     string `json:"digest"`
+			Repository string `json:"repository"`
+			Tag        string `json:"tag"`
+		} `json:"target"`
+	} `json:"events"`
+
+	// Docker Hub
+	PushData *struct {
+		Tag string `json:"tag"`
+	} `json:"push_data"`
+	Repository *struct {
+		RepoName  string `json:"repo_name"`
+		Namespace string `json:"namespace"`
+		Name      string `json:"name"`
+	} `json:"repository"`
+}
+
+// Parse extracts the pushed tags of a Harbor, CNCF distribution or Docker
+// Hub webhook payload. Other events, such as deletions or pushes of blobs
+// and untagged manifests, are ignored.
+func Parse(body []byte) ([]PushEvent, error) {
+	var p payload
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, ErrUnknownPayload
+	}
+
+	events := []PushEvent{}
+	switch {
+	case p.EventData != nil:
+		if p.Type != harborPushArtifact && p.Type != harborPushImage {
+			return events, nil
+		}
+		repo := p.EventData.Repository.RepoFullName
+		if repo == "" {
+			repo = joinRepo(p.EventData.Repository.Namespace, p.EventData.Repository.Name)
+		}
+		for _, resource := range p.EventData.Resources {
+			if resource.Tag != "" {
+				events = append(events, PushEvent{Repository: repo, Tag: resource.Tag, Digest: resource.Digest})
+			}
+		}
+
+	case p.Events != nil:
+		for _, event := range p.Events {
+			if event.Action == "push" && event.Target.Tag != "" {
+				events = append(events, PushEvent{
+					Repository: event.Target.Repository,
+					Tag:        event.Target.Tag,
+					Digest:     event.Target.Digest,
+				})
+			}
+		}
+
+	case p.PushData != nil && p.Repository != nil:
+		repo := p.Repository.RepoName
+		if repo == "" {
+			repo = joinRepo(p.Repository.Namespace, p.Repository.Name)
+		}
+		if p.PushData.Tag != "" {
+			events = append(events, PushEvent{Repository: repo, Tag: p.PushData.Tag})
+		}
+
+	default:
+		return nil, ErrUnknownPayload
+	}
+
+	for i := range events {
+		events[i].Repository = strings.Trim(events[i].Repository, "/")
+	}
+	return events, nil
+}
+
+// joinRepo joins a namespace and a repository name
+func joinRepo(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + "/" + name
+}
@@ -8,6 +8,7 @@ import Registries from './pages/Registries';
 import Tasks from './pages/Tasks';
 import Executions from './pages/Executions';
 import Notifications from './pages/Notifications';
+import Webhooks from './pages/Webhooks';
 
 const App: React.FC = () => {
   return (
@@ -20,6 +21,7 @@ const App: React.FC = () => {
             <Route path="/tasks" element={<Tasks />} />
             <Route path="/executions" element={<Executions />} />
             <Route path="/notifications" element={<Notifications />} />
+            <Route path="/webhooks" element={<Webhooks />} />
           </Routes>
         </AppLayout>
       </BrowserRouter>
@@ -1,11 +1,17 @@
 import axios from 'axios';
 import type {
   Registry,
+  RegistryQuota,
   SyncTask,
+  TaskSchedule,
   Execution,
   ExecutionLog,
+  ExecutionImagePage,
+  ImageStatus,
+  Pipeline,
   Stats,
   NotificationChannel,
+  Webhook,
 } from '../types';
 
 const API_BASE_URL = '/api/v1';
@@ -26,6 +32,8 @@ export const registryApi = {
     client.put<Registry>(`/registries/${id}`, data),
   delete: (id: number) => client.delete(`/registries/${id}`),
   test: (id: number) => client.post(`/registries/${id}/test`),
+  quota: (id: number, refresh = false) =>
+    client.get<RegistryQuota>(`/registries/${id}/quota`, { params: { refresh } }),
   listProjects: (id: number) => client.get<string[]>(`/registries/${id}/projects`),
   listRepositories: (id: number, project: string) =>
     client.get<string[]>(`/registries/${id}/projects/${project}/repositories`),
@@ -41,6 +49,8 @@ export const taskApi = {
   delete: (id: number) => client.delete(`/tasks/${id}`),
   run: (id: number) => client.post(`/tasks/${id}/run`),
   stop: (id: number) => client.post(`/tasks/${id}/stop`),
+  schedule: (id: number, count = 5) =>
+    client.get<TaskSchedule>(`/tasks/${id}/schedule`, { params: { count } }),
 };
 
 // Execution API
@@ -52,6 +62,15 @@ export const executionApi = {
     client.get<ExecutionLog[]>(`/executions/${id}/logs`, {
       params: { limit },
     }),
+  resume: (id: number) => client.post(`/executions/${id}/resume`),
+  cancel: (id: number) => client.post(`/executions/${id}/cancel`),
+  images: (
+    id: number,
+    params?: { status?: ImageStatus; repository?: string; tag?: string; error_code?: string; digest?: string; page?: number; page_size?: number }
+  ) => client.get<ExecutionImagePage>(`/executions/${id}/images`, { params }),
+  pipeline: (id: number) => client.get<Pipeline>(`/executions/${id}/pipeline`),
+  retryFailed: (id: number) =>
+    client.post<{ execution_id: number; tags: string[] }>(`/executions/${id}/retry-failed`),
 };
 
 // Stats API
@@ -71,4 +90,14 @@ export const notificationApi = {
   test: (id: number) => client.post(`/notifications/${id}/test`),
 };
 
+// Webhook API
+export const webhookApi = {
+  list: () => client.get<Webhook[]>('/webhooks'),
+  create: (data: Partial<Webhook>) => client.post<Webhook>('/webhooks', data),
+  update: (id: number, data: Partial<Webhook>) =>
+    client.put<Webhook>(`/webhooks/${id}`, data),
+  delete: (id: number) => client.delete(`/webhooks/${id}`),
+  rotate: (id: number) => client.post<Webhook>(`/webhooks/${id}/rotate`),
+};
+
 export default client;
@@ -6,6 +6,7 @@ import {
   SyncOutlined,
   HistoryOutlined,
   BellOutlined,
+  ApiOutlined,
 } from '@ant-design/icons';
 import { Link, useLocation } from 'react-router-dom';
 
@@ -47,6 +48,11 @@ const AppLayout: React.FC<LayoutProps> = ({ children }) => {
       icon: <BellOutlined />,
       label: <Link to="/notifications">通知配置</Link>,
     },
+    {
+      key: '/webhooks',
+      icon: <ApiOutlined />,
+      label: <Link to="/webhooks">Webhook</Link>,
+    },
   ];
 
   return (
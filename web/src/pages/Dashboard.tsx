@@ -38,6 +38,7 @@ const Dashboard: React.FC = () => {
       running: { color: 'processing', icon: <SyncOutlined spin /> },
       pending: { color: 'default', icon: <ClockCircleOutlined /> },
       canceled: { color: 'warning', icon: <CloseCircleOutlined /> },
+      timed_out: { color: 'error', icon: <ClockCircleOutlined /> },
     };
 
     const config = statusConfig[status] || statusConfig.pending;
@@ -197,7 +198,7 @@ const Dashboard: React.FC = () => {
         </Col>
         <Col xs={24} sm={12} lg={6}>
           <StatCard
-            title="运行中"
+            title={stats?.pending_executions ? `运行中（${stats.pending_executions} 个排队）` : '运行中'}
             value={stats?.running_executions || 0}
             icon={<SyncOutlined spin />}
             color="#faad14"
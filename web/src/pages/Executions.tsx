@@ -1,16 +1,17 @@
 import React, { useState, useMemo } from 'react';
-import { Table, Tag, Button, Modal, Timeline, Typography, Card, Input, Select, Space, DatePicker } from 'antd';
-import { CheckCircleOutlined, CloseCircleOutlined, SyncOutlined, EyeOutlined, SearchOutlined } from '@ant-design/icons';
-import { useApi } from '../hooks/useApi';
+import { Table, Tag, Button, Modal, Timeline, Typography, Card, Input, Select, Space, DatePicker, Tabs, Tooltip } from 'antd';
+import { CheckCircleOutlined, CloseCircleOutlined, SyncOutlined, EyeOutlined, SearchOutlined, PlayCircleOutlined, RedoOutlined, StopOutlined, ClockCircleOutlined } from '@ant-design/icons';
+import { useApi, useAsyncAction } from '../hooks/useApi';
 import { executionApi, taskApi } from '../api/client';
-import type { Execution, ExecutionLog } from '../types';
+import type { Execution, ExecutionLog, ExecutionImage, ImageStatus } from '../types';
 import dayjs from 'dayjs';
 
 const { Text } = Typography;
 const { RangePicker } = DatePicker;
 
 const Executions: React.FC = () => {
-  const { data: executions, loading } = useApi(() => executionApi.list({ limit: 100 }), []);
+  const { data: executions, loading, refetch } = useApi(() => executionApi.list({ limit: 100 }), []);
+  const { execute } = useAsyncAction();
   const { data: tasks } = useApi(() => taskApi.list(), []);
   const [selectedExecution, setSelectedExecution] = useState<number | null>(null);
   const [logsVisible, setLogsVisible] = useState(false);
@@ -18,12 +19,27 @@ const Executions: React.FC = () => {
   const [statusFilter, setStatusFilter] = useState<string | null>(null);
   const [taskFilter, setTaskFilter] = useState<number | null>(null);
   const [dateRange, setDateRange] = useState<[dayjs.Dayjs | null, dayjs.Dayjs | null] | null>(null);
+  const [imageStatus, setImageStatus] = useState<ImageStatus | undefined>(undefined);
+  const [imagePage, setImagePage] = useState({ page: 1, page_size: 20 });
 
   const { data: logs, loading: logsLoading } = useApi(
     () => (selectedExecution ? executionApi.logs(selectedExecution) : Promise.resolve({ data: [] })),
     [selectedExecution]
   );
 
+  const { data: images, loading: imagesLoading } = useApi(
+    () =>
+      selectedExecution
+        ? executionApi.images(selectedExecution, { status: imageStatus, ...imagePage })
+        : Promise.resolve({ data: { items: [], total: 0, page: 1, page_size: 20 } }),
+    [selectedExecution, imageStatus, imagePage]
+  );
+
+  const { data: pipeline, loading: pipelineLoading } = useApi(
+    () => (selectedExecution ? executionApi.pipeline(selectedExecution) : Promise.resolve({ data: null })),
+    [selectedExecution]
+  );
+
   // 筛选逻辑
   const filteredExecutions = useMemo(() => {
     if (!executions) return [];
@@ -67,6 +83,8 @@ const Executions: React.FC = () => {
       running: { color: 'processing', icon: <SyncOutlined spin /> },
       pending: { color: 'default', icon: null },
       canceled: { color: 'warning', icon: null },
+      interrupted: { color: 'warning', icon: null },
+      timed_out: { color: 'error', icon: <ClockCircleOutlined /> },
     };
 
     const config = statusConfig[status] || statusConfig.pending;
@@ -77,8 +95,25 @@ const Executions: React.FC = () => {
     );
   };
 
+  const handleCancel = async (executionId: number) => {
+    const success = await execute(() => executionApi.cancel(executionId), '已取消执行');
+    if (success) refetch();
+  };
+
+  const handleResume = async (executionId: number) => {
+    const success = await execute(() => executionApi.resume(executionId), '已恢复执行');
+    if (success) refetch();
+  };
+
+  const handleRetryFailed = async (executionId: number) => {
+    const success = await execute(() => executionApi.retryFailed(executionId), '已开始重试失败的 tag');
+    if (success) refetch();
+  };
+
   const handleViewLogs = (executionId: number) => {
     setSelectedExecution(executionId);
+    setImageStatus(undefined);
+    setImagePage({ page: 1, page_size: 20 });
     setLogsVisible(true);
   };
 
@@ -93,13 +128,28 @@ const Executions: React.FC = () => {
       title: '任务',
       dataIndex: ['task', 'name'],
       key: 'task_name',
-      render: (name: string) => name || '-',
+      render: (name: string, record: Execution) =>
+        record.worker ? (
+          <div>
+            <div>{name || '-'}</div>
+            <Text type="secondary" style={{ fontSize: 12 }}>worker: {record.worker}</Text>
+          </div>
+        ) : (
+          name || '-'
+        ),
     },
     {
       title: '状态',
       dataIndex: 'status',
       key: 'status',
-      render: (status: string) => getStatusTag(status),
+      render: (status: string, record: Execution) =>
+        record.canceled_by ? (
+          <Tooltip title={`${record.canceled_by} 于 ${dayjs(record.canceled_at).format('YYYY-MM-DD HH:mm:ss')} 取消`}>
+            {getStatusTag(status)}
+          </Tooltip>
+        ) : (
+          getStatusTag(status)
+        ),
     },
     {
       title: '进度',
@@ -140,17 +190,124 @@ const Executions: React.FC = () => {
       title: '操作',
       key: 'actions',
       render: (_: any, record: Execution) => (
-        <Button
-          type="link"
-          icon={<EyeOutlined />}
-          onClick={() => handleViewLogs(record.id)}
-        >
-          查看日志
-        </Button>
+        <Space>
+          <Button
+            type="link"
+            icon={<EyeOutlined />}
+            onClick={() => handleViewLogs(record.id)}
+          >
+            查看日志
+          </Button>
+          {(record.status === 'running' || record.status === 'pending') && (
+            <Button
+              type="link"
+              danger
+              icon={<StopOutlined />}
+              onClick={() => handleCancel(record.id)}
+            >
+              取消
+            </Button>
+          )}
+          {(record.status === 'interrupted' || record.status === 'timed_out') && (
+            <Button
+              type="link"
+              icon={<PlayCircleOutlined />}
+              onClick={() => handleResume(record.id)}
+            >
+              恢复执行
+            </Button>
+          )}
+          {(record.status === 'failed' || (record.status === 'success' && record.failed_blobs > 0)) && (
+            <Button
+              type="link"
+              icon={<RedoOutlined />}
+              onClick={() => handleRetryFailed(record.id)}
+            >
+              重试失败的 tag
+            </Button>
+          )}
+        </Space>
       ),
     },
   ];
 
+  const formatBytes = (bytes: number) => {
+    if (bytes < 1024) return `${bytes} B`;
+    if (bytes < 1024 * 1024) return `${(bytes / 1024).toFixed(1)} KB`;
+    if (bytes < 1024 * 1024 * 1024) return `${(bytes / 1024 / 1024).toFixed(1)} MB`;
+    return `${(bytes / 1024 / 1024 / 1024).toFixed(2)} GB`;
+  };
+
+  const imageStatusColors: Record<ImageStatus, string> = {
+    success: 'success',
+    failed: 'error',
+    skipped: 'warning',
+    pending: 'default',
+  };
+
+  const imageColumns = [
+    {
+      title: '镜像',
+      key: 'ref',
+      render: (_: any, record: ExecutionImage) => (
+        <div>
+          <div>{`${record.repository}:${record.tag}`}</div>
+          {record.source_digest && (
+            <Tooltip title={record.source_digest}>
+              <Text type="secondary" style={{ fontSize: 12 }}>
+                {record.source_digest.slice(0, 19)}
+              </Text>
+            </Tooltip>
+          )}
+        </div>
+      ),
+    },
+    {
+      title: '状态',
+      dataIndex: 'status',
+      key: 'status',
+      render: (status: ImageStatus, record: ExecutionImage) => {
+        const tag = <Tag color={imageStatusColors[status]}>{status.toUpperCase()}</Tag>;
+        return record.error ? <Tooltip title={`${record.error_code || ''} ${record.error}`}>{tag}</Tooltip> : tag;
+      },
+    },
+    {
+      title: '目标',
+      key: 'targets',
+      render: (_: any, record: ExecutionImage) =>
+        (record.targets || []).map((target) => (
+          <div key={target.registry}>
+            <Tooltip title={target.digest || target.error}>
+              <Text type={target.status === 'success' ? undefined : 'danger'} style={{ fontSize: 12 }}>
+                {target.ref}
+              </Text>
+            </Tooltip>
+          </div>
+        )),
+    },
+    {
+      title: 'Blobs',
+      key: 'blobs',
+      render: (_: any, record: ExecutionImage) => (
+        <Text style={{ fontSize: 12 }}>
+          上传 {record.blobs_copied} | 挂载 {record.blobs_mounted} | 跳过 {record.blobs_skipped}
+        </Text>
+      ),
+    },
+    {
+      title: '传输',
+      dataIndex: 'bytes_transferred',
+      key: 'bytes_transferred',
+      render: (bytes: number) => formatBytes(bytes),
+    },
+    {
+      title: '耗时',
+      dataIndex: 'duration_ms',
+      key: 'duration_ms',
+      render: (ms: number) => (ms ? `${(ms / 1000).toFixed(1)}秒` : '-'),
+    },
+  ];
+
   const getLogColor = (level: string) => {
     const colors: Record<string, string> = {
       error: 'red',
@@ -199,6 +356,9 @@ const Executions: React.FC = () => {
               <Select.Option value="failed">失败</Select.Option>
               <Select.Option value="running">运行中</Select.Option>
               <Select.Option value="pending">待运行</Select.Option>
+              <Select.Option value="interrupted">已中断</Select.Option>
+              <Select.Option value="timed_out">已超时</Select.Option>
+              <Select.Option value="canceled">已取消</Select.Option>
             </Select>
             <RangePicker
               showTime
@@ -224,32 +384,110 @@ const Executions: React.FC = () => {
       </Card>
 
       <Modal
-        title="执行日志"
+        title="执行详情"
         open={logsVisible}
         onCancel={() => setLogsVisible(false)}
         footer={null}
-        width={900}
+        width={1000}
       >
-        <Timeline
-          items={(logs || []).map((log: ExecutionLog) => ({
-            color: getLogColor(log.level),
-            children: (
-              <div>
-                <Text type="secondary" style={{ fontSize: 12 }}>
-                  {dayjs(log.timestamp).format('HH:mm:ss')}
-                </Text>
-                <div style={{ marginTop: 4 }}>
-                  <Tag color={getLogColor(log.level)}>{log.level.toUpperCase()}</Tag>
-                  {log.message}
-                </div>
-              </div>
-            ),
-          }))}
+        <Tabs
+          items={[
+            {
+              key: 'logs',
+              label: '日志',
+              children: (
+                <>
+                  <Timeline
+                    items={(logs || []).map((log: ExecutionLog) => ({
+                      color: getLogColor(log.level),
+                      children: (
+                        <div>
+                          <Text type="secondary" style={{ fontSize: 12 }}>
+                            {dayjs(log.timestamp).format('HH:mm:ss')}
+                          </Text>
+                          <div style={{ marginTop: 4 }}>
+                            <Tag color={getLogColor(log.level)}>{log.level.toUpperCase()}</Tag>
+                            {log.message}
+                          </div>
+                        </div>
+                      ),
+                    }))}
+                  />
+                  {logsLoading && <div style={{ textAlign: 'center', padding: 20 }}>加载中...</div>}
+                  {!logsLoading && (!logs || logs.length === 0) && (
+                    <div style={{ textAlign: 'center', padding: 20, color: '#999' }}>暂无日志</div>
+                  )}
+                </>
+              ),
+            },
+            {
+              key: 'images',
+              label: '镜像结果',
+              children: (
+                <>
+                  <Select
+                    placeholder="状态筛选"
+                    value={imageStatus}
+                    onChange={(status) => {
+                      setImageStatus(status);
+                      setImagePage({ ...imagePage, page: 1 });
+                    }}
+                    style={{ width: 130, marginBottom: 16 }}
+                    allowClear
+                  >
+                    <Select.Option value="success">成功</Select.Option>
+                    <Select.Option value="failed">失败</Select.Option>
+                    <Select.Option value="skipped">跳过</Select.Option>
+                    <Select.Option value="pending">待同步</Select.Option>
+                  </Select>
+                  <Table
+                    dataSource={images?.items || []}
+                    columns={imageColumns}
+                    rowKey="id"
+                    size="small"
+                    loading={imagesLoading}
+                    pagination={{
+                      current: imagePage.page,
+                      pageSize: imagePage.page_size,
+                      total: images?.total || 0,
+                      showTotal: (total) => `共 ${total} 个镜像`,
+                      onChange: (page, pageSize) => setImagePage({ page, page_size: pageSize }),
+                    }}
+                  />
+                </>
+              ),
+            },
+            {
+              key: 'pipeline',
+              label: '流水线',
+              children: (
+                <>
+                  {pipeline && (
+                    <Space style={{ marginBottom: 16 }}>
+                      <span>运行 #{pipeline.run_id}</span>
+                      {getStatusTag(pipeline.status)}
+                      <Text type="secondary">{dayjs(pipeline.start_time).format('YYYY-MM-DD HH:mm:ss')}</Text>
+                    </Space>
+                  )}
+                  <Timeline
+                    items={(pipeline?.executions || []).map((exec: Execution) => ({
+                      color: exec.id === selectedExecution ? 'blue' : 'gray',
+                      children: (
+                        <Space>
+                          <span>#{exec.id}</span>
+                          <span>{exec.task?.name || `任务 ${exec.task_id}`}</span>
+                          {getStatusTag(exec.status)}
+                          {exec.triggered_by && <Text type="secondary">由 #{exec.triggered_by} 触发</Text>}
+                        </Space>
+                      ),
+                    }))}
+                  />
+                  {pipelineLoading && <div style={{ textAlign: 'center', padding: 20 }}>加载中...</div>}
+                </>
+              ),
+            },
+          ]}
         />
-        {logsLoading && <div style={{ textAlign: 'center', padding: 20 }}>加载中...</div>}
-        {!logsLoading && (!logs || logs.length === 0) && (
-          <div style={{ textAlign: 'center', padding: 20, color: '#999' }}>暂无日志</div>
-        )}
       </Modal>
     </div>
   );
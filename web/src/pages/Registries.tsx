@@ -1,9 +1,9 @@
 import React, { useState, useMemo } from 'react';
-import { Table, Button, Modal, Form, Input, Switch, InputNumber, Space, Popconfirm, Card } from 'antd';
+import { Table, Button, Modal, Form, Input, Switch, InputNumber, Space, Popconfirm, Card, Tag, Tooltip } from 'antd';
 import { PlusOutlined, EditOutlined, DeleteOutlined, CheckCircleOutlined, SearchOutlined } from '@ant-design/icons';
 import { useApi, useAsyncAction } from '../hooks/useApi';
 import { registryApi } from '../api/client';
-import type { Registry } from '../types';
+import type { Registry, BreakerState } from '../types';
 
 const Registries: React.FC = () => {
   const { data: registries, loading, refetch } = useApi(() => registryApi.list(), []);
@@ -94,6 +94,23 @@ const Registries: React.FC = () => {
       key: 'insecure',
       render: (insecure: boolean) => (insecure ? '是' : '否'),
     },
+    {
+      title: '熔断器',
+      dataIndex: 'breaker',
+      key: 'breaker',
+      render: (breaker?: BreakerState) => {
+        if (!breaker || breaker.state === 'closed') {
+          return <Tag color="success">正常</Tag>;
+        }
+        const label = breaker.state === 'open' ? '熔断中' : '探测中';
+        const retryAt = breaker.retry_at ? new Date(breaker.retry_at).toLocaleString() : '-';
+        return (
+          <Tooltip title={`连续失败 ${breaker.failures} 次，${retryAt} 后重试: ${breaker.last_error || ''}`}>
+            <Tag color={breaker.state === 'open' ? 'error' : 'warning'}>{label}</Tag>
+          </Tooltip>
+        );
+      },
+    },
     {
       title: '操作',
       key: 'actions',
@@ -197,6 +214,14 @@ const Registries: React.FC = () => {
             <InputNumber min={0} placeholder="0 表示无限制" style={{ width: '100%' }} />
           </Form.Item>
 
+          <Form.Item
+            name="bandwidth"
+            label="带宽限制"
+            extra="blob 上传和下载的速率，可按时段设置 (例如: 08:00-20:00=20MB,100MB 表示白天 20MB/s，其余时间 100MB/s)"
+          >
+            <Input placeholder="如 20MB，留空表示无限制" />
+          </Form.Item>
+
           <Form.Item name="insecure" label="允许不安全连接" valuePropName="checked">
             <Switch />
           </Form.Item>
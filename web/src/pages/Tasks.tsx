@@ -1,6 +1,6 @@
 import React, { useState, useMemo } from 'react';
-import { Table, Button, Space, Tag, Switch, Popconfirm, Modal, Form, Input, Select, InputNumber, Checkbox, Card, Alert, Radio } from 'antd';
-import { PlayCircleOutlined, StopOutlined, EditOutlined, DeleteOutlined, PlusOutlined, SearchOutlined } from '@ant-design/icons';
+import { Table, Button, Space, Tag, Switch, Popconfirm, Modal, Form, Input, Select, InputNumber, Checkbox, Card, Alert, Radio, Popover } from 'antd';
+import { PlayCircleOutlined, StopOutlined, EditOutlined, DeleteOutlined, PlusOutlined, SearchOutlined, MinusCircleOutlined } from '@ant-design/icons';
 import { useApi, useAsyncAction } from '../hooks/useApi';
 import { taskApi, registryApi, notificationApi } from '../api/client';
 import type { SyncTask } from '../types';
@@ -18,6 +18,22 @@ const CRON_PRESETS = [
   { label: '自定义', value: 'custom', description: '手动输入 Cron 表达式' },
 ];
 
+// 接下来的定时运行时间，悬停时加载
+const NextRuns: React.FC<{ taskId: number }> = ({ taskId }) => {
+  const { data, loading } = useApi(() => taskApi.schedule(taskId), [taskId]);
+
+  if (loading) return <span>加载中...</span>;
+  if (!data?.next_runs?.length) return <span>没有即将到来的运行</span>;
+  return (
+    <div>
+      <div style={{ color: '#666', marginBottom: 4 }}>接下来的运行：</div>
+      {data.next_runs.map((run) => (
+        <div key={run}>{run}</div>
+      ))}
+    </div>
+  );
+};
+
 const Tasks: React.FC = () => {
   const { data: tasks, loading, refetch } = useApi(() => taskApi.list(), []);
   const { data: registries } = useApi(() => registryApi.list(), []);
@@ -172,6 +188,10 @@ const Tasks: React.FC = () => {
         tag_exclude: values.tag_exclude ? values.tag_exclude.split(',').map((s: string) => s.trim()).filter(Boolean) : [],
         architectures: values.architectures || ['amd64'],
         tag_latest: values.tag_latest || 0,
+        quota_threshold: values.quota_threshold || 0,
+        timeout: values.timeout || 0,
+        // 保留表单中未展示的各操作重试策略
+        retry: { ...editingTask?.retry, ...values.retry },
         enabled: values.enabled !== false,
         send_notification: values.send_notification || false,
         notification_condition: values.notification_condition || 'all',
@@ -287,13 +307,19 @@ const Tasks: React.FC = () => {
       title: '定时任务',
       dataIndex: 'cron_expression',
       key: 'cron_expression',
-      render: (cron: string) => {
+      render: (cron: string, record: SyncTask) => {
         if (!cron) return '-';
         const preset = CRON_PRESETS.find(p => p.value === cron);
         return (
-          <span title={cron}>
-            {preset ? preset.label : cron}
-          </span>
+          <Popover
+            title={`${cron}${record.timezone ? ` (${record.timezone})` : ''}`}
+            content={<NextRuns taskId={record.id} />}
+            destroyTooltipOnHide
+          >
+            <span>
+              {preset ? preset.label : cron}
+            </span>
+          </Popover>
         );
       },
     },
@@ -591,6 +617,52 @@ const Tasks: React.FC = () => {
             </Select>
           </Form.Item>
 
+          <Form.Item
+            name="bandwidth"
+            label="带宽限制"
+            extra="本任务 blob 下载的速率，可按时段设置 (例如: 08:00-20:00=20MB 表示白天 20MB/s，夜间不限速)"
+          >
+            <Input placeholder="如 20MB，留空表示无限制" />
+          </Form.Item>
+
+          <Form.Item
+            name="quota_threshold"
+            label="拉取配额阈值"
+            extra="源 Registry（如 Docker Hub）剩余拉取配额低于该值时停止或推迟同步，0 表示不检查"
+          >
+            <InputNumber min={0} placeholder="0 表示不检查" style={{ width: '100%' }} />
+          </Form.Item>
+
+          <Form.Item name="quota_action" label="配额不足时" initialValue="stop">
+            <Select>
+              <Select.Option value="stop">停止同步</Select.Option>
+              <Select.Option value="postpone">推迟剩余 tag 到下一个配额窗口</Select.Option>
+            </Select>
+          </Form.Item>
+
+          <Form.Item
+            name="timeout"
+            label="最长执行时间（秒）"
+            extra="执行超过该时间后终止并标记为超时，可恢复执行以继续未完成的 tag；0 表示使用服务端默认值"
+          >
+            <InputNumber min={0} placeholder="0 表示使用服务端默认值" style={{ width: '100%' }} />
+          </Form.Item>
+
+          <Space style={{ width: '100%' }} size="large">
+            <Form.Item name={['retry', 'max_attempts']} label="最大尝试次数" extra="失败操作的最大尝试次数，默认 3">
+              <InputNumber min={0} placeholder="3" />
+            </Form.Item>
+            <Form.Item name={['retry', 'max_interval']} label="最大重试间隔（秒）" extra="重试间隔随机取指数退避内的值，默认 30">
+              <InputNumber min={0} placeholder="30" />
+            </Form.Item>
+            <Form.Item name={['retry', 'budget']} label="重试预算" extra="每次执行最多重试次数，0 表示不限">
+              <InputNumber min={0} placeholder="0" />
+            </Form.Item>
+            <Form.Item name={['retry', 'blob_upload', 'max_attempts']} label="Blob 上传尝试次数" extra="覆盖上面的最大尝试次数">
+              <InputNumber min={0} placeholder="默认" />
+            </Form.Item>
+          </Space>
+
           <Form.Item label="定时任务设置">
             <Radio.Group
               value={cronPreset}
@@ -628,7 +700,7 @@ const Tasks: React.FC = () => {
               name="cron_expression"
               label="自定义 Cron 表达式"
               rules={[{ required: true, message: '请输入 Cron 表达式' }]}
-              extra="格式: 分 时 日 月 星期 (例如: 0 2 * * * 表示每天凌晨2点)"
+              extra="格式: [秒] 分 时 日 月 星期 (例如: 0 2 * * * 表示每天凌晨2点)，也支持 @daily、@every 10m"
             >
               <Input placeholder="输入自定义 Cron 表达式" />
             </Form.Item>
@@ -636,6 +708,77 @@ const Tasks: React.FC = () => {
 
           {!cronPreset && <Form.Item name="cron_expression" hidden><Input /></Form.Item>}
 
+          <Form.Item
+            name="timezone"
+            label="时区"
+            extra="IANA 时区名，如 Asia/Shanghai；留空使用服务器时区"
+            hidden={!cronPreset}
+          >
+            <Input placeholder="服务器时区" allowClear />
+          </Form.Item>
+
+          <Form.Item
+            name="catch_up"
+            label="错过的运行"
+            initialValue="skip"
+            extra="服务停止期间错过定时运行时的处理方式"
+            hidden={!cronPreset}
+          >
+            <Select>
+              <Select.Option value="skip">忽略</Select.Option>
+              <Select.Option value="run-once">启动时补跑一次</Select.Option>
+            </Select>
+          </Form.Item>
+
+          <Form.Item
+            name="overlap_policy"
+            label="上次执行未结束时"
+            initialValue="skip"
+            extra="定时触发时任务仍在运行的处理方式"
+            hidden={!cronPreset}
+          >
+            <Select>
+              <Select.Option value="skip">跳过本次触发</Select.Option>
+              <Select.Option value="queue">排队，上次执行结束后运行</Select.Option>
+              <Select.Option value="cancel-previous">取消上次执行，然后运行</Select.Option>
+            </Select>
+          </Form.Item>
+
+          <Form.Item label="依赖任务" extra="上游任务执行结束并满足条件后自动运行此任务">
+            <Form.List name="depends_on">
+              {(fields, { add, remove }) => (
+                <>
+                  {fields.map((field) => (
+                    <Space key={field.key} align="baseline">
+                      <Form.Item
+                        name={[field.name, 'task_id']}
+                        rules={[{ required: true, message: '请选择上游任务' }]}
+                      >
+                        <Select placeholder="上游任务" style={{ width: 240 }} showSearch optionFilterProp="children">
+                          {(tasks || [])
+                            .filter((t) => t.id !== editingTask?.id)
+                            .map((t) => (
+                              <Select.Option key={t.id} value={t.id}>{t.name}</Select.Option>
+                            ))}
+                        </Select>
+                      </Form.Item>
+                      <Form.Item name={[field.name, 'condition']} initialValue="success">
+                        <Select style={{ width: 160 }}>
+                          <Select.Option value="success">上游成功后</Select.Option>
+                          <Select.Option value="always">上游结束后（成功或失败）</Select.Option>
+                        </Select>
+                      </Form.Item>
+                      <MinusCircleOutlined onClick={() => remove(field.name)} />
+                    </Space>
+                  ))}
+                  <Button type="dashed" onClick={() => add()} icon={<PlusOutlined />}>
+                    添加依赖
+                  </Button>
+                </>
+              )}
+            </Form.List>
+          </Form.Item>
+
           <div style={{ border: '1px solid #d9d9d9', borderRadius: 4, padding: 16, marginBottom: 16 }}>
             <h3 style={{ marginTop: 0 }}>通知配置</h3>
 
@@ -650,7 +793,7 @@ const Tasks: React.FC = () => {
                     <Form.Item name="notification_condition" label="通知条件" initialValue="all">
                       <Select>
                         <Select.Option value="all">全部发送（成功+失败）</Select.Option>
-                        <Select.Option value="failed">仅失败时发送</Select.Option>
+                        <Select.Option value="failed">仅失败或超时时发送</Select.Option>
                       </Select>
                     </Form.Item>
 
@@ -0,0 +1,194 @@
+import React, { useState } from 'react';
+import { Table, Button, Modal, Form, Input, Switch, Space, Popconfirm, Card, Select, Tag, Typography } from 'antd';
+import { PlusOutlined, EditOutlined, DeleteOutlined, KeyOutlined } from '@ant-design/icons';
+import { useApi, useAsyncAction } from '../hooks/useApi';
+import { webhookApi, registryApi } from '../api/client';
+import type { Webhook } from '../types';
+import dayjs from 'dayjs';
+
+const { Text } = Typography;
+
+// 回调地址：registry 推送事件时调用
+const hookUrl = (token: string) => `${window.location.origin}/api/v1/hooks/${token}`;
+
+const Webhooks: React.FC = () => {
+  const { data: hooks, loading, refetch } = useApi(() => webhookApi.list(), []);
+  const { data: registries } = useApi(() => registryApi.list(), []);
+  const { loading: actionLoading, execute } = useAsyncAction();
+  const [modalVisible, setModalVisible] = useState(false);
+  const [editingHook, setEditingHook] = useState<Webhook | null>(null);
+  const [form] = Form.useForm();
+
+  const handleCreate = () => {
+    setEditingHook(null);
+    form.resetFields();
+    setModalVisible(true);
+  };
+
+  const handleEdit = (record: Webhook) => {
+    setEditingHook(record);
+    form.setFieldsValue(record);
+    setModalVisible(true);
+  };
+
+  const handleDelete = async (id: number) => {
+    const success = await execute(() => webhookApi.delete(id), 'Webhook 已删除，令牌已失效');
+    if (success) refetch();
+  };
+
+  const handleRotate = async (id: number) => {
+    const success = await execute(() => webhookApi.rotate(id), '已生成新令牌，旧地址已失效');
+    if (success) refetch();
+  };
+
+  const handleSubmit = async () => {
+    try {
+      const values = await form.validateFields();
+      if (editingHook) {
+        await execute(() => webhookApi.update(editingHook.id, values), 'Webhook 更新成功');
+      } else {
+        await execute(() => webhookApi.create(values), 'Webhook 创建成功');
+      }
+      setModalVisible(false);
+      refetch();
+    } catch (error) {
+      console.error('Validation failed:', error);
+    }
+  };
+
+  const columns = [
+    {
+      title: '名称',
+      dataIndex: 'name',
+      key: 'name',
+    },
+    {
+      title: '源 Registry',
+      dataIndex: ['registry_obj', 'name'],
+      key: 'registry',
+      render: (name: string) => name || '-',
+    },
+    {
+      title: '回调地址',
+      dataIndex: 'token',
+      key: 'token',
+      render: (token: string) => (
+        <Text copyable={{ text: hookUrl(token) }} style={{ fontSize: 12 }}>
+          /api/v1/hooks/{token.substring(0, 8)}...
+        </Text>
+      ),
+    },
+    {
+      title: '最近触发',
+      dataIndex: 'last_triggered_at',
+      key: 'last_triggered_at',
+      render: (time?: string) => (time ? dayjs(time).format('YYYY-MM-DD HH:mm:ss') : '-'),
+    },
+    {
+      title: '状态',
+      dataIndex: 'enabled',
+      key: 'enabled',
+      render: (enabled: boolean) => (
+        <Tag color={enabled ? 'success' : 'default'}>
+          {enabled ? '已启用' : '已禁用'}
+        </Tag>
+      ),
+    },
+    {
+      title: '操作',
+      key: 'actions',
+      render: (_: any, record: Webhook) => (
+        <Space>
+          <Button type="link" icon={<EditOutlined />} onClick={() => handleEdit(record)}>
+            编辑
+          </Button>
+          <Popconfirm
+            title="确定要重新生成令牌吗？"
+            description="旧的回调地址将立即失效，需要在 Registry 中更新"
+            onConfirm={() => handleRotate(record.id)}
+            okText="确定"
+            cancelText="取消"
+          >
+            <Button type="link" icon={<KeyOutlined />}>
+              重新生成令牌
+            </Button>
+          </Popconfirm>
+          <Popconfirm
+            title="确定要删除此 Webhook 吗？"
+            description="删除后回调地址立即失效"
+            onConfirm={() => handleDelete(record.id)}
+            okText="确定"
+            cancelText="取消"
+          >
+            <Button type="link" danger icon={<DeleteOutlined />}>
+              删除
+            </Button>
+          </Popconfirm>
+        </Space>
+      ),
+    },
+  ];
+
+  return (
+    <div>
+      <Card>
+        <div style={{ marginBottom: 16, display: 'flex', justifyContent: 'space-between', alignItems: 'center' }}>
+          <h2 style={{ margin: 0 }}>Webhook</h2>
+          <Button type="primary" icon={<PlusOutlined />} onClick={handleCreate}>
+            添加 Webhook
+          </Button>
+        </div>
+
+        <Table
+          dataSource={hooks || []}
+          columns={columns}
+          rowKey="id"
+          loading={loading}
+          pagination={{
+            showTotal: (total) => `共 ${total} 条`,
+          }}
+        />
+      </Card>
+
+      <Modal
+        title={editingHook ? '编辑 Webhook' : '添加 Webhook'}
+        open={modalVisible}
+        onOk={handleSubmit}
+        onCancel={() => setModalVisible(false)}
+        confirmLoading={actionLoading}
+        width={600}
+      >
+        <Form form={form} layout="vertical">
+          <Form.Item
+            name="name"
+            label="名称"
+            rules={[{ required: true, message: '请输入名称' }]}
+          >
+            <Input placeholder="例如: harbor-push" />
+          </Form.Item>
+
+          <Form.Item
+            name="registry"
+            label="源 Registry"
+            rules={[{ required: true, message: '请选择源 Registry' }]}
+            extra="推送事件只匹配以该 Registry 为源的任务，按项目、仓库和 tag 过滤规则筛选，仅同步推送的 tag。支持 Harbor、Distribution 和 Docker Hub 的通知格式"
+          >
+            <Select placeholder="选择发送事件的 Registry">
+              {registries?.map((reg) => (
+                <Select.Option key={reg.id} value={reg.id}>
+                  {reg.name}
+                </Select.Option>
+              ))}
+            </Select>
+          </Form.Item>
+
+          <Form.Item name="enabled" label="启用" valuePropName="checked" initialValue={true}>
+            <Switch />
+          </Form.Item>
+        </Form>
+      </Modal>
+    </div>
+  );
+};
+
+export default Webhooks;
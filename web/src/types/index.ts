@@ -6,11 +6,67 @@ export interface Registry {
   username: string;
   insecure: boolean;
   rate_limit: number;
+  bandwidth?: string;           // 带宽限制，如 20MB 或 08:00-20:00=20MB
+  breaker?: BreakerState;       // 熔断器状态，仅列表接口返回，启动后未使用过的 Registry 没有
   created_at: string;
   updated_at: string;
 }
 
+// 熔断器状态
+export interface BreakerState {
+  state: 'closed' | 'open' | 'half-open';
+  failures: number;             // 连续失败次数
+  opened_at?: string;
+  retry_at?: string;            // 熔断结束、允许探测的时间
+  last_error?: string;
+}
+
+// 拉取配额（Docker Hub）
+export interface PullQuota {
+  limit: number;
+  remaining: number;
+  window: number;               // 配额窗口（秒）
+  source?: string;
+  updated_at: string;
+}
+
+// GET /registries/:id/quota 的响应
+export interface RegistryQuota {
+  registry_id: number;
+  available: boolean;           // false 表示该 Registry 不报告拉取配额
+  quota?: PullQuota;
+}
+
+// 单个操作的重试策略，0 或未设置表示使用默认值
+export interface RetryPolicy {
+  max_attempts?: number;
+  initial_interval?: number;    // 秒
+  max_interval?: number;        // 秒
+}
+
+// 任务重试策略：顶层字段作用于所有操作，各操作可单独覆盖
+export interface RetrySettings extends RetryPolicy {
+  budget?: number;              // 每次执行最多重试次数，0=不限
+  manifest?: RetryPolicy;
+  blob_download?: RetryPolicy;
+  blob_upload?: RetryPolicy;
+  catalog?: RetryPolicy;        // 列出仓库和 tag
+}
+
+// 同步目标
+export interface SyncTarget {
+  registry: number;
+  project: string;
+  repo: string;
+}
+
 // 同步任务类型
+// 任务依赖：success=上游成功后运行，always=上游成功或失败后都运行
+export interface TaskDependency {
+  task_id: number;
+  condition: 'success' | 'always';
+}
+
 export interface SyncTask {
   id: number;
   name: string;
@@ -21,12 +77,23 @@ export interface SyncTask {
   target_registry: number;
   target_project: string;       // 新增：目标项目
   target_repo: string;          // 改为可选：空=使用源仓库名
+  targets?: SyncTarget[];       // 多目标（fan-out）：非空时取代单个目标
   tag_include: string[];
   tag_exclude: string[];
   tag_latest: number;
   architectures: string[];
+  bandwidth?: string;           // 任务带宽限制（源下载），格式同 Registry
+  quota_threshold?: number;     // 剩余拉取配额低于该值时停止或推迟，0=不检查
+  quota_action?: 'stop' | 'postpone';
+  retry?: RetrySettings;         // 重试策略，未设置的项使用服务端默认值
+  timeout?: number;             // 最长执行时间（秒），超时后终止，0=使用服务端默认值
   enabled: boolean;
   cron_expression: string;
+  timezone?: string;            // cron 表达式的时区（IANA 名称），空=服务器时区
+  catch_up?: 'skip' | 'run-once'; // 服务停止期间错过定时运行：忽略或启动时补跑一次
+  last_scheduled_at?: string;   // 最近一次定时触发（或启用定时）的时间
+  overlap_policy?: 'skip' | 'queue' | 'cancel-previous'; // 定时触发时上次执行仍在运行的处理方式
+  depends_on?: TaskDependency[]; // 上游任务，满足条件后自动运行
   send_notification: boolean;
   notification_condition: 'all' | 'failed';
   notification_channel_ids: string;
@@ -36,6 +103,30 @@ export interface SyncTask {
   target_registry_obj?: Registry;
 }
 
+// 任务定时预览
+export interface TaskSchedule {
+  task_id: number;
+  cron_expression: string;
+  timezone: string;
+  enabled: boolean;
+  catch_up: 'skip' | 'run-once';
+  last_scheduled_at?: string;
+  next_runs: string[];          // 接下来的运行时间，带时区偏移
+}
+
+// 入站 Webhook：Registry 推送镜像时调用 /api/v1/hooks/:token
+export interface Webhook {
+  id: number;
+  name: string;
+  token: string;
+  registry: number;             // 发送事件的源 Registry
+  enabled: boolean;
+  last_triggered_at?: string;
+  created_at: string;
+  updated_at: string;
+  registry_obj?: Registry;
+}
+
 // 通知渠道类型
 export interface NotificationChannel {
   id: number;
@@ -49,7 +140,52 @@ export interface NotificationChannel {
 }
 
 // 执行状态
-export type ExecutionStatus = 'pending' | 'running' | 'success' | 'failed' | 'canceled';
+// 执行中单个镜像（repo:tag）的结果
+export type ImageStatus = 'pending' | 'success' | 'failed' | 'skipped';
+
+// 镜像在某个目标上的结果
+export interface ImageTarget {
+  registry: number;
+  registry_name: string;
+  ref: string;                  // 目标中的完整引用
+  digest?: string;
+  status: ImageStatus;
+  bytes_transferred: number;
+  blobs_copied: number;
+  blobs_skipped: number;
+  blobs_mounted: number;
+  error_code?: string;
+  error?: string;
+}
+
+export interface ExecutionImage {
+  id: number;
+  execution_id: number;
+  repository: string;           // 源仓库名（不含项目）
+  tag: string;
+  status: ImageStatus;
+  error?: string;
+  error_code?: string;          // OCI 错误码或 HTTP_<状态码> 等
+  source_ref: string;
+  source_digest: string;
+  bytes_transferred: number;
+  blobs_copied: number;
+  blobs_skipped: number;        // 目标中已存在
+  blobs_mounted: number;        // 从目标的其他仓库挂载
+  duration_ms: number;
+  targets: ImageTarget[];
+  created_at: string;
+  updated_at: string;
+}
+
+export interface ExecutionImagePage {
+  items: ExecutionImage[];
+  total: number;
+  page: number;
+  page_size: number;
+}
+
+export type ExecutionStatus = 'pending' | 'running' | 'success' | 'failed' | 'canceled' | 'interrupted' | 'timed_out'; // interrupted：服务重启时仍在运行；timed_out：超过最长执行时间被终止；两者均可恢复
 
 // 执行记录
 export interface Execution {
@@ -64,12 +200,44 @@ export interface Execution {
   failed_blobs: number;
   total_size: number;
   synced_size: number;
+  cache_hits: number;
+  cache_misses: number;
+  target_results?: TargetResult[];
+  only_tags?: string[];         // 仅同步这些 tag（repo:tag），如配额不足推迟的 tag
+  canceled_by?: string;         // 取消人
+  canceled_at?: string;
+  run_id: number;               // 流水线运行 ID（首个执行的 ID）
+  triggered_by?: number;        // 触发本次执行的上游执行 ID
+  worker?: string;              // 最近认领该执行的 worker，服务端直接运行时为空
   error_message: string;
   created_at: string;
   updated_at: string;
   task?: SyncTask;
 }
 
+// 流水线运行：由任务依赖串联的执行
+export interface Pipeline {
+  run_id: number;
+  status: ExecutionStatus;
+  start_time: string;
+  end_time?: string;
+  executions: Execution[];
+}
+
+// 单个目标的执行结果
+export interface TargetResult {
+  registry: number;
+  registry_name: string;
+  project: string;
+  status: ExecutionStatus;
+  synced_tags: number;
+  failed_tags: number;
+  synced_blobs: number;
+  skipped_blobs: number;
+  failed_blobs: number;
+  error?: string;
+}
+
 // 日志级别
 export type LogLevel = 'info' | 'warn' | 'error' | 'debug';
 
@@ -88,6 +256,7 @@ export interface Stats {
   enabled_tasks: number;
   total_executions: number;
   running_executions: number;
+  pending_executions: number;   // 排队中
   success_executions: number;
   failed_executions: number;
   total_registries: number;